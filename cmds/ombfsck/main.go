@@ -0,0 +1,51 @@
+// ombfsck checks that the block headers in a public record form a valid chain
+// from its peg block up to its tip. It rebuilds every stored header, checks
+// its hash, its proof of work and its difficulty and reports the first block
+// that fails. The record is opened read-only so that it is left as it was.
+// Usage:
+// > ./ombfsck -pubrecpath ~/.ombnode/data/mainnet/pubrecord.db
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+var (
+	pubrecpath = flag.String("pubrecpath", "", "The path to the public record to check")
+	testNet    = flag.Bool("testnet", false, "Check the testnet record in the node's data directory")
+)
+
+func main() {
+	flag.Parse()
+
+	nodedir := ombutil.AppDataDir("ombnode", false)
+	net := "mainnet"
+	if *testNet {
+		net = "testnet"
+	}
+	dbpath := filepath.Join(nodedir, "data", net, "pubrecord.db")
+
+	if *pubrecpath != "" {
+		dbpath = *pubrecpath
+	}
+	log.Printf("Checking pubrec: %s\n", dbpath)
+	n, err := pubrecdb.VerifyChainAt(dbpath, nil)
+	if fault, ok := err.(*pubrecdb.BlockFault); ok {
+		log.Printf("%d blocks passed before the first bad block.\n", n)
+		log.Printf("Bad block: %s\n", fault.Hash)
+		log.Printf("Height: %d\n", fault.Height)
+		log.Printf("Reason: %s\n", fault.Reason)
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("All %d blocks passed.\n", n)
+}
@@ -0,0 +1,56 @@
+// ombreindex rebuilds the records of a public record from the raw
+// transactions it kept. Only records stored while raw transactions were kept
+// (see pubrecdb.Options.KeepRawTxs) are rebuilt, the rest are left alone.
+// Usage:
+// > ./ombreindex -pubrecpath ~/.ombnode/data/mainnet/pubrecord.db
+package main
+
+import (
+	"flag"
+	"log"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+var (
+	pubrecpath = flag.String("pubrecpath", "", "The path to the public record to rebuild")
+	pgurl      = flag.String("pgurl", "", "The PostgreSQL record to rebuild instead of the sqlite file")
+	testNet    = flag.Bool("testnet", false, "Rebuild the testnet record in the node's data directory")
+)
+
+func main() {
+	flag.Parse()
+
+	nodedir := ombutil.AppDataDir("ombnode", false)
+	net, params := "mainnet", &chaincfg.MainNetParams
+	if *testNet {
+		net, params = "testnet", &chaincfg.TestNet3Params
+	}
+	dbpath := filepath.Join(nodedir, "data", net, "pubrecord.db")
+
+	if *pubrecpath != "" {
+		dbpath = *pubrecpath
+	}
+
+	var db *pubrecdb.PublicRecord
+	var err error
+	if *pgurl != "" {
+		log.Printf("Connecting to the PostgreSQL pubrec\n")
+		db, err = pubrecdb.LoadPgDB(*pgurl)
+	} else {
+		log.Printf("Rebuilding pubrec: %s\n", dbpath)
+		db, err = pubrecdb.LoadDB(dbpath, nil)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	n, err := db.Reindex(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Rebuilt %d records.\n", n)
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/soapboxsys/ombudslib/jsonapi"
 	"github.com/soapboxsys/ombudslib/ombutil"
@@ -15,6 +17,15 @@ var (
 	host       = flag.String("host", "localhost:1055", "The ip and port for the server to listen on")
 	pubrecpath = flag.String("pubrecpath", "", "The path to the static files to serve")
 	verbose    = flag.Bool("verbose", false, "Logs the output of every request")
+	admintoken = flag.String("admintoken", "", "The bearer token for the blacklist admin routes. They are off when empty")
+	rawendos   = flag.Bool("rawendos", false, "Report every endorsement of a bulletin next to its unique endorsers")
+	pgurl      = flag.String("pgurl", "", "The PostgreSQL record to serve instead of the sqlite file. For example postgres://localhost/pubrecord")
+	readconns  = flag.Int("readconns", pubrecdb.DefaultOptions().ReadConns, "The most connections to the sqlite file that requests are served from at once")
+	busytime   = flag.Duration("busytimeout", pubrecdb.DefaultOptions().BusyTimeout, "How long a request waits for a locked sqlite file")
+	querytime  = flag.Duration("querytimeout", 30*time.Second, "How long a single query can run before the request is failed. 0 lets queries run until they are done")
+	watchtime  = flag.Duration("watchinterval", time.Second, "How often the record is checked for blocks stored by another process, such as ombnode")
+	publicurl  = flag.String("publicurl", "", "The public url of the api that feeds and ActivityPub link to. For example https://relay.example/api/. Feeds link relative to the host without it")
+	apkey      = flag.String("apkey", "", "The PEM file of the RSA key that ActivityPub actors sign with. Federation is off when empty")
 )
 
 func Log(handler http.Handler) http.Handler {
@@ -33,11 +44,45 @@ func main() {
 	if *pubrecpath != "" {
 		dbpath = *pubrecpath
 	}
-	log.Printf("Opening pubrec: %s\n", dbpath)
-	db, err := pubrecdb.LoadDB(dbpath)
+
+	var db *pubrecdb.PublicRecord
+	var err error
+	if *pgurl != "" {
+		log.Printf("Connecting to the PostgreSQL pubrec\n")
+		db, err = pubrecdb.LoadPgDB(*pgurl)
+	} else {
+		log.Printf("Opening pubrec: %s\n", dbpath)
+		opts := pubrecdb.DefaultOptions()
+		opts.ReadConns = *readconns
+		opts.BusyTimeout = *busytime
+		db, err = pubrecdb.LoadDB(dbpath, opts)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	db.ShowRawEndoCounts(*rawendos)
+	db.SetQueryTimeout(*querytime)
+
+	// The integrity check reads the whole record so it runs in the
+	// background. Its result shows up in the DB status once it is done.
+	go func() {
+		check, err := db.CheckIntegrity()
+		if err != nil {
+			log.Printf("Integrity check failed: %s\n", err)
+			return
+		}
+		log.Printf("Integrity check ok: %t\n", check.Ok)
+	}()
+
+	// Blocks are stored by another process. Subscribers of the stream and
+	// the followers of actors hear about them once the tip is seen to move.
+	go db.Watch(context.Background(), *watchtime)
+
+	if *publicurl != "" {
+		if err := jsonapi.SetPublicURL(*publicurl); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	prefix := "/api/"
 	router := jsonapi.Router(prefix, db)
@@ -49,6 +94,27 @@ func main() {
 		ContactInst:   "Knock three times and speak Friend",
 	}
 	jsonapi.AddApiFacts(who, prefix, router)
+	jsonapi.AddModeration(db, *admintoken, prefix, router)
+
+	if *apkey != "" {
+		key, err := jsonapi.LoadKey(*apkey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fed, err := jsonapi.NewFederation(db, *publicurl, key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		jsonapi.AddFederation(fed, prefix, router)
+		// A subscription that ends pauses the deliveries, not the relay.
+		go func() {
+			for {
+				err := fed.Run(nil)
+				log.Printf("Federation stopped: %v, subscribing again\n", err)
+				time.Sleep(time.Second)
+			}
+		}()
+	}
 
 	log.Printf("Webserver listening at %s.\n", *host)
 
@@ -33,7 +33,7 @@ func main() {
 
 	// Load pubrec
 	p := path.Join(dataPath, "pubrecord.db")
-	precdb, err := pubrecdb.LoadDB(p)
+	precdb, err := pubrecdb.LoadDB(p, nil)
 	if err != nil {
 		log.Fatal("Loading prec: ", err)
 	}
@@ -0,0 +1,845 @@
+package jsonapi
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/gorilla/mux"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+const activityJson = "application/activity+json"
+
+// The max size in bytes of an activity posted to an inbox and of a document
+// fetched from another server.
+const maxActivitySize = 1 << 20
+
+var (
+	// The most followers kept for a single author.
+	maxFollowers = 1000
+	// The number of activities posted to other servers at once and the
+	// most that can wait for their turn. Activities past that are dropped.
+	deliveryWorkers = 8
+	deliveryQueue   = 1024
+	// How long a fetched actor is used to check the signatures of its
+	// activities and the most actors kept.
+	actorCacheTTL   = 10 * time.Minute
+	maxCachedActors = 1000
+)
+
+// ErrPrivateAddr is returned when another server would be reached at an
+// address that is not on the public internet.
+var ErrPrivateAddr error = errors.New("address is not public")
+
+// A Federation presents the authors in the record as read-only ActivityPub
+// actors. Other servers can follow an author and are then sent the author's
+// new bulletins as Notes and endorsements as Likes. Nothing they send is
+// stored in the record.
+//
+// Followers are kept in memory and are forgotten when the relay restarts.
+// Activities are posted by deliveryWorkers goroutines and dropped when more
+// than deliveryQueue are waiting.
+type Federation struct {
+	db     pubrecdb.Store
+	base   string // The absolute url of the api's prefix
+	host   string // The domain of the accounts in WebFinger
+	key    *rsa.PrivateKey
+	keyPem string
+
+	// Client makes the signed requests to other servers. The one
+	// NewFederation makes refuses to connect to private, loopback and
+	// link-local addresses.
+	Client *http.Client
+
+	// allowPrivate lets the tests reach servers on the loopback.
+	allowPrivate bool
+
+	mu sync.Mutex
+	// The inboxes of the followers of each author keyed by follower.
+	followers map[string]map[string]string
+	// The actors that signed activities keyed by the id of their key.
+	actors map[string]cachedActor
+
+	deliveries chan delivery
+}
+
+// A cachedActor is an actor along with when it was fetched.
+type cachedActor struct {
+	actor   *ombjson.Actor
+	fetched time.Time
+}
+
+// A delivery is an activity of an author waiting to be posted to an inbox.
+type delivery struct {
+	addr  string
+	inbox string
+	act   *ombjson.APObject
+}
+
+// NewFederation returns a federation that serves the record under base, the
+// absolute url of the api's prefix, for example https://relay.example/api/.
+// Every actor signs its requests with key.
+func NewFederation(db pubrecdb.Store, base string, key *rsa.PrivateKey) (*Federation, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("base url %q is not absolute", base)
+	}
+	pub, err := publicKeyPem(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fed := &Federation{
+		db:         db,
+		base:       strings.TrimSuffix(base, "/") + "/",
+		host:       u.Host,
+		key:        key,
+		keyPem:     pub,
+		followers:  make(map[string]map[string]string),
+		actors:     make(map[string]cachedActor),
+		deliveries: make(chan delivery, deliveryQueue),
+	}
+	// Addresses are checked once they are resolved so that a name cannot
+	// point somewhere else by the time it is connected to.
+	dialer := &net.Dialer{Timeout: 30 * time.Second, Control: fed.checkDial}
+	fed.Client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+	for i := 0; i < deliveryWorkers; i++ {
+		go fed.deliveryWorker()
+	}
+	return fed, nil
+}
+
+// checkDial refuses connections to addresses that are not public.
+func (fed *Federation) checkDial(network, address string, c syscall.RawConn) error {
+	if fed.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return ErrPrivateAddr
+	}
+	return nil
+}
+
+// sameOrigin reports if s is an absolute url on the scheme and host of u.
+func sameOrigin(u *url.URL, s string) bool {
+	v, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return v.Scheme == u.Scheme && strings.EqualFold(v.Host, u.Host)
+}
+
+func (fed *Federation) actorId(addr string) string {
+	return fed.base + "ap/actor/" + addr
+}
+
+func (fed *Federation) keyId(addr string) string {
+	return fed.actorId(addr) + "#main-key"
+}
+
+func (fed *Federation) noteId(txid string) string {
+	return fed.base + "ap/note/" + txid
+}
+
+func (fed *Federation) likeId(txid string) string {
+	return fed.base + "ap/like/" + txid
+}
+
+// decodeAddress accepts the addresses of both the main and the test network.
+func decodeAddress(s string) (btcutil.Address, error) {
+	addr, err := btcutil.DecodeAddress(s, &chaincfg.MainNetParams)
+	if err != nil {
+		addr, err = btcutil.DecodeAddress(s, &chaincfg.TestNet3Params)
+	}
+	return addr, err
+}
+
+// apTime formats the timestamp of a block for ActivityStreams.
+func apTime(ref *ombjson.BlockRef) string {
+	if ref == nil {
+		return ""
+	}
+	return time.Unix(ref.Timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+// newNote presents a bulletin as a public Note. The message is escaped and
+// its tags become Hashtags that link to the tag's page.
+func (fed *Federation) newNote(bltn *ombjson.Bulletin) *ombjson.APObject {
+	actor := fed.actorId(bltn.Author)
+	content := strings.Replace(html.EscapeString(bltn.Message), "\n", "<br>", -1)
+	note := &ombjson.APObject{
+		Id:           fed.noteId(bltn.Txid),
+		Type:         "Note",
+		AttributedTo: actor,
+		Content:      "<p>" + content + "</p>",
+		Published:    apTime(bltn.BlockRef),
+		Url:          fed.base + "bltn/" + bltn.Txid,
+		To:           []string{ombjson.PublicAudience},
+		Cc:           []string{actor + "/followers"},
+	}
+
+	tags := []string{}
+	for tag := range ombutil.ParseTags(bltn.Message) {
+		tags = append(tags, string(tag))
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		note.Tag = append(note.Tag, &ombjson.APTag{
+			Type: "Hashtag",
+			Name: tag,
+			Href: fed.base + "tag/" + url.PathEscape(strings.TrimPrefix(tag, "#")),
+		})
+	}
+
+	if loc := bltn.Location; loc != nil {
+		note.Location = &ombjson.Place{
+			Type:      "Place",
+			Latitude:  loc.Lat,
+			Longitude: loc.Lon,
+			Altitude:  loc.H,
+		}
+	}
+	return note
+}
+
+// newCreate wraps the Note of a bulletin in the activity that published it.
+func (fed *Federation) newCreate(bltn *ombjson.Bulletin) *ombjson.APObject {
+	note := fed.newNote(bltn)
+	return &ombjson.APObject{
+		Id:        note.Id + "#create",
+		Type:      "Create",
+		Actor:     note.AttributedTo,
+		Published: note.Published,
+		To:        note.To,
+		Cc:        note.Cc,
+		Object:    note,
+	}
+}
+
+// newLike presents an endorsement as a Like of the endorsed bulletin's Note.
+func (fed *Federation) newLike(endo *ombjson.Endorsement) *ombjson.APObject {
+	actor := fed.actorId(endo.Author)
+	return &ombjson.APObject{
+		Id:        fed.likeId(endo.Txid),
+		Type:      "Like",
+		Actor:     actor,
+		Published: apTime(endo.BlockRef),
+		To:        []string{ombjson.PublicAudience},
+		Cc:        []string{actor + "/followers"},
+		Object:    fed.noteId(endo.Bid),
+	}
+}
+
+// writeActivity writes an ActivityStreams document.
+func writeActivity(w http.ResponseWriter, m interface{}) {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		http.Error(w, "Failed", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", activityJson)
+	w.Write(bytes)
+}
+
+// author looks up the summary of the author at addrStr. It writes the error
+// response and returns nil if there is no such author.
+func (fed *Federation) author(w http.ResponseWriter, db pubrecdb.Store, addrStr string) *ombjson.AuthorSummary {
+	addr, err := decodeAddress(addrStr)
+	if err != nil {
+		http.Error(w, "Author does not exist", 404)
+		return nil
+	}
+
+	resp, err := db.GetAuthor(addr, nil, 1)
+	if err == pubrecdb.ErrWithheld {
+		http.Error(w, err.Error(), 451)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return nil
+	}
+	if resp.Summary == nil {
+		http.Error(w, "Author does not exist", 404)
+		return nil
+	}
+	return resp.Summary
+}
+
+// WebFingerHandler resolves acct:addr@host to the author's actor.
+func (fed *Federation) WebFingerHandler(w http.ResponseWriter, request *http.Request) {
+	db := fed.db.WithContext(request.Context())
+
+	resource := request.URL.Query().Get("resource")
+	acct := strings.TrimPrefix(resource, "acct:")
+	i := strings.LastIndex(acct, "@")
+	if i < 0 || !strings.EqualFold(acct[i+1:], fed.host) {
+		http.Error(w, "Resource is not an account on this relay", 404)
+		return
+	}
+	summary := fed.author(w, db, acct[:i])
+	if summary == nil {
+		return
+	}
+
+	actor := fed.actorId(summary.Address)
+	wf := &ombjson.WebFinger{
+		Subject: "acct:" + summary.Address + "@" + fed.host,
+		Aliases: []string{actor},
+		Links: []*ombjson.WebFingerLink{
+			{Rel: "self", Type: activityJson, Href: actor},
+			{Rel: "http://webfinger.net/rel/profile-page", Href: fed.base + "author/" + summary.Address},
+		},
+	}
+
+	bytes, err := json.Marshal(wf)
+	if err != nil {
+		http.Error(w, "Failed", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jrd+json")
+	w.Write(bytes)
+}
+
+// ActorHandler serves the actor document of an author.
+func (fed *Federation) ActorHandler(w http.ResponseWriter, request *http.Request) {
+	db := fed.db.WithContext(request.Context())
+
+	summary := fed.author(w, db, mux.Vars(request)["addr"])
+	if summary == nil {
+		return
+	}
+
+	id := fed.actorId(summary.Address)
+	writeActivity(w, &ombjson.Actor{
+		Context:           ombjson.ActorContext,
+		Id:                id,
+		Type:              "Person",
+		PreferredUsername: summary.Address,
+		Name:              summary.Address,
+		Summary: fmt.Sprintf("<p>An author on the Ombuds public record with %d bulletins and %d endorsements.</p>",
+			summary.NumBltns, summary.NumEndos),
+		Url:       fed.base + "author/" + summary.Address,
+		Inbox:     id + "/inbox",
+		Outbox:    id + "/outbox",
+		Followers: id + "/followers",
+		PublicKey: &ombjson.PublicKey{
+			Id:           fed.keyId(summary.Address),
+			Owner:        id,
+			PublicKeyPem: fed.keyPem,
+		},
+	})
+}
+
+// OutboxHandler serves the bulletins and endorsements of an author, newest
+// first. Without the page param only the size of the outbox and a link to
+// its first page are served. Pages are walked with the record's cursors.
+func (fed *Federation) OutboxHandler(w http.ResponseWriter, request *http.Request) {
+	db := fed.db.WithContext(request.Context())
+
+	summary := fed.author(w, db, mux.Vars(request)["addr"])
+	if summary == nil {
+		return
+	}
+	outbox := fed.actorId(summary.Address) + "/outbox"
+
+	if request.URL.Query().Get("page") == "" {
+		writeActivity(w, &ombjson.APCollection{
+			Context:    ombjson.ActivityStreams,
+			Id:         outbox,
+			Type:       "OrderedCollection",
+			TotalItems: int64(summary.NumBltns + summary.NumEndos),
+			First:      outbox + "?page=true",
+		})
+		return
+	}
+
+	c, limit, err := pageParams(request)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	addr, _ := decodeAddress(summary.Address)
+	resp, err := db.GetAuthor(addr, c, limit)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	type item struct {
+		height int32
+		txid   string
+		obj    *ombjson.APObject
+	}
+	items := []item{}
+	for _, bltn := range resp.Bulletins {
+		items = append(items, item{bltn.BlockRef.Height, bltn.Txid, fed.newCreate(bltn)})
+	}
+	for _, endo := range resp.Endorsements {
+		items = append(items, item{endo.BlockRef.Height, endo.Txid, fed.newLike(endo)})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].height != items[j].height {
+			return items[i].height > items[j].height
+		}
+		return items[i].txid > items[j].txid
+	})
+
+	page := &ombjson.APCollection{
+		Context:      ombjson.ActivityStreams,
+		Id:           outbox + "?" + request.URL.RawQuery,
+		Type:         "OrderedCollectionPage",
+		PartOf:       outbox,
+		OrderedItems: []*ombjson.APObject{},
+	}
+	for _, it := range items {
+		page.OrderedItems = append(page.OrderedItems, it.obj)
+	}
+	if resp.Next != "" {
+		page.Next = outbox + "?page=true&cursor=" + resp.Next
+	}
+	if resp.Prev != "" {
+		page.Prev = outbox + "?page=true&cursor=" + resp.Prev
+	}
+	writeActivity(w, page)
+}
+
+// FollowersHandler serves how many servers follow an author. The followers
+// themselves are not listed.
+func (fed *Federation) FollowersHandler(w http.ResponseWriter, request *http.Request) {
+	db := fed.db.WithContext(request.Context())
+
+	summary := fed.author(w, db, mux.Vars(request)["addr"])
+	if summary == nil {
+		return
+	}
+
+	fed.mu.Lock()
+	n := len(fed.followers[summary.Address])
+	fed.mu.Unlock()
+
+	writeActivity(w, &ombjson.APCollection{
+		Context:    ombjson.ActivityStreams,
+		Id:         fed.actorId(summary.Address) + "/followers",
+		Type:       "OrderedCollection",
+		TotalItems: int64(n),
+	})
+}
+
+// NoteHandler serves the Note of a single bulletin.
+func (fed *Federation) NoteHandler(w http.ResponseWriter, request *http.Request) {
+	db := fed.db.WithContext(request.Context())
+
+	txid, err := wire.NewShaHashFromStr(mux.Vars(request)["txid"])
+	if err != nil {
+		http.Error(w, "That is not a sha2 hash", 404)
+		return
+	}
+	bltn, err := db.GetBulletin(txid)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Bulletin does not exist", 404)
+		return
+	}
+	if err == pubrecdb.ErrWithheld {
+		http.Error(w, err.Error(), 451)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	note := fed.newNote(bltn)
+	note.Context = ombjson.ActivityStreams
+	writeActivity(w, note)
+}
+
+// LikeHandler serves the Like of a single endorsement.
+func (fed *Federation) LikeHandler(w http.ResponseWriter, request *http.Request) {
+	db := fed.db.WithContext(request.Context())
+
+	txid, err := wire.NewShaHashFromStr(mux.Vars(request)["txid"])
+	if err != nil {
+		http.Error(w, "That is not a sha2 hash", 404)
+		return
+	}
+	endo, err := db.GetEndorsement(txid)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Endorsement does not exist", 404)
+		return
+	}
+	if err == pubrecdb.ErrWithheld {
+		http.Error(w, err.Error(), 451)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	like := fed.newLike(endo)
+	like.Context = ombjson.ActivityStreams
+	writeActivity(w, like)
+}
+
+// An activity posted to an inbox. Only the fields needed to handle a Follow
+// and the Undo of one are read.
+type inboxActivity struct {
+	Id     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// objectId returns the id of an activity's object whether it was sent as an
+// id or as the whole object.
+func (act *inboxActivity) objectId() string {
+	var id string
+	if err := json.Unmarshal(act.Object, &id); err == nil {
+		return id
+	}
+	var obj struct {
+		Id string `json:"id"`
+	}
+	json.Unmarshal(act.Object, &obj)
+	return obj.Id
+}
+
+// InboxHandler takes Follows of an author and their Undos. The request must
+// be signed by the actor that sent it. A Follow is answered by posting an
+// Accept to the follower's inbox. Everything else is ignored since the
+// actors are read-only. Each author keeps at most maxFollowers followers.
+func (fed *Federation) InboxHandler(w http.ResponseWriter, request *http.Request) {
+	db := fed.db.WithContext(request.Context())
+
+	summary := fed.author(w, db, mux.Vars(request)["addr"])
+	if summary == nil {
+		return
+	}
+	addr := summary.Address
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, request.Body, maxActivitySize))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	var act inboxActivity
+	if err := json.Unmarshal(body, &act); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var remote *ombjson.Actor
+	var signer string
+	cached := false
+	keyFor := func(keyId string) (*rsa.PublicKey, error) {
+		signer = keyId
+		remote, cached, err = fed.actor(addr, keyId)
+		if err != nil {
+			return nil, err
+		}
+		if remote.PublicKey == nil || remote.PublicKey.Id != keyId {
+			return nil, ErrBadSignature
+		}
+		return parsePublicKeyPem(remote.PublicKey.PublicKeyPem)
+	}
+	_, err = verifyRequest(request, body, keyFor)
+	if err != nil && cached {
+		// The actor may have changed its key since it was fetched.
+		fed.forgetActor(signer)
+		_, err = verifyRequest(request, body, keyFor)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 401)
+		return
+	}
+	if remote.Id != act.Actor {
+		http.Error(w, "Activity was not signed by its actor", 401)
+		return
+	}
+
+	switch act.Type {
+	case "Follow":
+		if act.objectId() != fed.actorId(addr) {
+			http.Error(w, "Follow is not of this actor", 400)
+			return
+		}
+		fed.mu.Lock()
+		if fed.followers[addr] == nil {
+			fed.followers[addr] = make(map[string]string)
+		}
+		_, known := fed.followers[addr][remote.Id]
+		full := !known && len(fed.followers[addr]) >= maxFollowers
+		if !full {
+			fed.followers[addr][remote.Id] = remote.Inbox
+		}
+		fed.mu.Unlock()
+		if full {
+			http.Error(w, "Author has as many followers as the relay keeps", 503)
+			return
+		}
+
+		accept := &ombjson.APObject{
+			Context: ombjson.ActivityStreams,
+			Id:      fed.actorId(addr) + "#accept-" + url.QueryEscape(act.Id),
+			Type:    "Accept",
+			Actor:   fed.actorId(addr),
+			Object:  json.RawMessage(body),
+		}
+		fed.enqueue(addr, remote.Inbox, accept)
+	case "Undo":
+		var inner inboxActivity
+		if err := json.Unmarshal(act.Object, &inner); err == nil && inner.Type == "Follow" {
+			fed.mu.Lock()
+			delete(fed.followers[addr], remote.Id)
+			fed.mu.Unlock()
+		}
+	}
+
+	w.WriteHeader(202)
+}
+
+// actor returns the actor that owns keyId and reports if it was fetched
+// earlier. Actors are fetched again once they are older than actorCacheTTL.
+func (fed *Federation) actor(addr, keyId string) (*ombjson.Actor, bool, error) {
+	fed.mu.Lock()
+	c, ok := fed.actors[keyId]
+	fed.mu.Unlock()
+	if ok && time.Since(c.fetched) < actorCacheTTL {
+		return c.actor, true, nil
+	}
+
+	actor, err := fed.fetchActor(addr, keyId)
+	if err != nil {
+		return nil, false, err
+	}
+
+	fed.mu.Lock()
+	defer fed.mu.Unlock()
+	if len(fed.actors) >= maxCachedActors {
+		for id, c := range fed.actors {
+			if time.Since(c.fetched) >= actorCacheTTL {
+				delete(fed.actors, id)
+			}
+		}
+	}
+	// Any actor makes room when none has expired.
+	for id := range fed.actors {
+		if len(fed.actors) < maxCachedActors {
+			break
+		}
+		delete(fed.actors, id)
+	}
+	fed.actors[keyId] = cachedActor{actor, time.Now()}
+	return actor, false, nil
+}
+
+// forgetActor drops the actor that owns keyId so that it is fetched again.
+func (fed *Federation) forgetActor(keyId string) {
+	fed.mu.Lock()
+	delete(fed.actors, keyId)
+	fed.mu.Unlock()
+}
+
+// fetchActor fetches the actor that owns keyId with a request signed by the
+// author. The actor's id, key and inbox must be on the origin of keyId, so
+// that a server can only speak for its own actors.
+func (fed *Federation) fetchActor(addr, keyId string) (*ombjson.Actor, error) {
+	u, err := url.Parse(keyId)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return nil, ErrBadSignature
+	}
+	u.Fragment = ""
+
+	request, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", activityJson)
+	if err := signRequest(request, fed.keyId(addr), fed.key, nil); err != nil {
+		return nil, err
+	}
+
+	resp, err := fed.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("fetching %s returned %s", u, resp.Status)
+	}
+
+	var actor ombjson.Actor
+	body := io.LimitReader(resp.Body, maxActivitySize)
+	if err := json.NewDecoder(body).Decode(&actor); err != nil {
+		return nil, err
+	}
+	if actor.Inbox == "" {
+		return nil, errors.New("actor has no inbox")
+	}
+	if !sameOrigin(u, actor.Id) || !sameOrigin(u, actor.Inbox) ||
+		actor.PublicKey != nil && !sameOrigin(u, actor.PublicKey.Id) {
+		return nil, errors.New("actor is not on the origin of its key")
+	}
+	return &actor, nil
+}
+
+// post delivers an activity to an inbox with a request signed by the author.
+func (fed *Federation) post(addr, inbox string, act *ombjson.APObject) error {
+	body, err := json.Marshal(act)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", activityJson)
+	if err := signRequest(request, fed.keyId(addr), fed.key, body); err != nil {
+		return err
+	}
+
+	resp, err := fed.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("posting to %s returned %s", inbox, resp.Status)
+	}
+	return nil
+}
+
+// enqueue queues an activity of the author to be posted to an inbox. It is
+// dropped if the queue is full and false is returned.
+func (fed *Federation) enqueue(addr, inbox string, act *ombjson.APObject) bool {
+	select {
+	case fed.deliveries <- delivery{addr, inbox, act}:
+		return true
+	default:
+		log.Printf("Delivery queue is full, dropped %s to %s\n", act.Id, inbox)
+		return false
+	}
+}
+
+// deliveryWorker posts the queued activities one at a time.
+func (fed *Federation) deliveryWorker() {
+	for d := range fed.deliveries {
+		if err := fed.post(d.addr, d.inbox, d.act); err != nil {
+			log.Printf("Delivery of %s failed: %s\n", d.act.Id, err)
+		}
+	}
+}
+
+// deliver queues an activity of the author for each of the author's
+// followers.
+func (fed *Federation) deliver(addr string, act *ombjson.APObject) {
+	fed.mu.Lock()
+	inboxes := []string{}
+	for _, inbox := range fed.followers[addr] {
+		inboxes = append(inboxes, inbox)
+	}
+	fed.mu.Unlock()
+
+	act.Context = ombjson.ActivityStreams
+	for _, inbox := range inboxes {
+		fed.enqueue(addr, inbox, act)
+	}
+}
+
+func (fed *Federation) subscribe() *pubrecdb.Subscription {
+	return fed.db.Subscribe(pubrecdb.KindFilter(
+		pubrecdb.BulletinAdded,
+		pubrecdb.EndorsementAdded,
+	))
+}
+
+// Run delivers the bulletins and endorsements that are added to the record
+// to the followers of their authors until done is closed. If the record gets
+// ahead of the deliveries the records in between are skipped.
+func (fed *Federation) Run(done <-chan struct{}) error {
+	return fed.run(fed.subscribe(), done)
+}
+
+func (fed *Federation) run(sub *pubrecdb.Subscription, done <-chan struct{}) error {
+	for {
+	events:
+		for {
+			select {
+			case <-done:
+				sub.Close()
+				return nil
+			case ev, ok := <-sub.Events():
+				if !ok {
+					break events
+				}
+				switch ev.Kind {
+				case pubrecdb.BulletinAdded:
+					fed.deliver(ev.Bulletin.Author, fed.newCreate(ev.Bulletin))
+				case pubrecdb.EndorsementAdded:
+					fed.deliver(ev.Endorsement.Author, fed.newLike(ev.Endorsement))
+				}
+			}
+		}
+
+		if err := sub.Err(); err != pubrecdb.ErrFellBehind {
+			return err
+		}
+		log.Println("Federation fell behind the record, skipping ahead")
+		sub = fed.subscribe()
+	}
+}
+
+// AddFederation adds the WebFinger route and the routes of the actors to the
+// router. WebFinger is served at the root of the host since that is where
+// other servers look for it.
+func AddFederation(fed *Federation, prefix string, router *mux.Router) {
+	sha2re := "([a-f]|[A-F]|[0-9]){64}"
+	addrgex := "([a-z]|[A-Z]|[0-9]){30,35}"
+
+	router.HandleFunc("/.well-known/webfinger", fed.WebFingerHandler)
+
+	p := prefix + fmt.Sprintf("ap/actor/{addr:%s}", addrgex)
+	router.HandleFunc(p, fed.ActorHandler)
+	router.HandleFunc(p+"/outbox", fed.OutboxHandler)
+	router.HandleFunc(p+"/followers", fed.FollowersHandler)
+	router.HandleFunc(p+"/inbox", fed.InboxHandler).Methods("POST")
+	router.HandleFunc(prefix+fmt.Sprintf("ap/note/{txid:%s}", sha2re), fed.NoteHandler)
+	router.HandleFunc(prefix+fmt.Sprintf("ap/like/{txid:%s}", sha2re), fed.LikeHandler)
+}
@@ -0,0 +1,372 @@
+package jsonapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/gorilla/mux"
+	"github.com/soapboxsys/ombudslib/memrecord"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+// setupFederation serves a record with a single bulletin in it.
+func setupFederation(t *testing.T) (*Federation, *memrecord.Record, *btcutil.Block, *httptest.Server) {
+	db, err := memrecord.New(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk := insertBltnBlock(t, db, peg.GetStartBlock(), "Hello <fediverse> & #ombuds")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	srv := httptest.NewServer(router)
+	fed, err := NewFederation(db, srv.URL+"/api/", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stub servers listen on the loopback.
+	fed.allowPrivate = true
+	AddFederation(fed, "/api/", router)
+	return fed, db, blk, srv
+}
+
+func getActivity(t *testing.T, u string, v interface{}) {
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET %s returned %s", u, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestActorDocuments(t *testing.T) {
+	fed, _, _, srv := setupFederation(t)
+	defer srv.Close()
+	addr := testAuthor(t)
+
+	var wf ombjson.WebFinger
+	getActivity(t, srv.URL+"/.well-known/webfinger?resource=acct:"+addr+"@"+fed.host, &wf)
+	if len(wf.Links) == 0 || wf.Links[0].Href != fed.actorId(addr) {
+		t.Fatalf("WebFinger did not point at the actor: %v", wf)
+	}
+
+	var actor ombjson.Actor
+	getActivity(t, fed.actorId(addr), &actor)
+	if actor.Type != "Person" || actor.Inbox != fed.actorId(addr)+"/inbox" || actor.PublicKey == nil {
+		t.Fatalf("Bad actor: %v", actor)
+	}
+	if _, err := parsePublicKeyPem(actor.PublicKey.PublicKeyPem); err != nil {
+		t.Fatal(err)
+	}
+
+	var outbox ombjson.APCollection
+	getActivity(t, actor.Outbox, &outbox)
+	if outbox.TotalItems != 1 || outbox.First == "" {
+		t.Fatalf("Bad outbox: %v", outbox)
+	}
+
+	var page struct {
+		OrderedItems []struct {
+			Type   string           `json:"type"`
+			Object ombjson.APObject `json:"object"`
+		} `json:"orderedItems"`
+	}
+	getActivity(t, outbox.First, &page)
+	if len(page.OrderedItems) != 1 || page.OrderedItems[0].Type != "Create" {
+		t.Fatalf("Bad outbox page: %v", page)
+	}
+	note := page.OrderedItems[0].Object
+	if note.Type != "Note" || note.Content != "<p>Hello &lt;fediverse&gt; &amp; #ombuds</p>" ||
+		len(note.Tag) != 1 || note.Tag[0].Name != "#ombuds" {
+		t.Fatalf("Bad note: %v", note)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/ap/actor/1BoatSLRHtKNngkdXEeobR76b53LETtpyT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Fatalf("Unknown author returned %s", resp.Status)
+	}
+}
+
+// stubServer plays a remote server with a single actor. It checks that the
+// requests made to it are signed by the federation and hands over whatever
+// is posted to its inbox.
+type stubServer struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	inbox chan *ombjson.APObject
+
+	// actorInbox is the inbox the actor claims when it is set.
+	actorInbox string
+	// fetches counts the times the actor was fetched.
+	fetches int32
+}
+
+func newStubServer(t *testing.T, fed *Federation) *stubServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &stubServer{key: key, inbox: make(chan *ombjson.APObject, 10)}
+
+	fedKey := func(string) (*rsa.PublicKey, error) {
+		return &fed.key.PublicKey, nil
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/actor", func(w http.ResponseWriter, request *http.Request) {
+		if _, err := verifyRequest(request, nil, fedKey); err != nil {
+			http.Error(w, err.Error(), 401)
+			return
+		}
+		atomic.AddInt32(&stub.fetches, 1)
+		inbox := stub.URL + "/inbox"
+		if stub.actorInbox != "" {
+			inbox = stub.actorInbox
+		}
+		pub, _ := publicKeyPem(stub.key)
+		writeActivity(w, &ombjson.Actor{
+			Id:    stub.URL + "/actor",
+			Type:  "Person",
+			Inbox: inbox,
+			PublicKey: &ombjson.PublicKey{
+				Id:           stub.URL + "/actor#main-key",
+				Owner:        stub.URL + "/actor",
+				PublicKeyPem: pub,
+			},
+		})
+	})
+	router.HandleFunc("/inbox", func(w http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		if _, err := verifyRequest(request, body, fedKey); err != nil {
+			t.Errorf("Delivery was not signed: %v", err)
+			http.Error(w, err.Error(), 401)
+			return
+		}
+		var act ombjson.APObject
+		if err := json.Unmarshal(body, &act); err != nil {
+			t.Error(err)
+		}
+		stub.inbox <- &act
+		w.WriteHeader(202)
+	})
+	stub.Server = httptest.NewServer(router)
+	return stub
+}
+
+// post sends a signed activity from the stub's actor.
+func (stub *stubServer) post(t *testing.T, inbox string, act interface{}) *http.Response {
+	body, _ := json.Marshal(act)
+	request, err := http.NewRequest("POST", inbox, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signRequest(request, stub.URL+"/actor#main-key", stub.key, body); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func (stub *stubServer) next(t *testing.T) *ombjson.APObject {
+	select {
+	case act := <-stub.inbox:
+		return act
+	case <-time.After(5 * time.Second):
+		t.Fatal("Nothing was delivered to the inbox")
+	}
+	return nil
+}
+
+func TestFollowDelivery(t *testing.T) {
+	fed, db, blk, srv := setupFederation(t)
+	defer srv.Close()
+	stub := newStubServer(t, fed)
+	defer stub.Close()
+	actor := fed.actorId(testAuthor(t))
+
+	follow := map[string]string{
+		"@context": ombjson.ActivityStreams,
+		"id":       stub.URL + "/follow/1",
+		"type":     "Follow",
+		"actor":    stub.URL + "/actor",
+		"object":   actor,
+	}
+
+	// A Follow signed by someone other than its actor is refused.
+	forged := map[string]string{}
+	for k, v := range follow {
+		forged[k] = v
+	}
+	forged["actor"] = stub.URL + "/someone-else"
+	if resp := stub.post(t, actor+"/inbox", forged); resp.StatusCode != 401 {
+		t.Fatalf("Forged follow returned %s", resp.Status)
+	}
+
+	if resp := stub.post(t, actor+"/inbox", follow); resp.StatusCode != 202 {
+		t.Fatalf("Follow returned %s", resp.Status)
+	}
+	accept := stub.next(t)
+	if accept.Type != "Accept" || accept.Actor != actor {
+		t.Fatalf("Bad accept: %v", accept)
+	}
+
+	var followers ombjson.APCollection
+	getActivity(t, actor+"/followers", &followers)
+	if followers.TotalItems != 1 {
+		t.Fatalf("Bad followers: %v", followers)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go fed.run(fed.subscribe(), done)
+
+	insertBltnBlock(t, db, blk, "Delivered to the stub")
+	create := stub.next(t)
+	note, _ := create.Object.(map[string]interface{})
+	if create.Type != "Create" || create.Actor != actor || note == nil ||
+		!strings.Contains(note["content"].(string), "Delivered to the stub") {
+		t.Fatalf("Bad create: %v", create)
+	}
+}
+
+func TestInboxRefusals(t *testing.T) {
+	fed, _, _, srv := setupFederation(t)
+	defer srv.Close()
+	actor := fed.actorId(testAuthor(t))
+
+	follow := func(stub *stubServer) *http.Response {
+		return stub.post(t, actor+"/inbox", map[string]string{
+			"@context": ombjson.ActivityStreams,
+			"id":       stub.URL + "/follow/1",
+			"type":     "Follow",
+			"actor":    stub.URL + "/actor",
+			"object":   actor,
+		})
+	}
+	numFollowers := func() int64 {
+		var followers ombjson.APCollection
+		getActivity(t, actor+"/followers", &followers)
+		return followers.TotalItems
+	}
+
+	// An actor cannot have its deliveries sent to another server.
+	stub := newStubServer(t, fed)
+	defer stub.Close()
+	stub.actorInbox = "http://internal.example/inbox"
+	if resp := follow(stub); resp.StatusCode != 401 || numFollowers() != 0 {
+		t.Fatalf("Follow with a foreign inbox returned %s", resp.Status)
+	}
+	stub.actorInbox = ""
+
+	// Nothing is fetched from addresses that are not public.
+	fed.allowPrivate = false
+	if _, err := fed.fetchActor(testAuthor(t), stub.URL+"/actor#main-key"); !errors.Is(err, ErrPrivateAddr) {
+		t.Fatalf("Fetch from the loopback returned: %v", err)
+	}
+	if resp := follow(stub); resp.StatusCode != 401 || numFollowers() != 0 {
+		t.Fatalf("Follow from the loopback returned %s", resp.Status)
+	}
+	fed.allowPrivate = true
+
+	defer func(n int) { maxFollowers = n }(maxFollowers)
+	maxFollowers = 1
+	if resp := follow(stub); resp.StatusCode != 202 {
+		t.Fatalf("Follow returned %s", resp.Status)
+	}
+	stub.next(t)
+	other := newStubServer(t, fed)
+	defer other.Close()
+	if resp := follow(other); resp.StatusCode != 503 || numFollowers() != 1 {
+		t.Fatalf("Follow past the limit returned %s", resp.Status)
+	}
+	// Following again is not a new follower.
+	if resp := follow(stub); resp.StatusCode != 202 {
+		t.Fatalf("Repeated follow returned %s", resp.Status)
+	}
+}
+
+func TestActorCache(t *testing.T) {
+	fed, _, _, srv := setupFederation(t)
+	defer srv.Close()
+	stub := newStubServer(t, fed)
+	defer stub.Close()
+	actor := fed.actorId(testAuthor(t))
+
+	follow := map[string]string{
+		"@context": ombjson.ActivityStreams,
+		"id":       stub.URL + "/follow/1",
+		"type":     "Follow",
+		"actor":    stub.URL + "/actor",
+		"object":   actor,
+	}
+	for i := 0; i < 2; i++ {
+		if resp := stub.post(t, actor+"/inbox", follow); resp.StatusCode != 202 {
+			t.Fatalf("Follow returned %s", resp.Status)
+		}
+		stub.next(t)
+	}
+	if n := atomic.LoadInt32(&stub.fetches); n != 1 {
+		t.Fatalf("Actor was fetched %d times", n)
+	}
+
+	// A new key is picked up once the cached one fails.
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.key = key
+	if resp := stub.post(t, actor+"/inbox", follow); resp.StatusCode != 202 {
+		t.Fatalf("Follow with a new key returned %s", resp.Status)
+	}
+	stub.next(t)
+	if n := atomic.LoadInt32(&stub.fetches); n != 2 {
+		t.Fatalf("Actor was fetched %d times", n)
+	}
+}
+
+func TestDeliveryQueue(t *testing.T) {
+	defer func(n, m int) { deliveryWorkers, deliveryQueue = n, m }(deliveryWorkers, deliveryQueue)
+	deliveryWorkers, deliveryQueue = 0, 1
+
+	fed, _, _, srv := setupFederation(t)
+	defer srv.Close()
+
+	// Nothing takes from the queue so the second activity does not fit.
+	act := &ombjson.APObject{Id: "urn:test:1", Type: "Create"}
+	if !fed.enqueue(testAuthor(t), "http://inbox.example/", act) {
+		t.Fatal("Activity was not queued")
+	}
+	if fed.enqueue(testAuthor(t), "http://inbox.example/", act) {
+		t.Fatal("Activity was queued past the limit")
+	}
+}
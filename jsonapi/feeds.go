@@ -0,0 +1,257 @@
+package jsonapi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+// The most runes of a bulletin's message used as the title of its entry.
+var feedTitleLen = 80
+
+// feedFormat returns rss or atom if the client asked for a feed either
+// through the Accept header or with ?format=. It returns "" otherwise.
+func feedFormat(request *http.Request) string {
+	switch f := request.URL.Query().Get("format"); f {
+	case "rss", "atom":
+		return f
+	}
+	accept := request.Header.Get("Accept")
+	if strings.Contains(accept, "application/atom+xml") {
+		return "atom"
+	}
+	if strings.Contains(accept, "application/rss+xml") {
+		return "rss"
+	}
+	return ""
+}
+
+// publicURL is the absolute url of the api's prefix that feeds link to. It
+// is set with SetPublicURL.
+var publicURL string
+
+// SetPublicURL sets the absolute url of the api's prefix that feeds and their
+// entries link to, for example https://relay.example/api/. Until it is set
+// feeds link relative to the host they are fetched from. The Host and
+// X-Forwarded-Proto headers are never used since any client can set them.
+func SetPublicURL(base string) error {
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() {
+		return fmt.Errorf("public url %q is not absolute", base)
+	}
+	publicURL = strings.TrimSuffix(base, "/") + "/"
+	return nil
+}
+
+// routePrefix returns the api's prefix the request was routed under. route
+// is the fixed start of the handler's path after the prefix, like "tag/".
+// The prefix comes from the template of the route the request matched, so
+// it does not depend on how the rest of the path was encoded.
+func routePrefix(request *http.Request, route string) string {
+	if r := mux.CurrentRoute(request); r != nil {
+		if tpl, err := r.GetPathTemplate(); err == nil {
+			if i := strings.IndexByte(tpl, '{'); i >= 0 {
+				tpl = tpl[:i]
+			}
+			return strings.TrimSuffix(tpl, route)
+		}
+	}
+	return "/"
+}
+
+// apiRoot returns the url the api is served under.
+func apiRoot(request *http.Request, route string) string {
+	if publicURL != "" {
+		return publicURL
+	}
+	return routePrefix(request, route)
+}
+
+// selfURL returns the url of the request.
+func selfURL(request *http.Request, route string) string {
+	uri := request.URL.RequestURI()
+	if publicURL != "" {
+		return publicURL + strings.TrimPrefix(uri, routePrefix(request, route))
+	}
+	return uri
+}
+
+// entryTitle uses the first line of the message as the title of its entry.
+func entryTitle(bltn *ombjson.Bulletin) string {
+	s := strings.TrimSpace(bltn.Message)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if utf8.RuneCountInString(s) > feedTitleLen {
+		s = string([]rune(s)[:feedTitleLen]) + "…"
+	}
+	if s == "" {
+		s = bltn.Txid
+	}
+	return s
+}
+
+// entryID is the same for a bulletin no matter which relay serves it.
+func entryID(bltn *ombjson.Bulletin) string {
+	return "urn:ombuds:bltn:" + bltn.Txid
+}
+
+// entryTime is the timestamp of the block the bulletin was mined in.
+func entryTime(bltn *ombjson.Bulletin) time.Time {
+	if bltn.BlockRef == nil {
+		return time.Unix(bltn.Timestamp, 0).UTC()
+	}
+	return time.Unix(bltn.BlockRef.Timestamp, 0).UTC()
+}
+
+// feedUpdated is the time of the newest entry in the feed.
+func feedUpdated(bltns []*ombjson.Bulletin) time.Time {
+	updated := time.Unix(0, 0).UTC()
+	for _, bltn := range bltns {
+		if t := entryTime(bltn); t.After(updated) {
+			updated = t
+		}
+	}
+	return updated
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	Guid        rssGuid `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Generator string      `xml:"generator"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Author    atomAuthor  `xml:"author"`
+	Link      atomLink    `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeFeed writes the bulletins as an RSS 2.0 or an Atom feed. Each entry
+// links to the bulletin in the api and is dated by its block. The route is
+// passed on to apiRoot and selfURL.
+func writeFeed(w http.ResponseWriter, request *http.Request, format, title, route string, bltns []*ombjson.Bulletin) {
+	w.Header().Set("Vary", "Accept")
+
+	root := apiRoot(request, route)
+	self := selfURL(request, route)
+	updated := feedUpdated(bltns)
+
+	var feed interface{}
+	contentType := "application/rss+xml; charset=utf-8"
+	if format == "atom" {
+		f := &atomFeed{
+			ID:        self,
+			Title:     title,
+			Updated:   updated.Format(time.RFC3339),
+			Generator: "ombudslib/jsonapi",
+			Links:     []atomLink{{Rel: "self", Href: self}},
+			Entries:   []atomEntry{},
+		}
+		for _, bltn := range bltns {
+			ts := entryTime(bltn).Format(time.RFC3339)
+			f.Entries = append(f.Entries, atomEntry{
+				ID:        entryID(bltn),
+				Title:     entryTitle(bltn),
+				Updated:   ts,
+				Published: ts,
+				Author:    atomAuthor{Name: bltn.Author},
+				Link:      atomLink{Rel: "alternate", Href: root + "bltn/" + bltn.Txid},
+				Content:   atomContent{Type: "text", Value: bltn.Message},
+			})
+		}
+		feed = f
+		contentType = "application/atom+xml; charset=utf-8"
+	} else {
+		ch := rssChannel{
+			Title:       title,
+			Link:        self,
+			Description: title,
+			Generator:   "ombudslib/jsonapi",
+			Items:       []rssItem{},
+		}
+		if len(bltns) > 0 {
+			ch.LastBuildDate = updated.Format(time.RFC1123Z)
+		}
+		for _, bltn := range bltns {
+			ch.Items = append(ch.Items, rssItem{
+				Title:       entryTitle(bltn),
+				Link:        root + "bltn/" + bltn.Txid,
+				Description: bltn.Message,
+				Guid:        rssGuid{Value: entryID(bltn)},
+				PubDate:     entryTime(bltn).Format(time.RFC1123Z),
+			})
+		}
+		feed = &rssFeed{Version: "2.0", Channel: ch}
+	}
+
+	bytes, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	w.Write(bytes)
+}
@@ -0,0 +1,147 @@
+package jsonapi
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+// getFeed fetches u with the Accept header and returns the content type and
+// the body of the response.
+func getFeed(t *testing.T, u, accept string) (string, []byte) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET %s returned %s", u, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Header.Get("Content-Type"), body
+}
+
+func TestFeeds(t *testing.T) {
+	db, srv := setupStream(t)
+	defer srv.Close()
+
+	msg := "Hello <fediverse> & #ombuds"
+	blk := insertBltnBlock(t, db, peg.GetStartBlock(), msg)
+	bltn := blockBltn(t, db, blk)
+	ts := blk.MsgBlock().Header.Timestamp.UTC()
+	link := "/api/bltn/" + bltn.Txid
+
+	paths := []string{
+		"/api/new",
+		"/api/tag/ombuds",
+		"/api/board/ombuds",
+		"/api/author/" + testAuthor(t),
+	}
+	for _, path := range paths {
+		ct, body := getFeed(t, srv.URL+path+"?format=rss", "")
+		if !strings.HasPrefix(ct, "application/rss+xml") {
+			t.Fatalf("%s: served as %s", path, ct)
+		}
+		if !strings.Contains(string(body), "Hello &lt;fediverse&gt; &amp; #ombuds") {
+			t.Fatalf("%s: message was not escaped: %s", path, body)
+		}
+		var rss rssFeed
+		if err := xml.Unmarshal(body, &rss); err != nil {
+			t.Fatal(err)
+		}
+		items := rss.Channel.Items
+		if len(items) != 1 || items[0].Description != msg || items[0].Link != link ||
+			items[0].Guid.Value != "urn:ombuds:bltn:"+bltn.Txid || items[0].Guid.IsPermaLink ||
+			items[0].PubDate != ts.Format(time.RFC1123Z) ||
+			rss.Channel.Link != path+"?format=rss" {
+			t.Fatalf("%s: %s", path, spw(rss))
+		}
+
+		ct, body = getFeed(t, srv.URL+path, "application/atom+xml")
+		if !strings.HasPrefix(ct, "application/atom+xml") {
+			t.Fatalf("%s: served as %s", path, ct)
+		}
+		var atom atomFeed
+		if err := xml.Unmarshal(body, &atom); err != nil {
+			t.Fatal(err)
+		}
+		entries := atom.Entries
+		if len(entries) != 1 || entries[0].Content.Value != msg || entries[0].Link.Href != link ||
+			entries[0].ID != "urn:ombuds:bltn:"+bltn.Txid ||
+			entries[0].Published != ts.Format(time.RFC3339) ||
+			atom.Updated != ts.Format(time.RFC3339) || entries[0].Author.Name != bltn.Author {
+			t.Fatalf("%s: %s", path, spw(atom))
+		}
+	}
+
+	// ?format= wins over the Accept header and without either the page is
+	// served as json.
+	if ct, _ := getFeed(t, srv.URL+"/api/new?format=rss", "application/atom+xml"); !strings.HasPrefix(ct, "application/rss+xml") {
+		t.Fatalf("Served as %s", ct)
+	}
+	if ct, _ := getFeed(t, srv.URL+"/api/new", "application/rss+xml"); !strings.HasPrefix(ct, "application/rss+xml") {
+		t.Fatalf("Served as %s", ct)
+	}
+	if ct, _ := getFeed(t, srv.URL+"/api/new", ""); strings.Contains(ct, "xml") {
+		t.Fatalf("Served as %s", ct)
+	}
+}
+
+func TestFeedLinks(t *testing.T) {
+	var root, self string
+	r := mux.NewRouter()
+	r.HandleFunc("/relay/api/tag/{tag:.{1,90}}", func(w http.ResponseWriter, request *http.Request) {
+		root, self = apiRoot(request, "tag/"), selfURL(request, "tag/")
+	})
+
+	get := func(path string) {
+		root, self = "", ""
+		// Neither header is trusted.
+		request := httptest.NewRequest("GET", "http://relay.example"+path, nil)
+		request.Host = "evil.example"
+		request.Header.Set("X-Forwarded-Proto", "gopher")
+		r.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	// The path is decoded but the tag the route holds may not be.
+	paths := []string{"/relay/api/tag/lambs", "/relay/api/tag/%23lambs", "/relay/api/tag/a%2Fb"}
+	for _, path := range paths {
+		get(path)
+		if root != "/relay/api/" || self != path {
+			t.Fatalf("%s: %s %s", path, root, self)
+		}
+	}
+
+	defer func() { publicURL = "" }()
+	if err := SetPublicURL("https://relay.example/api"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		get(path)
+		if root != "https://relay.example/api/" ||
+			self != "https://relay.example/api/"+strings.TrimPrefix(path, "/relay/api/") {
+			t.Fatalf("%s: %s %s", path, root, self)
+		}
+	}
+
+	if err := SetPublicURL("/api/"); err == nil {
+		t.Fatal("A relative url was accepted")
+	}
+}
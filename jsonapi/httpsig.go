@@ -0,0 +1,188 @@
+package jsonapi
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrBadSignature error = errors.New("request signature is invalid")
+
+// How far the Date of a signed request may be from now.
+var maxSignatureSkew = 12 * time.Hour
+
+// LoadKey reads the RSA private key in the PEM file at path. Both PKCS#1 and
+// PKCS#8 keys are accepted.
+func LoadKey(path string) (*rsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM block", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s does not hold an RSA key", path)
+	}
+	return rsaKey, nil
+}
+
+// publicKeyPem encodes the public half of key the way actor documents carry it.
+func publicKeyPem(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// parsePublicKeyPem decodes the key of a remote actor.
+func parsePublicKeyPem(s string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// bodyDigest is the value of the Digest header of a request with body.
+func bodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// signingString builds the string that a signature over headers covers.
+func signingString(request *http.Request, headers []string) string {
+	lines := []string{}
+	for _, h := range headers {
+		switch h {
+		case "(request-target)":
+			target := strings.ToLower(request.Method) + " " + request.URL.RequestURI()
+			lines = append(lines, h+": "+target)
+		case "host":
+			host := request.Host
+			if host == "" {
+				host = request.URL.Host
+			}
+			lines = append(lines, h+": "+host)
+		default:
+			lines = append(lines, h+": "+request.Header.Get(h))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// signRequest signs the request with key following the HTTP Signatures draft
+// that ActivityPub servers use. A request with a body also signs its digest.
+func signRequest(request *http.Request, keyId string, key *rsa.PrivateKey, body []byte) error {
+	request.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		request.Header.Set("Digest", bodyDigest(body))
+		headers = append(headers, "digest")
+	}
+
+	sum := sha256.Sum256([]byte(signingString(request, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyId, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// parseSignature splits a Signature header into its params.
+func parseSignature(s string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+	return params
+}
+
+// verifyRequest checks the signature of a request that was made with the
+// body. The signature must cover the request target, the date and, when
+// there is a body, its digest. The key of the signer is looked up with
+// keyFor. It returns the keyId of the signer.
+func verifyRequest(request *http.Request, body []byte, keyFor func(keyId string) (*rsa.PublicKey, error)) (string, error) {
+	params := parseSignature(request.Header.Get("Signature"))
+	keyId, sig64 := params["keyId"], params["signature"]
+	if keyId == "" || sig64 == "" {
+		return "", ErrBadSignature
+	}
+	if alg := params["algorithm"]; alg != "" && alg != "rsa-sha256" && alg != "hs2019" {
+		return "", ErrBadSignature
+	}
+
+	headers := strings.Fields(params["headers"])
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	covered := make(map[string]bool)
+	for i, h := range headers {
+		headers[i] = strings.ToLower(h)
+		covered[headers[i]] = true
+	}
+	if !covered["(request-target)"] || !covered["date"] {
+		return "", ErrBadSignature
+	}
+	if body != nil && (!covered["digest"] || request.Header.Get("Digest") != bodyDigest(body)) {
+		return "", ErrBadSignature
+	}
+
+	date, err := http.ParseTime(request.Header.Get("Date"))
+	if err != nil {
+		return "", ErrBadSignature
+	}
+	if skew := time.Since(date); skew > maxSignatureSkew || skew < -maxSignatureSkew {
+		return "", ErrBadSignature
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(sig64)
+	if err != nil {
+		return "", ErrBadSignature
+	}
+	pub, err := keyFor(keyId)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(signingString(request, headers)))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+		return "", ErrBadSignature
+	}
+	return keyId, nil
+}
@@ -4,9 +4,9 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
@@ -34,8 +34,123 @@ func writeJson(w http.ResponseWriter, m interface{}) {
 	w.Write(bytes)
 }
 
-func BulletinHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+// wantsGeoJson determines if the client asked for GeoJSON either through the
+// Accept header or with ?format=geojson.
+func wantsGeoJson(request *http.Request) bool {
+	if request.URL.Query().Get("format") == "geojson" {
+		return true
+	}
+	return strings.Contains(request.Header.Get("Accept"), "application/geo+json")
+}
+
+// toGeoJson converts responses that carry bulletins into GeoJSON. A single
+// bulletin becomes a Feature and everything else becomes a FeatureCollection
+// of the contained bulletins. Any endorsements in the response are dropped.
+func toGeoJson(m interface{}) (interface{}, bool) {
+	switch m := m.(type) {
+	case *ombjson.Bulletin:
+		return ombjson.NewFeature(m), true
+	case []*ombjson.Bulletin:
+		return ombjson.NewFeatureCollection(m), true
+	case *ombjson.BltnPage:
+		return ombjson.NewFeatureCollection(m.Bulletins), true
+	case *ombjson.Page:
+		return ombjson.NewFeatureCollection(m.Bulletins), true
+	case *ombjson.Block:
+		return ombjson.NewFeatureCollection(m.Bulletins), true
+	case *ombjson.AuthorResp:
+		return ombjson.NewFeatureCollection(m.Bulletins), true
+	case *ombjson.BoardResp:
+		return ombjson.NewFeatureCollection(m.Bulletins), true
+	default:
+		return nil, false
+	}
+}
+
+// writeBltns writes a response that contains bulletins as GeoJSON if the
+// client asked for it and as plain json otherwise.
+func writeBltns(w http.ResponseWriter, request *http.Request, m interface{}) {
+	w.Header().Set("Vary", "Accept")
+
+	geo, ok := toGeoJson(m)
+	if !ok || !wantsGeoJson(request) {
+		writeJson(w, m)
+		return
+	}
+
+	bytes, err := json.Marshal(geo)
+	if err != nil {
+		http.Error(w, "Failed", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Write(bytes)
+}
+
+// pageParams reads the cursor and the limit a client passed to a list
+// endpoint. Both are optional.
+func pageParams(request *http.Request) (*pubrecdb.Cursor, int, error) {
+	vals := request.URL.Query()
+
+	var c *pubrecdb.Cursor
+	var err error
+	if s := vals.Get("cursor"); s != "" {
+		if c, err = pubrecdb.ParseCursor(s); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var limit int
+	if s := vals.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+			return nil, 0, fmt.Errorf("limit must be a positive integer")
+		}
+	}
+
+	return c, limit, nil
+}
+
+// writeLinks adds a Link header that points at the pages on either side of
+// the one being served. The links keep the rest of the request's params.
+func writeLinks(w http.ResponseWriter, request *http.Request, cs ombjson.Cursors) {
+	links := []string{}
+	for _, l := range []struct{ rel, cursor string }{{"next", cs.Next}, {"prev", cs.Prev}} {
+		if l.cursor == "" {
+			continue
+		}
+		u := *request.URL
+		vals := u.Query()
+		vals.Set("cursor", l.cursor)
+		u.RawQuery = vals.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), l.rel))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// writeWithheld marks responses that carry a bare list when blacklisted
+// items were left out of them, since the list has no room for the withheld
+// flag.
+func writeWithheld(w http.ResponseWriter, withheld bool) {
+	if withheld {
+		w.Header().Set("Ombuds-Withheld", "true")
+	}
+}
+
+// recordOptions asks for the merkle proof of a record when the client did
+// with ?proof=true.
+func recordOptions(request *http.Request) []pubrecdb.RecordOption {
+	if request.URL.Query().Get("proof") != "true" {
+		return nil
+	}
+	return []pubrecdb.RecordOption{pubrecdb.WithProof}
+}
+
+func BulletinHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
 
 		txidStr, _ := mux.Vars(request)["txid"]
 		txid, err := wire.NewShaHashFromStr(txidStr)
@@ -44,22 +159,27 @@ func BulletinHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.
 			return
 		}
 
-		bltn, err := db.GetBulletin(txid)
+		bltn, err := db.GetBulletin(txid, recordOptions(request)...)
 		if err == sql.ErrNoRows {
 			http.Error(w, "Bulletin does not exist", 404)
 			return
 		}
+		if err == pubrecdb.ErrWithheld {
+			http.Error(w, err.Error(), 451)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
-		writeJson(w, bltn)
+		writeBltns(w, request, bltn)
 	}
 }
 
-func EndorsementHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+func EndorsementHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
 
 		txidStr, _ := mux.Vars(request)["txid"]
 		txid, err := wire.NewShaHashFromStr(txidStr)
@@ -68,22 +188,27 @@ func EndorsementHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *ht
 			return
 		}
 
-		bltn, err := db.GetEndorsement(txid)
+		endo, err := db.GetEndorsement(txid, recordOptions(request)...)
 		if err == sql.ErrNoRows {
 			http.Error(w, "Endorsement does not exist", 404)
 			return
 		}
+		if err == pubrecdb.ErrWithheld {
+			http.Error(w, err.Error(), 451)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
-		writeJson(w, bltn)
+		writeJson(w, endo)
 	}
 }
 
-func BlockHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+func BlockHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
 
 		hashStr, _ := mux.Vars(request)["hash"]
 		hash, err := wire.NewShaHashFromStr(hashStr)
@@ -102,17 +227,26 @@ func BlockHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Req
 			return
 		}
 
-		writeJson(w, bltn)
+		writeBltns(w, request, bltn)
 	}
 }
 
-// Handles serving a bulletin board.
-func TagHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+// Handles serving a bulletin board. It is served as a feed when the client
+// asks for RSS or Atom.
+func TagHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
 		tagstr, _ := mux.Vars(request)["tag"]
 		tag := ombutil.Tag("#" + tagstr)
 
-		board, err := db.GetTag(tag)
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		board, err := db.GetTag(tag, c, limit)
 		if err == sql.ErrNoRows {
 			http.Error(w, err.Error(), 405)
 			return
@@ -123,24 +257,170 @@ func TagHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Reque
 			return
 		}
 
-		writeJson(w, board)
+		writeLinks(w, request, board.Cursors)
+		if format := feedFormat(request); format != "" {
+			title := "Bulletins tagged " + string(tag)
+			writeFeed(w, request, format, title, "tag/", board.Bulletins)
+			return
+		}
+		writeBltns(w, request, board)
 	}
 }
 
-func NewHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+// TagDetailHandler serves the first use, top authors, activity series and
+// related tags of a single tag. The series takes the same params as the
+// activity endpoint.
+func TagDetailHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
-		page, err := db.GetLatestPage()
+		db := db.WithContext(request.Context())
+
+		tagstr, _ := mux.Vars(request)["tag"]
+		tag := ombutil.Tag("#" + tagstr)
+
+		bucket := request.URL.Query().Get("bucket")
+		if bucket == "" {
+			bucket = pubrecdb.BucketDay
+		}
+		width, _ := pubrecdb.BucketWidth(bucket)
+
+		end, err := unixParam(request, "end", time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		start, err := unixParam(request, "start", end.Add(-defaultActivityBuckets*width))
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		detail, err := db.GetTagDetail(tag, start, end, bucket)
+		if err == sql.ErrNoRows {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		if err == pubrecdb.ErrWithheld {
+			http.Error(w, err.Error(), 451)
+			return
+		}
+		if err == pubrecdb.ErrBadSeries {
+			http.Error(w, err.Error(), 400)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
+		writeJson(w, detail)
+	}
+}
+
+// Serves the summary and a page of the bulletins of a single board.
+func BoardHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		name, _ := mux.Vars(request)["name"]
+
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		board, err := db.GetBoard(name, c, limit)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Board does not exist", 404)
+			return
+		}
+		if err == pubrecdb.ErrWithheld {
+			http.Error(w, err.Error(), 451)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeLinks(w, request, board.Cursors)
+		if format := feedFormat(request); format != "" {
+			title := "Bulletins on the board #" + strings.TrimLeft(name, "#")
+			writeFeed(w, request, format, title, "board/", board.Bulletins)
+			return
+		}
+		writeBltns(w, request, board)
+	}
+}
+
+// OrphanEndosHandler serves a page of the endorsements whose bulletin is not
+// in the record.
+func OrphanEndosHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		page, err := db.GetOrphanEndorsements(c, limit)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeLinks(w, request, page.Cursors)
 		writeJson(w, page)
 	}
 }
 
-func NewStatsHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+func AllBoardsHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		boards, err := db.GetAllBoards()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeJson(w, boards)
+	}
+}
+
+// NewHandler serves the latest page of the record. Like the tag, board and
+// author pages it is served as a feed when the client asks for RSS or Atom.
+func NewHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		page, err := db.GetLatestPage(c, limit)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeLinks(w, request, page.Cursors)
+		if format := feedFormat(request); format != "" {
+			writeFeed(w, request, format, "The latest bulletins", "new", page.Bulletins)
+			return
+		}
+		writeBltns(w, request, page)
+	}
+}
+
+func NewStatsHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
 		now := time.Now()
 		// Look back one day
 		yesterday := now.Add(-(time.Hour * 24))
@@ -153,20 +433,150 @@ func NewStatsHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.
 	}
 }
 
-func BestTagsHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+// The number of buckets an activity series covers when no start is passed.
+const defaultActivityBuckets = 30
+
+// unixParam reads the query param as a unix timestamp. def is returned when
+// the param is not present.
+func unixParam(request *http.Request, name string, def time.Time) (time.Time, error) {
+	s := request.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	ts, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a unix timestamp", name)
+	}
+	return time.Unix(ts, 0), nil
+}
+
+// ActivityHandler serves the activity in the record between the start and
+// end unix timestamps cut into hour, day or week buckets. By default it
+// covers the last 30 days.
+func ActivityHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		bucket := request.URL.Query().Get("bucket")
+		if bucket == "" {
+			bucket = pubrecdb.BucketDay
+		}
+		width, _ := pubrecdb.BucketWidth(bucket)
+
+		end, err := unixParam(request, "end", time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		start, err := unixParam(request, "start", end.Add(-defaultActivityBuckets*width))
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		series, err := db.GetActivitySeries(start, end, bucket)
+		if err == pubrecdb.ErrBadSeries {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeJson(w, series)
+	}
+}
+
+func BestTagsHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		tags, withheld, err := db.GetBestTags()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		writeWithheld(w, withheld)
+
+		writeJson(w, tags)
+	}
+}
+
+// defaultTrendWindow is the half life of a trend when none is asked for.
+const defaultTrendWindow = pubrecdb.BucketDay
+
+// trendParams reads the half life of a trend from the window param, which is
+// one of hour, day or week, and the number of items to return.
+func trendParams(request *http.Request) (time.Duration, int, error) {
+	window := request.URL.Query().Get("window")
+	if window == "" {
+		window = defaultTrendWindow
+	}
+	halfLife, ok := pubrecdb.BucketWidth(window)
+	if !ok {
+		return 0, 0, fmt.Errorf("window must be one of hour, day or week")
+	}
+
+	_, limit, err := pageParams(request)
+	if err != nil {
+		return 0, 0, err
+	}
+	if limit == 0 {
+		limit = 10
+	}
+	return halfLife, limit, nil
+}
+
+// TrendingTagsHandler serves the tags that are trending the most. Their uses
+// and endorsements lose half their weight every window.
+func TrendingTagsHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
-		tags, err := db.GetBestTags()
+		db := db.WithContext(request.Context())
+
+		halfLife, limit, err := trendParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		tags, withheld, err := db.GetTrendingTags(halfLife, limit)
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
+		writeWithheld(w, withheld)
 
 		writeJson(w, tags)
 	}
 }
 
-func AuthorHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+// TrendingBltnsHandler serves the bulletins that are trending the most.
+func TrendingBltnsHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		halfLife, limit, err := trendParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		bltns, withheld, err := db.GetTrendingBltns(halfLife, limit)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		writeWithheld(w, withheld)
+
+		writeJson(w, bltns)
+	}
+}
+
+func AuthorHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
 		addrStr, _ := mux.Vars(request)["addr"]
 		// Try our best to decode the passed AddrStr. If we can't parse it.
 		// Drop it.
@@ -180,18 +590,110 @@ func AuthorHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Re
 				return
 			}
 		}
-		resp, err := db.GetAuthor(author)
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		resp, err := db.GetAuthor(author, c, limit)
+		if err == pubrecdb.ErrWithheld {
+			http.Error(w, err.Error(), 451)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeLinks(w, request, resp.Cursors)
+		if format := feedFormat(request); format != "" {
+			title := "Bulletins by " + addrStr
+			writeFeed(w, request, format, title, "author/", resp.Bulletins)
+			return
+		}
+		writeBltns(w, request, resp)
+	}
+}
+
+// AuthorsHandler serves a page of the author directory. The directory is
+// sorted by the sort param and defaults to the most recently active authors.
+// It can be filtered with minBltns and a since unix timestamp.
+func AuthorsHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		vals := request.URL.Query()
+
+		sort := vals.Get("sort")
+		if sort == "" {
+			sort = pubrecdb.SortLastActive
+		}
+
+		var f pubrecdb.AuthorFilter
+		var err error
+		if s := vals.Get("minBltns"); s != "" {
+			if f.MinBltns, err = strconv.Atoi(s); err != nil || f.MinBltns < 0 {
+				http.Error(w, "minBltns must be a positive integer", 400)
+				return
+			}
+		}
+		if f.ActiveSince, err = unixParam(request, "since", time.Time{}); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		page, err := db.GetAllAuthors(sort, f, c, limit)
+		if err == pubrecdb.ErrBadSort {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeLinks(w, request, page.Cursors)
+		writeJson(w, page)
+	}
+}
+
+// TopAuthorsHandler serves the authors with the highest reputation in the
+// endorsement graph.
+func TopAuthorsHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		_, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if limit == 0 {
+			limit = 10
+		}
+
+		authors, withheld, err := db.GetTopAuthors(limit)
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
+		writeWithheld(w, withheld)
 
-		writeJson(w, resp)
+		writeJson(w, authors)
 	}
 }
 
-func NearbyLocHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+func NearbyLocHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
 		latStr, _ := mux.Vars(request)["lat"]
 		lonStr, _ := mux.Vars(request)["lon"]
 		rStr, _ := mux.Vars(request)["r"]
@@ -214,30 +716,144 @@ func NearbyLocHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http
 			return
 		}
 
-		bltns, err := db.GetNearbyBltns(lat, lon, r)
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		// Bulletins are sorted by distance from the point when asked. That
+		// order cannot be paged through so only the limit applies.
+		if request.URL.Query().Get("sort") == "dist" {
+			if c != nil {
+				http.Error(w, "A cursor cannot be used with sort=dist", 400)
+				return
+			}
+			bltns, withheld, err := db.GetNearbyBltnsByDist(lat, lon, r, limit)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			writeWithheld(w, withheld)
+			writeBltns(w, request, bltns)
+			return
+		}
+
+		page, err := db.GetNearbyBltns(lat, lon, r, c, limit)
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
-		writeJson(w, bltns)
+		writeLinks(w, request, page.Cursors)
+		writeWithheld(w, page.Withheld)
+		writeBltns(w, request, page.Bulletins)
 	}
 }
 
-func MostEndoHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+func BBoxHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
-		bltns, err := db.GetMostEndorsedBltns(10)
+		db := db.WithContext(request.Context())
+
+		vars := mux.Vars(request)
+
+		var err error
+		var box [4]float64
+		for i, name := range []string{"minLat", "minLon", "maxLat", "maxLon"} {
+			if box[i], err = strconv.ParseFloat(vars[name], 64); err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		page, err := db.GetBulletinsInBBox(box[0], box[1], box[2], box[3], c, limit)
+		if err == pubrecdb.ErrBadBBox {
+			http.Error(w, err.Error(), 400)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
-		writeJson(w, bltns)
+		writeLinks(w, request, page.Cursors)
+		writeWithheld(w, page.Withheld)
+		writeBltns(w, request, page.Bulletins)
 	}
 }
 
-func StatusHandler(db *pubrecdb.PublicRecord, start time.Time) func(http.ResponseWriter, *http.Request) {
+// The max size of a posted GeoJSON polygon in bytes.
+const maxPolygonSize = 1 << 20
+
+// PolygonHandler returns the bulletins inside of the GeoJSON Polygon or
+// MultiPolygon geometry posted in the body of the request.
+func PolygonHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		var geom ombjson.Geometry
+		body := http.MaxBytesReader(w, request.Body, maxPolygonSize)
+		if err := json.NewDecoder(body).Decode(&geom); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		page, err := db.GetBulletinsInPolygon(&geom, c, limit)
+		if err == pubrecdb.ErrBadPolygon {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeLinks(w, request, page.Cursors)
+		writeWithheld(w, page.Withheld)
+		writeBltns(w, request, page.Bulletins)
+	}
+}
+
+func MostEndoHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		_, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if limit == 0 {
+			limit = 10
+		}
+
+		bltns, withheld, err := db.GetMostEndorsedBltns(limit)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		writeWithheld(w, withheld)
+
+		writeBltns(w, request, bltns)
+	}
+}
+
+func StatusHandler(db pubrecdb.Store, start time.Time) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
 		blk, err := db.GetBlockTip()
 		if err != nil {
 			http.Error(w, err.Error(), 500)
@@ -257,6 +873,20 @@ func StatusHandler(db *pubrecdb.PublicRecord, start time.Time) func(http.Respons
 	}
 }
 
+func DBStatusHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		status, err := db.GetDBStatus()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeJson(w, status)
+	}
+}
+
 // function here incase further validation is needed.
 func validateHash(s string) error {
 	if len(s) != 2*wire.HashSize {
@@ -265,8 +895,10 @@ func validateHash(s string) error {
 	return nil
 }
 
-func RangeHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Request) {
+func RangeHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
 		vals := request.URL.Query()
 		start := vals.Get("start")
 		stop := vals.Get("stop")
@@ -291,14 +923,20 @@ func RangeHandler(db *pubrecdb.PublicRecord) func(http.ResponseWriter, *http.Req
 			http.Error(w, err.Error(), 500)
 			return
 		}
-		log.Println("hit here")
-		page, err := db.QueryRange(startH, stopH)
+		c, limit, err := pageParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		page, err := db.QueryRange(startH, stopH, c, limit)
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
-		writeJson(w, page)
+		writeLinks(w, request, page.Cursors)
+		writeBltns(w, request, page)
 	}
 }
 
@@ -318,13 +956,13 @@ func AddApiFacts(who ApiFacts, prefix string, router *mux.Router) {
 	router.HandleFunc(prefix+"whoami", f)
 }
 
-func Handler(prefix string, db *pubrecdb.PublicRecord) http.Handler {
+func Handler(prefix string, db pubrecdb.Store) http.Handler {
 	return Router(prefix, db)
 }
 
 // returns the http handler initialized with the api's routes. The prefix should
 // start and end with slashes. For example /api/ is a good prefix.
-func Router(prefix string, db *pubrecdb.PublicRecord) *mux.Router {
+func Router(prefix string, db pubrecdb.Store) *mux.Router {
 
 	r := mux.NewRouter()
 	sha2re := "([a-f]|[A-F]|[0-9]){64}"
@@ -339,6 +977,8 @@ func Router(prefix string, db *pubrecdb.PublicRecord) *mux.Router {
 	// Pulls floats out of urls
 	l_re := `[-+]?(\d*[.])?\d+`
 	loc_suffix := fmt.Sprintf("loc/{lat:%s},{lon:%s},{r:%s}", l_re, l_re, l_re)
+	bbox_suffix := fmt.Sprintf("bbox/{minLat:%s},{minLon:%s},{maxLat:%s},{maxLon:%s}",
+		l_re, l_re, l_re, l_re)
 
 	p := prefix
 	// Item handlers
@@ -347,19 +987,34 @@ func Router(prefix string, db *pubrecdb.PublicRecord) *mux.Router {
 	r.HandleFunc(p+fmt.Sprintf("block/{hash:%s}", sha2re), BlockHandler(db))
 	r.HandleFunc(p+fmt.Sprintf("author/{addr:%s}", addrgex), AuthorHandler(db))
 	r.HandleFunc(p+loc_suffix, NearbyLocHandler(db))
+	r.HandleFunc(p+bbox_suffix, BBoxHandler(db))
+	r.HandleFunc(p+"within", PolygonHandler(db)).Methods("POST")
 
 	// Paginated handlers
 	r.HandleFunc(p+"range", RangeHandler(db))
 	r.HandleFunc(p+fmt.Sprintf("tag/{tag:%s}", tagre), TagHandler(db))
+	r.HandleFunc(p+fmt.Sprintf("tags/{tag:%s}", tagre), TagDetailHandler(db))
 	r.HandleFunc(p+"new", NewHandler(db))
+	r.HandleFunc(p+fmt.Sprintf("board/{name:%s}", tagre), BoardHandler(db))
+	r.HandleFunc(p+"authors", AuthorsHandler(db))
+	r.HandleFunc(p+"endo/orphans", OrphanEndosHandler(db))
+
+	// Streaming handlers
+	r.HandleFunc(p+"stream", StreamHandler(db))
 
 	// Aggregate handlers
 	r.HandleFunc(p+"pop-tags", BestTagsHandler(db))
 	r.HandleFunc(p+"most-endo", MostEndoHandler(db))
+	r.HandleFunc(p+"boards", AllBoardsHandler(db))
+	r.HandleFunc(p+"authors/top", TopAuthorsHandler(db))
+	r.HandleFunc(p+"trending/tags", TrendingTagsHandler(db))
+	r.HandleFunc(p+"trending/bltns", TrendingBltnsHandler(db))
 
 	// Meta handlers
 	r.HandleFunc(p+"status", StatusHandler(db, time.Now()))
+	r.HandleFunc(p+"status/db", DBStatusHandler(db))
 	r.HandleFunc(p+"new/statistics", NewStatsHandler(db))
+	r.HandleFunc(p+"activity", ActivityHandler(db))
 
 	return r
 }
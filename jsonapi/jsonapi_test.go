@@ -0,0 +1,70 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+func TestWriteBltnsGeoJson(t *testing.T) {
+	page := &ombjson.BltnPage{
+		Bulletins: []*ombjson.Bulletin{
+			{Txid: "aa", Location: &ombjson.Location{Lat: 61.2, Lon: -149.9}},
+			{Txid: "bb"},
+		},
+	}
+
+	tests := []struct {
+		target, accept string
+		geo            bool
+	}{
+		{"/api/new", "", false},
+		{"/api/new?format=geojson", "", true},
+		{"/api/new", "application/geo+json", true},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", test.target, nil)
+		if test.accept != "" {
+			request.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		writeBltns(w, request, page)
+
+		ct := w.Header().Get("Content-Type")
+		if !test.geo {
+			if ct != "application/json" {
+				t.Fatalf("%s was served as %s", test.target, ct)
+			}
+			continue
+		}
+		if ct != "application/geo+json" {
+			t.Fatalf("%s %s was served as %s", test.target, test.accept, ct)
+		}
+
+		var fc ombjson.FeatureCollection
+		if err := json.Unmarshal(w.Body.Bytes(), &fc); err != nil {
+			t.Fatal(err)
+		}
+		if fc.Type != "FeatureCollection" || len(fc.Features) != 2 {
+			t.Fatalf("Bad collection: %s", w.Body)
+		}
+		var pos ombjson.Position
+		json.Unmarshal(fc.Features[0].Geometry.Coordinates, &pos)
+		if len(pos) < 2 || pos[0] != -149.9 || pos[1] != 61.2 {
+			t.Fatalf("Point is not lon, lat: %v", pos)
+		}
+		if fc.Features[1].Geometry != nil {
+			t.Fatalf("Bulletin without a location has a geometry: %s", w.Body)
+		}
+	}
+
+	// Responses without bulletins are left as json.
+	request := httptest.NewRequest("GET", "/api/boards?format=geojson", nil)
+	w := httptest.NewRecorder()
+	writeBltns(w, request, []*ombjson.BoardSummary{})
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Response without bulletins was served as %s", ct)
+	}
+}
@@ -0,0 +1,110 @@
+package jsonapi
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+// The max size of a posted blacklist entry in bytes.
+const maxEntrySize = 1 << 12
+
+// requireToken only lets requests through to h that carry the admin token in
+// their Authorization header as a bearer token.
+func requireToken(token string, h http.HandlerFunc) http.HandlerFunc {
+	want := []byte("Bearer " + token)
+	return func(w http.ResponseWriter, request *http.Request) {
+		got := []byte(request.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ombuds admin"`)
+			http.Error(w, "Not authorized", 401)
+			return
+		}
+		h(w, request)
+	}
+}
+
+func BlacklistHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		entries, err := db.GetBlacklist()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		writeJson(w, entries)
+	}
+}
+
+// AddBlacklistHandler adds the entry posted in the body of the request to the
+// blacklist and responds with the stored entry.
+func AddBlacklistHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		var entry ombjson.BlacklistEntry
+		body := http.MaxBytesReader(w, request.Body, maxEntrySize)
+		if err := json.NewDecoder(body).Decode(&entry); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		err, _ := db.InsertBlacklistEntry(&entry)
+		if err == pubrecdb.ErrBadBlacklistEntry {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		w.WriteHeader(201)
+		writeJson(w, entry)
+	}
+}
+
+func DeleteBlacklistHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		vars := mux.Vars(request)
+
+		err, _ := db.DeleteBlacklistEntry(vars["kind"], vars["value"])
+		if err == pubrecdb.ErrBadBlacklistEntry {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "Entry does not exist", 404)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		w.WriteHeader(204)
+	}
+}
+
+// AddModeration adds the admin routes that manage the relay's blacklist to the
+// router. Every request to them must carry the token as a bearer token. No
+// routes are added when the token is empty.
+func AddModeration(db pubrecdb.Store, token, prefix string, router *mux.Router) {
+	if token == "" {
+		return
+	}
+
+	p := prefix + "admin/blacklist"
+	router.HandleFunc(p, requireToken(token, BlacklistHandler(db))).Methods("GET")
+	router.HandleFunc(p, requireToken(token, AddBlacklistHandler(db))).Methods("POST")
+	router.HandleFunc(p+"/{kind}/{value}", requireToken(token, DeleteBlacklistHandler(db))).Methods("DELETE")
+}
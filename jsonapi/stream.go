@@ -0,0 +1,497 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/gorilla/websocket"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+// The kinds of messages sent down the stream on top of the record's own
+// bulletinAdded and endorsementAdded.
+const (
+	bulletinRemoved    = "bulletinRemoved"
+	endorsementRemoved = "endorsementRemoved"
+	// resync tells the client that it is too far behind to be streamed to.
+	// It should catch up with /new and reconnect with its last cursor.
+	resync = "resync"
+)
+
+var (
+	// How often an idle stream is pinged so that proxies keep it open.
+	streamKeepAlive = 30 * time.Second
+	// How long a single write to a client may take.
+	streamWriteWait = 10 * time.Second
+	// The most records replayed to a client that resumes from a cursor.
+	maxStreamReplay = 1000
+	// The most records read from the record to find the ones to replay.
+	maxStreamScan = 5000
+)
+
+// The stream only serves the public record so any page may open it.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// streamFilter picks the records a client of the stream asked for. Every
+// filter that is set must match.
+type streamFilter struct {
+	tag    string
+	author string
+	addr   btcutil.Address
+	geo    bool
+	lat    float64
+	lon    float64
+	r      float64 // in km
+}
+
+// streamParams reads the filters and the cursor to resume from. The cursor
+// comes from the cursor param or from the Last-Event-ID header that
+// EventSource sends when it reconnects.
+func streamParams(request *http.Request) (*streamFilter, *pubrecdb.Cursor, error) {
+	vals := request.URL.Query()
+	f := &streamFilter{}
+
+	if s := vals.Get("tag"); s != "" {
+		f.tag = "#" + strings.TrimLeft(s, "#")
+	}
+	if s := vals.Get("board"); s != "" {
+		if f.tag != "" {
+			return nil, nil, fmt.Errorf("tag and board cannot both be set")
+		}
+		f.tag = "#" + strings.TrimLeft(s, "#")
+	}
+
+	if s := vals.Get("author"); s != "" {
+		addr, err := btcutil.DecodeAddress(s, &chaincfg.MainNetParams)
+		if err != nil {
+			addr, err = btcutil.DecodeAddress(s, &chaincfg.TestNet3Params)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		f.author, f.addr = s, addr
+	}
+
+	latStr, lonStr, rStr := vals.Get("lat"), vals.Get("lon"), vals.Get("r")
+	if latStr != "" || lonStr != "" || rStr != "" {
+		var err error
+		if f.lat, err = strconv.ParseFloat(latStr, 64); err != nil {
+			return nil, nil, fmt.Errorf("lat, lon and r must be set together")
+		}
+		if f.lon, err = strconv.ParseFloat(lonStr, 64); err != nil {
+			return nil, nil, fmt.Errorf("lat, lon and r must be set together")
+		}
+		if f.r, err = strconv.ParseFloat(rStr, 64); err != nil || f.r <= 0 {
+			return nil, nil, fmt.Errorf("r must be a positive number of km")
+		}
+		f.geo = true
+	}
+
+	s := vals.Get("cursor")
+	if s == "" {
+		s = request.Header.Get("Last-Event-ID")
+	}
+	var c *pubrecdb.Cursor
+	if s != "" {
+		var err error
+		if c, err = pubrecdb.ParseCursor(s); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return f, c, nil
+}
+
+// matchBltn reports if the bulletin passes the filter.
+func (f *streamFilter) matchBltn(bltn *ombjson.Bulletin) bool {
+	if f.author != "" && bltn.Author != f.author {
+		return false
+	}
+	if f.tag != "" {
+		found := false
+		for tag := range ombutil.ParseTags(bltn.Message) {
+			if strings.EqualFold(string(tag), f.tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.geo {
+		loc := bltn.Location
+		if loc == nil || pubrecdb.Distance(f.lat, f.lon, loc.Lat, loc.Lon) > f.r*1000 {
+			return false
+		}
+	}
+	return true
+}
+
+// matchEndo reports if the endorsement passes the filter. The tag and the
+// location belong to the endorsed bulletin, which is looked up among the
+// removed bulletins first and then in the record. An endorsement whose
+// bulletin cannot be found only passes a filter on its author.
+func (f *streamFilter) matchEndo(db pubrecdb.Store, endo *ombjson.Endorsement, removed []*ombjson.Bulletin) bool {
+	if f.author != "" && endo.Author != f.author {
+		return false
+	}
+	if f.tag == "" && !f.geo {
+		return true
+	}
+
+	for _, bltn := range removed {
+		if bltn.Txid == endo.Bid {
+			return f.matchBltn(bltn)
+		}
+	}
+	bid, err := wire.NewShaHashFromStr(endo.Bid)
+	if err != nil {
+		return false
+	}
+	bltn, err := db.GetBulletin(bid)
+	if err != nil {
+		return false
+	}
+	return f.matchBltn(bltn)
+}
+
+func bltnCursor(bltn *ombjson.Bulletin) string {
+	return (&pubrecdb.Cursor{Height: bltn.BlockRef.Height, Txid: bltn.Txid}).String()
+}
+
+func endoCursor(endo *ombjson.Endorsement) string {
+	return (&pubrecdb.Cursor{Height: endo.BlockRef.Height, Txid: endo.Txid}).String()
+}
+
+// streamEvents turns an event from the record into the messages the filter
+// lets through. A disconnected block becomes a removal for each of its
+// records.
+func (f *streamFilter) streamEvents(db pubrecdb.Store, ev *pubrecdb.Event) []*ombjson.StreamEvent {
+	out := []*ombjson.StreamEvent{}
+	switch ev.Kind {
+	case pubrecdb.BulletinAdded:
+		if f.matchBltn(ev.Bulletin) {
+			out = append(out, &ombjson.StreamEvent{
+				Kind:     string(ev.Kind),
+				Cursor:   bltnCursor(ev.Bulletin),
+				Bulletin: ev.Bulletin,
+			})
+		}
+	case pubrecdb.EndorsementAdded:
+		if f.matchEndo(db, ev.Endorsement, nil) {
+			out = append(out, &ombjson.StreamEvent{
+				Kind:        string(ev.Kind),
+				Cursor:      endoCursor(ev.Endorsement),
+				Endorsement: ev.Endorsement,
+			})
+		}
+	case pubrecdb.BlockDisconnected:
+		for _, bltn := range ev.Bulletins {
+			if f.matchBltn(bltn) {
+				out = append(out, &ombjson.StreamEvent{
+					Kind:     bulletinRemoved,
+					Cursor:   bltnCursor(bltn),
+					Bulletin: bltn,
+				})
+			}
+		}
+		for _, endo := range ev.Endorsements {
+			if f.matchEndo(db, endo, ev.Bulletins) {
+				out = append(out, &ombjson.StreamEvent{
+					Kind:        endorsementRemoved,
+					Cursor:      endoCursor(endo),
+					Endorsement: endo,
+				})
+			}
+		}
+	}
+	return out
+}
+
+// replayPage reads the page of records after the cursor from the list that
+// the narrowest filter has. Only the latest records and those of an author
+// hold endorsements. An author that is withheld has no records.
+func (f *streamFilter) replayPage(db pubrecdb.Store, c *pubrecdb.Cursor) ([]*ombjson.Bulletin, []*ombjson.Endorsement, string, error) {
+	switch {
+	case f.tag != "":
+		page, err := db.GetTag(ombutil.Tag(f.tag), c, 0)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return page.Bulletins, nil, page.Prev, nil
+	case f.geo:
+		page, err := db.GetNearbyBltns(f.lat, f.lon, f.r, c, 0)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return page.Bulletins, nil, page.Prev, nil
+	case f.addr != nil:
+		page, err := db.GetAuthor(f.addr, c, 0)
+		if err == pubrecdb.ErrWithheld {
+			return nil, nil, "", nil
+		}
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return page.Bulletins, page.Endorsements, page.Prev, nil
+	}
+	page, err := db.GetLatestPage(c, 0)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return page.Bulletins, page.Endorsements, page.Prev, nil
+}
+
+// replay returns the records that were added after the cursor, oldest first,
+// that the filter lets through. It returns false if more than
+// maxStreamReplay of them pass the filter or more than maxStreamScan records
+// had to be read to find them. Endorsements are not replayed to a stream
+// filtered by tag or location.
+func (f *streamFilter) replay(db pubrecdb.Store, c *pubrecdb.Cursor) ([]*ombjson.StreamEvent, bool, error) {
+	type keyed struct {
+		height int32
+		ev     *ombjson.StreamEvent
+	}
+
+	recs := []keyed{}
+	scanned := 0
+	c = &pubrecdb.Cursor{Height: c.Height, Txid: c.Txid, Before: true}
+	for {
+		bltns, endos, prev, err := f.replayPage(db, c)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, bltn := range bltns {
+			if !f.matchBltn(bltn) {
+				continue
+			}
+			recs = append(recs, keyed{bltn.BlockRef.Height, &ombjson.StreamEvent{
+				Kind:     string(pubrecdb.BulletinAdded),
+				Cursor:   bltnCursor(bltn),
+				Bulletin: bltn,
+			}})
+		}
+		for _, endo := range endos {
+			if !f.matchEndo(db, endo, nil) {
+				continue
+			}
+			recs = append(recs, keyed{endo.BlockRef.Height, &ombjson.StreamEvent{
+				Kind:        string(pubrecdb.EndorsementAdded),
+				Cursor:      endoCursor(endo),
+				Endorsement: endo,
+			}})
+		}
+		scanned += len(bltns) + len(endos)
+		if len(recs) > maxStreamReplay || scanned > maxStreamScan {
+			return nil, false, nil
+		}
+		if prev == "" {
+			break
+		}
+		if c, err = pubrecdb.ParseCursor(prev); err != nil {
+			return nil, false, err
+		}
+	}
+
+	txid := func(ev *ombjson.StreamEvent) string {
+		if ev.Bulletin != nil {
+			return ev.Bulletin.Txid
+		}
+		return ev.Endorsement.Txid
+	}
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].height != recs[j].height {
+			return recs[i].height < recs[j].height
+		}
+		return txid(recs[i].ev) < txid(recs[j].ev)
+	})
+
+	out := []*ombjson.StreamEvent{}
+	for _, rec := range recs {
+		out = append(out, rec.ev)
+	}
+	return out, true, nil
+}
+
+// A streamConn carries messages to a client of the stream.
+type streamConn interface {
+	send(ev *ombjson.StreamEvent) error
+	ping() error
+}
+
+// sseConn streams to an EventSource. The cursor of each message is its id so
+// that the browser resumes from it when it reconnects.
+type sseConn struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s *sseConn) send(ev *ombjson.StreamEvent) error {
+	bytes, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if ev.Cursor != "" {
+		fmt.Fprintf(s.w, "id: %s\n", ev.Cursor)
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", ev.Kind, bytes); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseConn) ping() error {
+	if _, err := fmt.Fprint(s.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// wsConn streams to a WebSocket as one json message per event.
+type wsConn struct {
+	conn *websocket.Conn
+}
+
+func (s *wsConn) send(ev *ombjson.StreamEvent) error {
+	s.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	return s.conn.WriteJSON(ev)
+}
+
+func (s *wsConn) ping() error {
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait))
+}
+
+// subscribeStream returns a subscription to the events the stream is made
+// of.
+func subscribeStream(db pubrecdb.Store) *pubrecdb.Subscription {
+	return db.Subscribe(pubrecdb.KindFilter(
+		pubrecdb.BulletinAdded,
+		pubrecdb.EndorsementAdded,
+		pubrecdb.BlockDisconnected,
+	))
+}
+
+// stream sends the records the filter lets through until the client goes
+// away. The subscription is made before replaying from the cursor so that
+// nothing added in between is missed, and the live records that were
+// replayed are skipped. Records removed while the client was away cannot be
+// replayed.
+func stream(db pubrecdb.Store, sub *pubrecdb.Subscription, conn streamConn, done <-chan struct{}, f *streamFilter, c *pubrecdb.Cursor) {
+	replayed := make(map[string]struct{})
+	if c != nil {
+		evs, ok, err := f.replay(db, c)
+		if err != nil {
+			return
+		}
+		if !ok {
+			conn.send(&ombjson.StreamEvent{Kind: resync})
+			return
+		}
+		for _, ev := range evs {
+			if err := conn.send(ev); err != nil {
+				return
+			}
+			replayed[ev.Kind+ev.Cursor] = struct{}{}
+		}
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := conn.ping(); err != nil {
+				return
+			}
+		case ev, ok := <-sub.Events():
+			if !ok {
+				// The subscription fell behind or the record failed.
+				conn.send(&ombjson.StreamEvent{Kind: resync})
+				return
+			}
+			for _, out := range f.streamEvents(db, ev) {
+				if _, ok := replayed[out.Kind+out.Cursor]; ok {
+					continue
+				}
+				if err := conn.send(out); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// StreamHandler pushes records to clients as they are added to and removed
+// from the record. Clients that ask for a WebSocket upgrade are served over
+// it and everyone else gets Server-Sent Events. The stream can be narrowed
+// with the tag, board, author and lat, lon and r (in km) params, and resumed
+// from the cursor of the last message received.
+func StreamHandler(db pubrecdb.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		db := db.WithContext(request.Context())
+
+		f, c, err := streamParams(request)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		// A client that has been answered is already subscribed.
+		sub := subscribeStream(db)
+		defer sub.Close()
+
+		if websocket.IsWebSocketUpgrade(request) {
+			conn, err := upgrader.Upgrade(w, request, nil)
+			if err != nil {
+				// The upgrader has already replied.
+				return
+			}
+			defer conn.Close()
+
+			// Clients do not send anything, but reading is how a closed
+			// socket is noticed.
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					if _, _, err := conn.NextReader(); err != nil {
+						return
+					}
+				}
+			}()
+			stream(db, sub, &wsConn{conn}, done, f, c)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(200)
+		flusher.Flush()
+
+		stream(db, sub, &sseConn{w, flusher}, request.Context().Done(), f, c)
+	}
+}
@@ -0,0 +1,410 @@
+package jsonapi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/gorilla/websocket"
+	"github.com/soapboxsys/ombudslib/memrecord"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+// The author of every test bulletin signs with the generator point.
+var testPubkey, _ = hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+
+func testAuthor(t *testing.T) string {
+	addr, err := btcutil.NewAddressPubKey(testPubkey, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr.AddressPubKeyHash().String()
+}
+
+// insertBltnBlock adds a block on top of prev that holds a coinbase and a
+// single bulletin by the test author.
+func insertBltnBlock(t *testing.T, db pubrecdb.Store, prev *btcutil.Block, msg string) *btcutil.Block {
+	sigScript, err := txscript.NewScriptBuilder().AddData(make([]byte, 71)).
+		AddData(testPubkey).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outs, err := ombwire.NewBulletin(msg, 123741234, nil).TxOuts(546, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bltnTx := wire.NewMsgTx()
+	bltnTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: wire.ShaHash{}, Index: 1},
+		SignatureScript:  sigScript,
+		Sequence:         0xffffffff,
+	})
+	for _, out := range outs {
+		bltnTx.AddTxOut(out)
+	}
+
+	height := prev.Height() + 1
+	nonce := make([]byte, 8)
+	binary.LittleEndian.PutUint64(nonce, uint64(height))
+	coinbase := wire.NewMsgTx()
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: wire.ShaHash{}, Index: 0xffffffff},
+		SignatureScript:  []byte{0x04, 0x31, 0xdc, 0x00, 0x1b, 0x01, 0x62},
+		Sequence:         0xffffffff,
+	})
+	coinbase.AddTxOut(&wire.TxOut{Value: 5000000000, PkScript: nonce})
+
+	msgBlk := &wire.MsgBlock{}
+	msgBlk.AddTransaction(coinbase)
+	msgBlk.AddTransaction(bltnTx)
+	store := blockchain.BuildMerkleTreeStore(btcutil.NewBlock(msgBlk).Transactions())
+	msgBlk.Header = wire.BlockHeader{
+		PrevBlock:  *prev.Sha(),
+		MerkleRoot: *store[len(store)-1],
+		Timestamp:  time.Unix(123456789+int64(height), 0),
+	}
+
+	blk := btcutil.NewBlock(msgBlk)
+	blk.SetHeight(height)
+	ublk := ombutil.CreateUBlock(blk, nil, &chaincfg.MainNetParams)
+	if err, ok := db.InsertUBlock(ublk); err != nil || !ok {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	return blk
+}
+
+// setupStream serves an empty record.
+func setupStream(t *testing.T) (*memrecord.Record, *httptest.Server) {
+	db, err := memrecord.New(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, httptest.NewServer(Router("/api/", db))
+}
+
+// blockBltn returns the bulletin stored in a block made by insertBltnBlock.
+func blockBltn(t *testing.T, db pubrecdb.Store, blk *btcutil.Block) *ombjson.Bulletin {
+	bltn, err := db.GetBulletin(blk.Transactions()[1].Sha())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bltn
+}
+
+// An sseMsg is a message read off an event stream along with its id.
+type sseMsg struct {
+	id string
+	ev *ombjson.StreamEvent
+}
+
+// sseClient reads the messages of an event stream as they arrive.
+type sseClient struct {
+	resp *http.Response
+	msgs chan sseMsg
+}
+
+func openSSE(t *testing.T, u, lastId string) *sseClient {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastId != "" {
+		req.Header.Set("Last-Event-ID", lastId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/event-stream" {
+		resp.Body.Close()
+		t.Fatalf("GET %s returned %s", u, resp.Status)
+	}
+
+	c := &sseClient{resp: resp, msgs: make(chan sseMsg, 16)}
+	go func() {
+		defer close(c.msgs)
+		scanner := bufio.NewScanner(resp.Body)
+		msg := sseMsg{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				msg.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.ev = &ombjson.StreamEvent{}
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), msg.ev)
+			case line == "" && msg.ev != nil:
+				c.msgs <- msg
+				msg = sseMsg{}
+			}
+		}
+	}()
+	return c
+}
+
+func (c *sseClient) next(t *testing.T) sseMsg {
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			t.Fatal("Stream ended")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("Nothing was streamed")
+	}
+	return sseMsg{}
+}
+
+func (c *sseClient) Close() {
+	c.resp.Body.Close()
+}
+
+// chanConn hands the messages streamed to it to the test.
+type chanConn chan *ombjson.StreamEvent
+
+func (c chanConn) send(ev *ombjson.StreamEvent) error {
+	c <- ev
+	return nil
+}
+
+func (c chanConn) ping() error {
+	return nil
+}
+
+func TestStreamFilter(t *testing.T) {
+	db, err := memrecord.New(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk := insertBltnBlock(t, db, peg.GetStartBlock(), "Lambs in the field #lambs")
+	bltn := blockBltn(t, db, blk)
+
+	tests := []struct {
+		query string
+		pass  bool
+	}{
+		{"", true},
+		{"tag=lambs", true},
+		{"tag=%23LAMBS", true},
+		{"board=farm", false},
+		{"author=" + testAuthor(t), true},
+		{"author=1BoatSLRHtKNngkdXEeobR76b53LETtpyT", false},
+		// The bulletin has no location.
+		{"lat=0&lon=0&r=10", false},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/api/stream?"+test.query, nil)
+		f, c, err := streamParams(request)
+		if err != nil || c != nil {
+			t.Fatalf("%s: %v", test.query, err)
+		}
+
+		added := f.streamEvents(db, &pubrecdb.Event{Kind: pubrecdb.BulletinAdded, Bulletin: bltn})
+		removed := f.streamEvents(db, &pubrecdb.Event{
+			Kind:      pubrecdb.BlockDisconnected,
+			Bulletins: []*ombjson.Bulletin{bltn},
+		})
+		if !test.pass {
+			if len(added) != 0 || len(removed) != 0 {
+				t.Fatalf("%s: %s", test.query, spw([][]*ombjson.StreamEvent{added, removed}))
+			}
+			continue
+		}
+		if len(added) != 1 || added[0].Kind != string(pubrecdb.BulletinAdded) ||
+			added[0].Cursor != bltnCursor(bltn) {
+			t.Fatalf("%s: %s", test.query, spw(added))
+		}
+		if len(removed) != 1 || removed[0].Kind != bulletinRemoved {
+			t.Fatalf("%s: %s", test.query, spw(removed))
+		}
+	}
+
+	for _, query := range []string{"tag=lambs&board=farm", "lat=1", "author=nope", "cursor=nope"} {
+		request := httptest.NewRequest("GET", "/api/stream?"+query, nil)
+		if _, _, err := streamParams(request); err == nil {
+			t.Fatalf("%s was accepted", query)
+		}
+	}
+}
+
+func TestStreamLive(t *testing.T) {
+	db, srv := setupStream(t)
+	defer srv.Close()
+
+	client := openSSE(t, srv.URL+"/api/stream?tag=lambs", "")
+	defer client.Close()
+
+	farm := insertBltnBlock(t, db, peg.GetStartBlock(), "Found the sheep #farm")
+	lambs := insertBltnBlock(t, db, farm, "Lambs in the field #lambs")
+	bltn := blockBltn(t, db, lambs)
+
+	msg := client.next(t)
+	if msg.ev.Kind != string(pubrecdb.BulletinAdded) || msg.ev.Bulletin.Txid != bltn.Txid ||
+		msg.id != bltnCursor(bltn) || msg.ev.Cursor != msg.id {
+		t.Fatal(spw(msg))
+	}
+
+	if err, ok := db.DeleteBlockTip(lambs.Sha()); err != nil || !ok {
+		t.Fatal(err)
+	}
+	msg = client.next(t)
+	if msg.ev.Kind != bulletinRemoved || msg.ev.Bulletin.Txid != bltn.Txid {
+		t.Fatal(spw(msg))
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	db, srv := setupStream(t)
+	defer srv.Close()
+
+	a := insertBltnBlock(t, db, peg.GetStartBlock(), "First lambs #lambs")
+	b := insertBltnBlock(t, db, a, "Found the sheep #farm")
+	c := insertBltnBlock(t, db, b, "More lambs #lambs")
+	cursor := bltnCursor(blockBltn(t, db, a))
+	want := blockBltn(t, db, c).Txid
+
+	// EventSource resumes with the header and others with the param.
+	byHeader := openSSE(t, srv.URL+"/api/stream?tag=lambs", cursor)
+	defer byHeader.Close()
+	byParam := openSSE(t, srv.URL+"/api/stream?tag=lambs&cursor="+url.QueryEscape(cursor), "")
+	defer byParam.Close()
+
+	for _, client := range []*sseClient{byHeader, byParam} {
+		msg := client.next(t)
+		if msg.ev.Kind != string(pubrecdb.BulletinAdded) || msg.ev.Bulletin.Txid != want {
+			t.Fatal(spw(msg))
+		}
+	}
+
+	d := insertBltnBlock(t, db, c, "Even more lambs #lambs")
+	want = blockBltn(t, db, d).Txid
+	for _, client := range []*sseClient{byHeader, byParam} {
+		msg := client.next(t)
+		if msg.ev.Bulletin == nil || msg.ev.Bulletin.Txid != want {
+			t.Fatal(spw(msg))
+		}
+	}
+}
+
+func TestStreamReplayDedup(t *testing.T) {
+	db, err := memrecord.New(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := insertBltnBlock(t, db, peg.GetStartBlock(), "First lambs #lambs")
+	c, err := pubrecdb.ParseCursor(bltnCursor(blockBltn(t, db, a)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b is both waiting on the subscription and found by the replay.
+	sub := subscribeStream(db)
+	defer sub.Close()
+	b := insertBltnBlock(t, db, a, "More lambs #lambs")
+
+	conn := make(chanConn, 16)
+	done := make(chan struct{})
+	defer close(done)
+	go stream(db, sub, conn, done, &streamFilter{}, c)
+
+	next := func() *ombjson.StreamEvent {
+		select {
+		case ev := <-conn:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("Nothing was streamed")
+		}
+		return nil
+	}
+
+	if ev := next(); ev.Bulletin == nil || ev.Bulletin.Txid != blockBltn(t, db, b).Txid {
+		t.Fatal(spw(ev))
+	}
+	d := insertBltnBlock(t, db, b, "Even more lambs #lambs")
+	if ev := next(); ev.Bulletin == nil || ev.Bulletin.Txid != blockBltn(t, db, d).Txid {
+		t.Fatal(spw(ev))
+	}
+}
+
+func TestStreamResync(t *testing.T) {
+	defer func(n, m int) { maxStreamReplay, maxStreamScan = n, m }(maxStreamReplay, maxStreamScan)
+	maxStreamReplay, maxStreamScan = 1, 1
+
+	db, srv := setupStream(t)
+	defer srv.Close()
+
+	a := insertBltnBlock(t, db, peg.GetStartBlock(), "First lambs #lambs")
+	b := insertBltnBlock(t, db, a, "Found the sheep #farm")
+	c := insertBltnBlock(t, db, b, "Sheared the sheep #farm")
+	d := insertBltnBlock(t, db, c, "More lambs #lambs")
+	cursor := bltnCursor(blockBltn(t, db, a))
+
+	// Only the tag's records are read to replay it.
+	client := openSSE(t, srv.URL+"/api/stream?tag=lambs", cursor)
+	msg := client.next(t)
+	client.Close()
+	if msg.ev.Bulletin == nil || msg.ev.Bulletin.Txid != blockBltn(t, db, d).Txid {
+		t.Fatal(spw(msg))
+	}
+
+	// Every record of the author is read and there are too many of them.
+	client = openSSE(t, srv.URL+"/api/stream?author="+testAuthor(t), cursor)
+	msg = client.next(t)
+	client.Close()
+	if msg.ev.Kind != resync {
+		t.Fatal(spw(msg))
+	}
+
+	maxStreamScan = 5000
+	insertBltnBlock(t, db, d, "Even more lambs #lambs")
+	client = openSSE(t, srv.URL+"/api/stream?tag=lambs", cursor)
+	defer client.Close()
+	if msg := client.next(t); msg.ev.Kind != resync {
+		t.Fatal(spw(msg))
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	db, srv := setupStream(t)
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/stream?tag=lambs"
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	blk := insertBltnBlock(t, db, peg.GetStartBlock(), "Lambs in the field #lambs")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var ev ombjson.StreamEvent
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Kind != string(pubrecdb.BulletinAdded) || ev.Bulletin.Txid != blockBltn(t, db, blk).Txid {
+		t.Fatal(spw(ev))
+	}
+}
+
+func spw(t interface{}) string {
+	return spew.Sdump(t)
+}
@@ -0,0 +1,1429 @@
+package memrecord
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+// keyBefore is true when the record at a comes before the one at b in the
+// order lists are returned in.
+func keyBefore(a, b ombstore.PageKey) bool {
+	return a.Height > b.Height || (a.Height == b.Height && a.Txid > b.Txid)
+}
+
+// walkPage does what a pagedStmt does for keys that are in memory. It returns
+// up to limit+1 of the keys that follow the cursor in the direction it points
+// in. A nil cursor starts at the front of the list.
+func walkPage(keys []ombstore.PageKey, c *ombstore.Cursor, limit int) []ombstore.PageKey {
+	if c == nil {
+		c = ombstore.FirstPage
+	}
+	sort.Slice(keys, func(i, j int) bool { return keyBefore(keys[i], keys[j]) })
+
+	at := ombstore.PageKey{Height: c.Height, Txid: c.Txid}
+	walked := []ombstore.PageKey{}
+	for i := range keys {
+		k := keys[i]
+		if c.Before {
+			k = keys[len(keys)-1-i]
+		}
+		if c.Before && keyBefore(k, at) || !c.Before && keyBefore(at, k) {
+			walked = append(walked, k)
+		}
+		if len(walked) > limit {
+			break
+		}
+	}
+	return walked
+}
+
+// inSpan is true when k falls between upper and lower, inclusive, as
+// returned by ombstore.HeldSpan.
+func inSpan(k, upper, lower ombstore.PageKey) bool {
+	return !keyBefore(k, upper) && !keyBefore(lower, k)
+}
+
+// topHeld returns the indexes of the first limit of n ranked items that are
+// not withheld and reports if any withheld ones came before the list was
+// full, like the sql record does. A negative limit takes every item.
+func topHeld(n, limit int, held func(i int) bool) ([]int, bool) {
+	keep := []int{}
+	withheld := false
+	for i := 0; i < n && (limit < 0 || len(keep) < limit); i++ {
+		if held(i) {
+			withheld = true
+			continue
+		}
+		keep = append(keep, i)
+	}
+	return keep, withheld
+}
+
+// sameTag is true when both are the same tag ignoring case.
+func sameTag(a, b string) bool {
+	return strings.ToLower(a) == strings.ToLower(b)
+}
+
+func (b *memBltn) hasTag(tag string) bool {
+	for _, t := range b.tags {
+		if sameTag(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (blk *memBlock) ref() *ombjson.BlockRef {
+	return &ombjson.BlockRef{
+		Hash:      blk.hash,
+		Height:    blk.height,
+		Timestamp: blk.ts,
+	}
+}
+
+func (db *Record) bltnKey(b *memBltn) ombstore.PageKey {
+	return ombstore.PageKey{Height: db.blocks[b.block].height, Txid: b.txid, Block: b.block}
+}
+
+func (db *Record) endoKey(e *memEndo) ombstore.PageKey {
+	return ombstore.PageKey{Height: db.blocks[e.block].height, Txid: e.txid, Block: e.block}
+}
+
+// bltnJSON fills out the bulletin the way a row of bltnSql does.
+func (db *Record) bltnJSON(b *memBltn) *ombjson.Bulletin {
+	endorsers := make(map[string]bool)
+	for _, e := range db.bids[b.txid] {
+		endorsers[e.author] = true
+	}
+
+	bltn := &ombjson.Bulletin{
+		Txid:      b.txid,
+		Author:    b.author,
+		Message:   b.msg,
+		Timestamp: b.ts,
+		BlockRef:  db.blocks[b.block].ref(),
+		NumEndos:  int32(len(endorsers)),
+	}
+	if db.rawEndoCounts {
+		bltn.NumRawEndos = int32(len(db.bids[b.txid]))
+	}
+	if b.loc != nil {
+		loc := *b.loc
+		bltn.Location = &loc
+	}
+	return bltn
+}
+
+func (db *Record) endoJSON(e *memEndo) *ombjson.Endorsement {
+	_, exists := db.bltns[e.bid]
+	return &ombjson.Endorsement{
+		Txid:       e.txid,
+		Author:     e.author,
+		Bid:        e.bid,
+		Timestamp:  e.ts,
+		BltnExists: exists,
+		NonRecord:  !exists && db.nonRecord[e.txid],
+		BlockRef:   db.blocks[e.block].ref(),
+	}
+}
+
+// span returns the hashes that a list of bulletins or endorsements starts and
+// stops at when it is not cut short.
+func (db *Record) span() (string, string) {
+	var start, stop string = "", peg.GetStartBlock().Sha().String()
+	if tip := db.tip(); tip != nil {
+		start = tip.hash
+	}
+	return start, stop
+}
+
+// bltnPage returns a page of the bulletins that match starting from the
+// cursor. Withheld bulletins are left out before the page is cut and reported
+// when they fall within the part of the list the page covers.
+func (db *Record) bltnPage(c *ombstore.Cursor, limit int, match func(*memBltn) bool) *ombjson.BltnPage {
+	limit = ombstore.CapLimit(limit, db.maxQueryLimit)
+
+	keys, held := []ombstore.PageKey{}, []ombstore.PageKey{}
+	for _, b := range db.bltns {
+		if !match(b) {
+			continue
+		}
+		if db.bltnWithheld(b) {
+			held = append(held, db.bltnKey(b))
+			continue
+		}
+		keys = append(keys, db.bltnKey(b))
+	}
+	keys, more := ombstore.CutPage(c, walkPage(keys, c, limit), limit)
+
+	page := &ombjson.BltnPage{
+		Bulletins: []*ombjson.Bulletin{},
+	}
+	for _, k := range keys {
+		page.Bulletins = append(page.Bulletins, db.bltnJSON(db.bltns[k.Txid]))
+	}
+	upper, lower := ombstore.HeldSpan(c, keys, more)
+	for _, k := range held {
+		if inSpan(k, upper, lower) {
+			page.Withheld = true
+		}
+	}
+
+	start, stop := db.span()
+	page.Start, page.Stop, page.Cursors = ombstore.PageSpan(c, keys, more, start, stop)
+	return page
+}
+
+// recordPage is a page of bulletins and endorsements along with the keys
+// that the cursors around it are made from.
+type recordPage struct {
+	bltns    []*ombjson.Bulletin
+	endos    []*ombjson.Endorsement
+	keys     []ombstore.PageKey
+	more     bool
+	withheld bool
+}
+
+// records returns a page of the bulletins and endorsements that match
+// starting from the cursor. Like the sql record it reports the withheld
+// records that fall between the first and last records of the page.
+func (db *Record) records(c *ombstore.Cursor, limit int, bltnMatch func(*memBltn) bool,
+	endoMatch func(*memEndo) bool) *recordPage {
+
+	limit = ombstore.CapLimit(limit, db.maxQueryLimit)
+
+	keys, held := []ombstore.PageKey{}, []ombstore.PageKey{}
+	for _, b := range db.bltns {
+		if !bltnMatch(b) {
+			continue
+		}
+		if db.bltnWithheld(b) {
+			held = append(held, db.bltnKey(b))
+			continue
+		}
+		keys = append(keys, db.bltnKey(b))
+	}
+	for _, e := range db.endos {
+		if !endoMatch(e) {
+			continue
+		}
+		if db.endoWithheld(e) {
+			held = append(held, db.endoKey(e))
+			continue
+		}
+		keys = append(keys, db.endoKey(e))
+	}
+
+	page := &recordPage{
+		bltns: []*ombjson.Bulletin{},
+		endos: []*ombjson.Endorsement{},
+	}
+	page.keys, page.more = ombstore.CutPage(c, walkPage(keys, c, limit), limit)
+	if len(page.keys) == 0 {
+		return page
+	}
+
+	for _, k := range page.keys {
+		if b, ok := db.bltns[k.Txid]; ok && bltnMatch(b) {
+			page.bltns = append(page.bltns, db.bltnJSON(b))
+			continue
+		}
+		page.endos = append(page.endos, db.endoJSON(db.endos[k.Txid]))
+	}
+	first, last := page.keys[0], page.keys[len(page.keys)-1]
+	for _, k := range held {
+		if inSpan(k, first, last) {
+			page.withheld = true
+		}
+	}
+	return page
+}
+
+// GetBulletin works like pubrecdb.PublicRecord.GetBulletin.
+func (db *Record) GetBulletin(txid *wire.ShaHash, opts ...ombstore.RecordOption) (*ombjson.Bulletin, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	b, ok := db.bltns[txid.String()]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if db.bltnWithheld(b) {
+		return nil, ombstore.ErrWithheld
+	}
+
+	endos := []*memEndo{}
+	for _, e := range db.bids[b.txid] {
+		if !db.endoWithheld(e) {
+			endos = append(endos, e)
+		}
+	}
+	sort.Slice(endos, func(i, j int) bool {
+		return keyBefore(db.endoKey(endos[j]), db.endoKey(endos[i]))
+	})
+
+	// Like the sql record the endorsements listed with a bulletin do not
+	// set BltnExists.
+	bltn := db.bltnJSON(b)
+	bltn.Endorsements = []*ombjson.Endorsement{}
+	for _, e := range endos {
+		endo := db.endoJSON(e)
+		endo.BltnExists = false
+		bltn.Endorsements = append(bltn.Endorsements, endo)
+	}
+
+	var err error
+	bltn.Proof, err = ombstore.OptProof(opts, txid, db.proof)
+	if err != nil {
+		return nil, err
+	}
+	return bltn, nil
+}
+
+// GetEndorsement works like pubrecdb.PublicRecord.GetEndorsement.
+func (db *Record) GetEndorsement(txid *wire.ShaHash, opts ...ombstore.RecordOption) (*ombjson.Endorsement, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	e, ok := db.endos[txid.String()]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if db.endoWithheld(e) {
+		return nil, ombstore.ErrWithheld
+	}
+
+	endo := db.endoJSON(e)
+	var err error
+	endo.Proof, err = ombstore.OptProof(opts, txid, db.proof)
+	if err != nil {
+		return nil, err
+	}
+	return endo, nil
+}
+
+// blockHead sums up the block along with everything stored in it.
+func (db *Record) blockHead(blk *memBlock) *ombjson.Block {
+	head := &ombjson.BlockHead{
+		Hash:      blk.hash,
+		PrevHash:  blk.prevhash,
+		Height:    blk.height,
+		Timestamp: blk.ts,
+	}
+	for _, b := range db.bltns {
+		if b.block == blk.hash {
+			head.NumBltns++
+		}
+	}
+	for _, e := range db.endos {
+		if e.block == blk.hash {
+			head.NumEndos++
+		}
+	}
+	return &ombjson.Block{Head: head}
+}
+
+// GetBlock works like pubrecdb.PublicRecord.GetBlock.
+func (db *Record) GetBlock(hash *wire.ShaHash) (*ombjson.Block, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	blk, ok := db.blocks[hash.String()]
+	if !ok {
+		return &ombjson.Block{}, sql.ErrNoRows
+	}
+	block := db.blockHead(blk)
+
+	bltns := []*memBltn{}
+	for _, b := range db.bltns {
+		if b.block == blk.hash {
+			bltns = append(bltns, b)
+		}
+	}
+	sort.Slice(bltns, func(i, j int) bool {
+		if bltns[i].ts != bltns[j].ts {
+			return bltns[i].ts > bltns[j].ts
+		}
+		return bltns[i].txid > bltns[j].txid
+	})
+
+	endos := []*memEndo{}
+	for _, e := range db.endos {
+		if e.block == blk.hash {
+			endos = append(endos, e)
+		}
+	}
+	sort.Slice(endos, func(i, j int) bool { return endos[i].txid > endos[j].txid })
+
+	block.Bulletins = []*ombjson.Bulletin{}
+	for _, b := range bltns {
+		if db.bltnWithheld(b) {
+			block.Withheld = true
+			continue
+		}
+		block.Bulletins = append(block.Bulletins, db.bltnJSON(b))
+	}
+
+	block.Endorsements = []*ombjson.Endorsement{}
+	for _, e := range endos {
+		if db.endoWithheld(e) {
+			block.Withheld = true
+			continue
+		}
+		block.Endorsements = append(block.Endorsements, db.endoJSON(e))
+	}
+	return block, nil
+}
+
+// GetBlockTip works like pubrecdb.PublicRecord.GetBlockTip.
+func (db *Record) GetBlockTip() (*ombjson.Block, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	tip := db.tip()
+	if tip == nil {
+		return nil, sql.ErrNoRows
+	}
+	return db.blockHead(tip), nil
+}
+
+// FindHeight works like pubrecdb.PublicRecord.FindHeight.
+func (db *Record) FindHeight(hash *wire.ShaHash) (int32, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.findHeight(hash)
+}
+
+func (db *Record) findHeight(hash *wire.ShaHash) (int32, error) {
+	firstHash := peg.GetStartBlock().MsgBlock().Header.PrevBlock.Bytes()
+	if bytes.Equal(hash.Bytes(), firstHash) {
+		return int32(peg.StartHeight - 1), nil
+	}
+
+	blk, ok := db.blocks[hash.String()]
+	if !ok {
+		return -1, sql.ErrNoRows
+	}
+	return blk.height, nil
+}
+
+// GetProof works like pubrecdb.PublicRecord.GetProof.
+func (db *Record) GetProof(txid *wire.ShaHash) (*ombjson.MerkleProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.proof(txid)
+}
+
+// proof builds the proof of txid. The caller must hold the lock.
+func (db *Record) proof(txid *wire.ShaHash) (*ombjson.MerkleProof, error) {
+	p, ok := db.proofs[txid.String()]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	var header bytes.Buffer
+	if err := db.blocks[p.block].header.Serialize(&header); err != nil {
+		return nil, err
+	}
+
+	proof := &ombjson.MerkleProof{
+		Header: hex.EncodeToString(header.Bytes()),
+		Index:  p.idx,
+		Branch: []string{},
+	}
+	for _, h := range p.branch {
+		proof.Branch = append(proof.Branch, h.String())
+	}
+	return proof, nil
+}
+
+// GetLatestPage works like pubrecdb.PublicRecord.GetLatestPage.
+func (db *Record) GetLatestPage(c *ombstore.Cursor, limit int) (*ombjson.Page, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	tip := db.tip()
+	if tip == nil {
+		return nil, sql.ErrNoRows
+	}
+	pegBlk := peg.GetStartBlock()
+
+	return db.queryRange(tip.height, pegBlk.Height()-1, tip.hash, pegBlk.Sha().String(), c, limit), nil
+}
+
+// QueryRange works like pubrecdb.PublicRecord.QueryRange.
+func (db *Record) QueryRange(start, stop *wire.ShaHash, c *ombstore.Cursor, limit int) (*ombjson.Page, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	startH, err := db.findHeight(start)
+	if err != nil {
+		return nil, err
+	}
+	stopH, err := db.findHeight(stop)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.queryRange(startH, stopH, start.String(), stop.String(), c, limit), nil
+}
+
+func (db *Record) queryRange(startH, stopH int32, start, stop string, c *ombstore.Cursor, limit int) *ombjson.Page {
+	inRange := func(blk string) bool {
+		h := db.blocks[blk].height
+		return h <= startH && h > stopH
+	}
+	recs := db.records(c, limit,
+		func(b *memBltn) bool { return inRange(b.block) },
+		func(e *memEndo) bool { return inRange(e.block) })
+
+	page := &ombjson.Page{
+		Bulletins:    recs.bltns,
+		Endorsements: recs.endos,
+		Withheld:     recs.withheld,
+	}
+	page.Start, page.Stop, page.Cursors = ombstore.PageSpan(c, recs.keys, recs.more, start, stop)
+	return page
+}
+
+// GetTag works like pubrecdb.PublicRecord.GetTag.
+func (db *Record) GetTag(tag ombutil.Tag, c *ombstore.Cursor, limit int) (*ombjson.BltnPage, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.bltnPage(c, limit, func(b *memBltn) bool {
+		return b.hasTag(string(tag))
+	}), nil
+}
+
+// GetBestTags works like pubrecdb.PublicRecord.GetBestTags.
+func (db *Record) GetBestTags() ([]*ombjson.Tag, bool, error) {
+	return db.GetTrendingTags(ombstore.BestTagsHalfLife, 50)
+}
+
+// GetAuthor works like pubrecdb.PublicRecord.GetAuthor.
+func (db *Record) GetAuthor(author btcutil.Address, c *ombstore.Cursor, limit int) (*ombjson.AuthorResp, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	addr := author.String()
+	if db.isBlacklisted(ombstore.BlacklistAuthor, addr) {
+		return nil, ombstore.ErrWithheld
+	}
+
+	recs := db.records(c, limit,
+		func(b *memBltn) bool { return b.author == addr },
+		func(e *memEndo) bool { return e.author == addr })
+
+	auth := &ombjson.AuthorResp{
+		Bulletins:    recs.bltns,
+		Endorsements: recs.endos,
+		Withheld:     recs.withheld,
+	}
+	_, _, auth.Cursors = ombstore.PageSpan(c, recs.keys, recs.more, "", "")
+
+	if a, ok := db.authors()[addr]; ok {
+		auth.Summary = a.summary
+	}
+	return auth, nil
+}
+
+// memAuthor is an author's summary along with the heights it is sorted on.
+type memAuthor struct {
+	summary       *ombjson.AuthorSummary
+	firstH, lastH int32
+}
+
+// key returns the value the author is sorted on like scanAuthorSummary.
+func (a *memAuthor) key(sort string) int32 {
+	return map[string]int32{
+		ombstore.SortPosts:      a.summary.NumBltns,
+		ombstore.SortEndorsed:   a.summary.NumRecvd,
+		ombstore.SortFirstSeen:  a.firstH,
+		ombstore.SortLastActive: a.lastH,
+	}[sort]
+}
+
+// authors sums up everything each author has sent to the record the way
+// authorsSql does.
+func (db *Record) authors() map[string]*memAuthor {
+	all := make(map[string]*memAuthor)
+	seen := func(addr, block string) *memAuthor {
+		blk := db.blocks[block]
+		a, ok := all[addr]
+		if !ok {
+			a = &memAuthor{
+				summary: &ombjson.AuthorSummary{
+					Address:    addr,
+					FirstBlkTs: blk.ts,
+					LastBlkTs:  blk.ts,
+					Reputation: db.reputation[addr],
+				},
+				firstH: blk.height,
+				lastH:  blk.height,
+			}
+			all[addr] = a
+		}
+		if blk.height < a.firstH {
+			a.firstH = blk.height
+		}
+		if blk.height > a.lastH {
+			a.lastH = blk.height
+		}
+		if blk.ts < a.summary.FirstBlkTs {
+			a.summary.FirstBlkTs = blk.ts
+		}
+		if blk.ts > a.summary.LastBlkTs {
+			a.summary.LastBlkTs = blk.ts
+		}
+		return a
+	}
+
+	for _, b := range db.bltns {
+		if db.bltnWithheld(b) {
+			continue
+		}
+		endorsers := make(map[string]bool)
+		for _, e := range db.bids[b.txid] {
+			if !db.endoWithheld(e) {
+				endorsers[e.author] = true
+			}
+		}
+		a := seen(b.author, b.block)
+		a.summary.NumBltns++
+		a.summary.NumRecvd += int32(len(endorsers))
+	}
+	for _, e := range db.endos {
+		if !db.endoWithheld(e) {
+			seen(e.author, e.block).summary.NumEndos++
+		}
+	}
+	return all
+}
+
+// GetAllAuthors works like pubrecdb.PublicRecord.GetAllAuthors.
+func (db *Record) GetAllAuthors(sort string, f ombstore.AuthorFilter, c *ombstore.Cursor, limit int) (*ombjson.AuthorPage, error) {
+	if !ombstore.IsSort(sort) {
+		return nil, ombstore.ErrBadSort
+	}
+
+	var since int64
+	if !f.ActiveSince.IsZero() {
+		since = f.ActiveSince.Unix()
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	limit = ombstore.CapLimit(limit, db.maxQueryLimit)
+	all := db.authors()
+	keys := []ombstore.PageKey{}
+	for addr, a := range all {
+		if int(a.summary.NumBltns) < f.MinBltns || a.summary.LastBlkTs < since {
+			continue
+		}
+		keys = append(keys, ombstore.PageKey{Height: a.key(sort), Txid: addr})
+	}
+	keys, more := ombstore.CutPage(c, walkPage(keys, c, limit), limit)
+
+	page := &ombjson.AuthorPage{
+		Sort:    sort,
+		Authors: []*ombjson.AuthorSummary{},
+	}
+	for _, k := range keys {
+		page.Authors = append(page.Authors, all[k.Txid].summary)
+	}
+	_, _, page.Cursors = ombstore.PageSpan(c, keys, more, "", "")
+
+	return page, nil
+}
+
+// GetTopAuthors works like pubrecdb.PublicRecord.GetTopAuthors.
+func (db *Record) GetTopAuthors(limit int) ([]*ombjson.AuthorSummary, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	withheld := false
+	for _, b := range db.bltns {
+		withheld = withheld || db.listed(ombstore.BlacklistAuthor, b.author)
+	}
+	for _, e := range db.endos {
+		withheld = withheld || db.listed(ombstore.BlacklistAuthor, e.author)
+	}
+
+	authors := []*ombjson.AuthorSummary{}
+	for _, a := range db.authors() {
+		authors = append(authors, a.summary)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		a, b := authors[i], authors[j]
+		if a.Reputation != b.Reputation {
+			return a.Reputation > b.Reputation
+		}
+		return a.Address < b.Address
+	})
+
+	if limit = ombstore.CapLimit(limit, db.maxQueryLimit); len(authors) > limit {
+		authors = authors[:limit]
+	}
+	return authors, withheld, nil
+}
+
+// GetOrphanEndorsements works like pubrecdb.PublicRecord.GetOrphanEndorsements.
+func (db *Record) GetOrphanEndorsements(c *ombstore.Cursor, limit int) (*ombjson.EndoPage, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	limit = ombstore.CapLimit(limit, db.maxQueryLimit)
+	keys, held := []ombstore.PageKey{}, []ombstore.PageKey{}
+	for _, e := range db.endos {
+		if _, ok := db.bltns[e.bid]; ok {
+			continue
+		}
+		if db.endoWithheld(e) {
+			held = append(held, db.endoKey(e))
+			continue
+		}
+		keys = append(keys, db.endoKey(e))
+	}
+	keys, more := ombstore.CutPage(c, walkPage(keys, c, limit), limit)
+
+	page := &ombjson.EndoPage{
+		Endorsements: []*ombjson.Endorsement{},
+	}
+	for _, k := range keys {
+		page.Endorsements = append(page.Endorsements, db.endoJSON(db.endos[k.Txid]))
+	}
+	upper, lower := ombstore.HeldSpan(c, keys, more)
+	for _, k := range held {
+		if inSpan(k, upper, lower) {
+			page.Withheld = true
+		}
+	}
+
+	start, stop := db.span()
+	page.Start, page.Stop, page.Cursors = ombstore.PageSpan(c, keys, more, start, stop)
+	return page, nil
+}
+
+// inBoxes is true when the location is inside the latitudes of a and the
+// longitudes of either a or b like inBoxSql.
+func inBoxes(a, b ombstore.GeoBox, loc *ombjson.Location) bool {
+	if loc == nil || loc.Lat < a.MinLat || loc.Lat > a.MaxLat {
+		return false
+	}
+	return loc.Lon >= a.MinLon && loc.Lon <= a.MaxLon ||
+		loc.Lon >= b.MinLon && loc.Lon <= b.MaxLon
+}
+
+// nearby returns a test for bulletins within r kilometers of lat, lon.
+func nearby(lat, lon, r float64) func(*memBltn) bool {
+	a, b := ombstore.BoundingBox(lat, lon, r*1000)
+	return func(bltn *memBltn) bool {
+		return inBoxes(a, b, bltn.loc) &&
+			ombstore.Distance(lat, lon, bltn.loc.Lat, bltn.loc.Lon) < r*1000
+	}
+}
+
+// GetNearbyBltns works like pubrecdb.PublicRecord.GetNearbyBltns.
+func (db *Record) GetNearbyBltns(lat, lon, r float64, c *ombstore.Cursor, limit int) (*ombjson.BltnPage, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.bltnPage(c, limit, nearby(lat, lon, r)), nil
+}
+
+// GetNearbyBltnsByDist works like pubrecdb.PublicRecord.GetNearbyBltnsByDist.
+func (db *Record) GetNearbyBltnsByDist(lat, lon, r float64, limit int) ([]*ombjson.Bulletin, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	match := nearby(lat, lon, r)
+	found := []*memBltn{}
+	for _, b := range db.bltns {
+		if match(b) {
+			found = append(found, b)
+		}
+	}
+	dist := func(b *memBltn) float64 {
+		return ombstore.Distance(lat, lon, b.loc.Lat, b.loc.Lon)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		di, dj := dist(found[i]), dist(found[j])
+		if di != dj {
+			return di < dj
+		}
+		return keyBefore(db.bltnKey(found[i]), db.bltnKey(found[j]))
+	})
+
+	keep, withheld := topHeld(len(found), ombstore.CapLimit(limit, db.maxQueryLimit), func(i int) bool {
+		return db.bltnWithheld(found[i])
+	})
+	bltns := []*ombjson.Bulletin{}
+	for _, i := range keep {
+		bltns = append(bltns, db.bltnJSON(found[i]))
+	}
+	return bltns, withheld, nil
+}
+
+// GetBulletinsInBBox works like pubrecdb.PublicRecord.GetBulletinsInBBox.
+func (db *Record) GetBulletinsInBBox(minLat, minLon, maxLat, maxLon float64, c *ombstore.Cursor, limit int) (*ombjson.BltnPage, error) {
+	if minLat > maxLat {
+		return nil, ombstore.ErrBadBBox
+	}
+	a, b := ombstore.NewGeoBox(minLat, minLon, maxLat, maxLon)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.bltnPage(c, limit, func(bltn *memBltn) bool {
+		return inBoxes(a, b, bltn.loc)
+	}), nil
+}
+
+// GetBulletinsInPolygon works like pubrecdb.PublicRecord.GetBulletinsInPolygon.
+func (db *Record) GetBulletinsInPolygon(g *ombjson.Geometry, c *ombstore.Cursor, limit int) (*ombjson.BltnPage, error) {
+	polys, err := ombstore.NewPolygons(g)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.bltnPage(c, limit, func(b *memBltn) bool {
+		if b.loc == nil {
+			return false
+		}
+		for _, poly := range polys {
+			if poly.Contains(b.loc.Lon, b.loc.Lat) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// GetMostEndorsedBltns works like pubrecdb.PublicRecord.GetMostEndorsedBltns.
+func (db *Record) GetMostEndorsedBltns(lim int) ([]*ombjson.Bulletin, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	bltns := []*ombjson.Bulletin{}
+	held := make(map[string]bool)
+	for _, b := range db.bltns {
+		if len(db.bids[b.txid]) > 0 {
+			bltns = append(bltns, db.bltnJSON(b))
+			held[b.txid] = db.bltnWithheld(b)
+		}
+	}
+	sort.Slice(bltns, func(i, j int) bool {
+		a, b := bltns[i], bltns[j]
+		if a.NumEndos != b.NumEndos {
+			return a.NumEndos > b.NumEndos
+		}
+		return keyBefore(ombstore.PageKey{Height: a.BlockRef.Height, Txid: a.Txid},
+			ombstore.PageKey{Height: b.BlockRef.Height, Txid: b.Txid})
+	})
+
+	keep, withheld := topHeld(len(bltns), lim, func(i int) bool {
+		return held[bltns[i].Txid]
+	})
+	top := []*ombjson.Bulletin{}
+	for _, i := range keep {
+		top = append(top, bltns[i])
+	}
+	return top, withheld, nil
+}
+
+// memBoard is a board's summary along with what it is sorted and named by.
+type memBoard struct {
+	summary *ombjson.BoardSummary
+	value   string
+	lastH   int32
+	first   *memBltn
+}
+
+// boards sums up every board in the record the way boardSql does. The boards
+// are keyed by their tag in lower case.
+func (db *Record) boards() map[string]*memBoard {
+	all := make(map[string]*memBoard)
+	for _, b := range db.bltns {
+		if db.bltnWithheld(b) {
+			continue
+		}
+		blk := db.blocks[b.block]
+		counted := make(map[string]bool)
+		for _, tag := range b.tags {
+			key := strings.ToLower(tag)
+			board, ok := all[key]
+			if !ok {
+				board = &memBoard{
+					summary: &ombjson.BoardSummary{
+						CreatedAt:  blk.ts,
+						LastActive: blk.ts,
+					},
+					value: tag,
+					lastH: blk.height,
+					first: b,
+				}
+				all[key] = board
+			}
+			if tag < board.value {
+				board.value = tag
+			}
+			if counted[key] {
+				continue
+			}
+			counted[key] = true
+
+			board.summary.NumBltns++
+			if blk.ts < board.summary.CreatedAt {
+				board.summary.CreatedAt = blk.ts
+			}
+			if blk.ts > board.summary.LastActive {
+				board.summary.LastActive = blk.ts
+			}
+			if blk.height > board.lastH {
+				board.lastH = blk.height
+			}
+			if keyBefore(db.bltnKey(board.first), db.bltnKey(b)) {
+				board.first = b
+			}
+		}
+	}
+
+	for _, board := range all {
+		board.summary.Name = strings.TrimPrefix(board.value, "#")
+		board.summary.CreatedBy = board.first.author
+	}
+	return all
+}
+
+// GetAllBoards works like pubrecdb.PublicRecord.GetAllBoards.
+func (db *Record) GetAllBoards() ([]*ombjson.BoardSummary, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	all := []*memBoard{}
+	for _, board := range db.boards() {
+		all = append(all, board)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if a.summary.NumBltns != b.summary.NumBltns {
+			return a.summary.NumBltns > b.summary.NumBltns
+		}
+		if a.lastH != b.lastH {
+			return a.lastH > b.lastH
+		}
+		return a.value < b.value
+	})
+
+	boards := []*ombjson.BoardSummary{}
+	for _, board := range all {
+		boards = append(boards, board.summary)
+	}
+	return boards, nil
+}
+
+// boardSummary works like pubrecdb.PublicRecord.GetBoardSummary.
+func (db *Record) boardSummary(name string) (*ombjson.BoardSummary, error) {
+	if db.isBlacklisted(ombstore.BlacklistTag, name) {
+		return nil, ombstore.ErrWithheld
+	}
+	board, ok := db.boards()[strings.ToLower(string(ombstore.BoardTag(name)))]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return board.summary, nil
+}
+
+// GetBoard works like pubrecdb.PublicRecord.GetBoard.
+func (db *Record) GetBoard(name string, c *ombstore.Cursor, limit int) (*ombjson.BoardResp, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	summary, err := db.boardSummary(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := string(ombstore.BoardTag(name))
+	page := db.bltnPage(c, limit, func(b *memBltn) bool { return b.hasTag(tag) })
+
+	board := &ombjson.BoardResp{
+		Summary:   summary,
+		Bulletins: page.Bulletins,
+		Withheld:  page.Withheld,
+		Cursors:   page.Cursors,
+	}
+	return board, nil
+}
+
+// GetStatistics works like pubrecdb.PublicRecord.GetStatistics.
+func (db *Record) GetStatistics(start, fin time.Time) (*ombjson.Statistics, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	s, f := start.Unix(), fin.Unix()
+	within := func(ts int64) bool { return ts > s && ts <= f }
+
+	stat := &ombjson.Statistics{
+		StartTs: s,
+		StopTs:  f,
+	}
+	for _, b := range db.bltns {
+		if within(b.ts) {
+			stat.NumBltns++
+		}
+	}
+	for _, e := range db.endos {
+		if within(e.ts) {
+			stat.NumEndos++
+		}
+	}
+	for _, blk := range db.blocks {
+		if within(blk.ts) {
+			stat.NumBlks++
+		}
+	}
+	return stat, nil
+}
+
+// bucketOf returns the bucket of the series that ts falls into or -1 if it is
+// outside of the series.
+func bucketOf(series *ombjson.ActivitySeries, width time.Duration, ts int64) int {
+	if ts < series.StartTs || ts >= series.StopTs {
+		return -1
+	}
+	i := int((ts - series.StartTs) / int64(width.Seconds()))
+	if i >= len(series.Buckets) {
+		return -1
+	}
+	return i
+}
+
+// GetActivitySeries works like pubrecdb.PublicRecord.GetActivitySeries.
+func (db *Record) GetActivitySeries(start, end time.Time, bucket string) (*ombjson.ActivitySeries, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	series, width, err := ombstore.NewActivitySeries(start, end, bucket, db.maxQueryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make([]map[string]bool, len(series.Buckets))
+	for i := range authors {
+		authors[i] = make(map[string]bool)
+	}
+	at := func(ts int64) *ombjson.Activity {
+		if i := bucketOf(series, width, ts); i >= 0 {
+			return series.Buckets[i]
+		}
+		return nil
+	}
+	sent := func(ts int64, author string) {
+		if i := bucketOf(series, width, ts); i >= 0 {
+			authors[i][author] = true
+		}
+	}
+
+	for _, blk := range db.blocks {
+		if a := at(blk.ts); a != nil {
+			a.NumBlks++
+		}
+	}
+
+	newTags := make(map[string]int64)
+	for _, b := range db.bltns {
+		if db.bltnWithheld(b) {
+			continue
+		}
+		ts := db.blocks[b.block].ts
+		if a := at(ts); a != nil {
+			a.NumBltns++
+		}
+		sent(ts, b.author)
+
+		for _, tag := range b.tags {
+			key := strings.ToLower(tag)
+			if first, ok := newTags[key]; !ok || ts < first {
+				newTags[key] = ts
+			}
+		}
+	}
+	for _, ts := range newTags {
+		if a := at(ts); a != nil {
+			a.NumNewTags++
+		}
+	}
+
+	for _, e := range db.endos {
+		if db.endoWithheld(e) {
+			continue
+		}
+		ts := db.blocks[e.block].ts
+		if a := at(ts); a != nil {
+			a.NumEndos++
+		}
+		sent(ts, e.author)
+	}
+
+	for i, a := range series.Buckets {
+		a.NumAuthors = int64(len(authors[i]))
+	}
+	return series, nil
+}
+
+// latestTs returns the latest block timestamp in the record.
+func (db *Record) latestTs() int64 {
+	var ts int64
+	for _, blk := range db.blocks {
+		if blk.ts > ts {
+			ts = blk.ts
+		}
+	}
+	return ts
+}
+
+// trendRecord is a bulletin or the first endorsement an author sent of one
+// along with the timestamp of its block like the rows of trendSql.
+type trendRecord struct {
+	bid  string
+	bltn bool
+	ts   int64
+	held bool // Set when the bulletin is withheld
+}
+
+// trendRecords returns what a trend is made of along with the latest block
+// timestamp. Only the records of the last span seconds before it are
+// returned. Records whose bulletin is missing are left out.
+func (db *Record) trendRecords(span int64) ([]trendRecord, int64) {
+	tip := db.latestTs()
+
+	recs := []trendRecord{}
+	add := func(bid string, bltn bool, blk string) {
+		b, ok := db.bltns[bid]
+		ts := db.blocks[blk].ts
+		if ok && ts >= tip-span {
+			recs = append(recs, trendRecord{bid, bltn, ts, db.bltnWithheld(b)})
+		}
+	}
+
+	type sent struct {
+		bid, author string
+	}
+	firsts := make(map[sent]*memEndo)
+	for _, e := range db.endos {
+		k := sent{e.bid, e.author}
+		if f, ok := firsts[k]; !ok || keyBefore(db.endoKey(f), db.endoKey(e)) {
+			firsts[k] = e
+		}
+	}
+
+	for _, b := range db.bltns {
+		add(b.txid, true, b.block)
+	}
+	for _, e := range firsts {
+		if !db.endoWithheld(e) {
+			add(e.bid, false, e.block)
+		}
+	}
+	return recs, tip
+}
+
+// sortTags orders tags by their score with the highest first and cuts the
+// list down to limit.
+func sortTags(tags []*ombjson.Tag, limit int) []*ombjson.Tag {
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Score != tags[j].Score {
+			return tags[i].Score > tags[j].Score
+		}
+		return tags[i].Value < tags[j].Value
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags
+}
+
+// GetTrendingTags works like pubrecdb.PublicRecord.GetTrendingTags.
+func (db *Record) GetTrendingTags(halfLife time.Duration, limit int) ([]*ombjson.Tag, bool, error) {
+	hl, span, err := ombstore.TrendArgs(halfLife)
+	if err != nil {
+		return nil, false, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// The records of withheld bulletins are scored apart like in the sql.
+	type group struct {
+		key  string
+		held bool
+	}
+	recs, tip := db.trendRecords(span)
+	groups := make(map[group]*ombjson.Tag)
+	used := make(map[group]bool)
+	held := make(map[*ombjson.Tag]bool)
+	for _, r := range recs {
+		w := ombstore.Decay(float64(tip-r.ts), float64(hl))
+		for _, value := range db.bltns[r.bid].tags {
+			key := group{strings.ToLower(value), r.held}
+			tag, ok := groups[key]
+			if !ok {
+				tag = &ombjson.Tag{Value: value}
+				groups[key] = tag
+				held[tag] = r.held
+			}
+			if value < tag.Value {
+				tag.Value = value
+			}
+			tag.Score += w
+
+			if !r.bltn {
+				continue
+			}
+			tag.Count++
+			if !used[key] || r.ts < tag.FirstTs {
+				tag.FirstTs = r.ts
+			}
+			used[key] = true
+		}
+	}
+
+	tags := []*ombjson.Tag{}
+	for _, tag := range groups {
+		tags = append(tags, tag)
+	}
+	tags = sortTags(tags, len(tags))
+
+	keep, withheld := topHeld(len(tags), ombstore.CapLimit(limit, db.maxQueryLimit), func(i int) bool {
+		return held[tags[i]]
+	})
+	top := []*ombjson.Tag{}
+	for _, i := range keep {
+		top = append(top, tags[i])
+	}
+	return top, withheld, nil
+}
+
+// GetTrendingBltns works like pubrecdb.PublicRecord.GetTrendingBltns.
+func (db *Record) GetTrendingBltns(halfLife time.Duration, limit int) ([]*ombjson.TrendingBltn, bool, error) {
+	hl, span, err := ombstore.TrendArgs(halfLife)
+	if err != nil {
+		return nil, false, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	recs, tip := db.trendRecords(span)
+	scores := make(map[string]float64)
+	for _, r := range recs {
+		scores[r.bid] += ombstore.Decay(float64(tip-r.ts), float64(hl))
+	}
+
+	trending := []*ombjson.TrendingBltn{}
+	for bid, score := range scores {
+		trending = append(trending, &ombjson.TrendingBltn{
+			Bulletin: db.bltnJSON(db.bltns[bid]),
+			Score:    score,
+		})
+	}
+	sort.Slice(trending, func(i, j int) bool {
+		a, b := trending[i], trending[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Bulletin.Txid < b.Bulletin.Txid
+	})
+
+	keep, withheld := topHeld(len(trending), ombstore.CapLimit(limit, db.maxQueryLimit), func(i int) bool {
+		return db.bltnWithheld(db.bltns[trending[i].Bulletin.Txid])
+	})
+	top := []*ombjson.TrendingBltn{}
+	for _, i := range keep {
+		top = append(top, trending[i])
+	}
+	return top, withheld, nil
+}
+
+// tagBltns returns the bulletins tagged with tag that are not withheld.
+func (db *Record) tagBltns(tag string) []*memBltn {
+	bltns := []*memBltn{}
+	for _, b := range db.bltns {
+		if b.hasTag(tag) && !db.bltnWithheld(b) {
+			bltns = append(bltns, b)
+		}
+	}
+	return bltns
+}
+
+// GetTagDetail works like pubrecdb.PublicRecord.GetTagDetail.
+func (db *Record) GetTagDetail(tag ombutil.Tag, start, end time.Time, bucket string) (*ombjson.TagDetail, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.isBlacklisted(ombstore.BlacklistTag, string(tag)) {
+		return nil, ombstore.ErrWithheld
+	}
+
+	bltns := db.tagBltns(string(tag))
+	if len(bltns) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	var first *memBltn
+	type count struct {
+		num   int64
+		lastH int32
+	}
+	counts := make(map[string]*count)
+	for _, b := range bltns {
+		if first == nil || keyBefore(db.bltnKey(first), db.bltnKey(b)) {
+			first = b
+		}
+		h := db.blocks[b.block].height
+		c, ok := counts[b.author]
+		if !ok {
+			c = &count{lastH: h}
+			counts[b.author] = c
+		}
+		c.num++
+		if h > c.lastH {
+			c.lastH = h
+		}
+	}
+
+	detail := &ombjson.TagDetail{
+		Value:      string(tag),
+		FirstUse:   db.bltnJSON(first),
+		TopAuthors: []*ombjson.TagAuthor{},
+	}
+
+	for addr, c := range counts {
+		detail.TopAuthors = append(detail.TopAuthors, &ombjson.TagAuthor{
+			Address:  addr,
+			NumBltns: c.num,
+		})
+	}
+	sort.Slice(detail.TopAuthors, func(i, j int) bool {
+		a, b := detail.TopAuthors[i], detail.TopAuthors[j]
+		if a.NumBltns != b.NumBltns {
+			return a.NumBltns > b.NumBltns
+		}
+		if counts[a.Address].lastH != counts[b.Address].lastH {
+			return counts[a.Address].lastH > counts[b.Address].lastH
+		}
+		return a.Address < b.Address
+	})
+	if len(detail.TopAuthors) > ombstore.NumTagDetailItems {
+		detail.TopAuthors = detail.TopAuthors[:ombstore.NumTagDetailItems]
+	}
+
+	var err error
+	detail.Activity, err = db.tagActivity(bltns, start, end, bucket)
+	if err != nil {
+		return nil, err
+	}
+	detail.Related = db.relatedTags(string(tag), bltns, ombstore.NumTagDetailItems)
+
+	return detail, nil
+}
+
+// tagActivity works like pubrecdb.PublicRecord.GetTagActivity for the
+// bulletins of a tag.
+func (db *Record) tagActivity(bltns []*memBltn, start, end time.Time, bucket string) (*ombjson.ActivitySeries, error) {
+	series, width, err := ombstore.NewActivitySeries(start, end, bucket, db.maxQueryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make([]map[string]bool, len(series.Buckets))
+	for i := range authors {
+		authors[i] = make(map[string]bool)
+	}
+
+	for _, b := range bltns {
+		if i := bucketOf(series, width, db.blocks[b.block].ts); i >= 0 {
+			series.Buckets[i].NumBltns++
+			authors[i][b.author] = true
+		}
+		for _, e := range db.bids[b.txid] {
+			if db.endoWithheld(e) {
+				continue
+			}
+			if i := bucketOf(series, width, db.blocks[e.block].ts); i >= 0 {
+				series.Buckets[i].NumEndos++
+				authors[i][e.author] = true
+			}
+		}
+	}
+
+	for i, a := range series.Buckets {
+		a.NumAuthors = int64(len(authors[i]))
+	}
+	return series, nil
+}
+
+// relatedTags works like pubrecdb.PublicRecord.GetRelatedTags for the
+// bulletins of a tag.
+func (db *Record) relatedTags(tag string, bltns []*memBltn, n int) []*ombjson.Tag {
+	tip := db.latestTs()
+	hl := float64(ombstore.RelatedTagsHalfLife / time.Second)
+
+	groups := make(map[string]*ombjson.Tag)
+	shared := make(map[string]map[string]bool)
+	for _, b := range bltns {
+		ts := db.blocks[b.block].ts
+		w := ombstore.Decay(float64(tip-ts), hl)
+		for _, t := range b.tags {
+			if !sameTag(t, tag) {
+				continue
+			}
+			for _, value := range b.tags {
+				if sameTag(value, t) {
+					continue
+				}
+				key := strings.ToLower(value)
+				other, ok := groups[key]
+				if !ok {
+					other = &ombjson.Tag{Value: value, FirstTs: ts}
+					groups[key] = other
+					shared[key] = make(map[string]bool)
+				}
+				if value < other.Value {
+					other.Value = value
+				}
+				if ts < other.FirstTs {
+					other.FirstTs = ts
+				}
+				other.Score += w
+				shared[key][b.txid] = true
+			}
+		}
+	}
+
+	tags := []*ombjson.Tag{}
+	for key, other := range groups {
+		other.Count = int64(len(shared[key]))
+		tags = append(tags, other)
+	}
+	return sortTags(tags, ombstore.CapLimit(n, db.maxQueryLimit))
+}
@@ -0,0 +1,258 @@
+package memrecord_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+// bltnTxids returns the txids of the bulletins in order.
+func bltnTxids(bltns []*ombjson.Bulletin) []string {
+	txids := []string{}
+	for _, bltn := range bltns {
+		txids = append(txids, bltn.Txid)
+	}
+	return txids
+}
+
+func sameTxids(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetBulletin(t *testing.T) {
+	rec := setupRecord(t)
+
+	bltn, err := rec.db.GetBulletin(newSha(txid(1)), ombstore.WithProof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bltn.Author != authorA || bltn.Message != "Lambs in the field #lambs" ||
+		bltn.NumEndos != 1 || bltn.BlockRef.Hash != rec.blocks[0].Sha().String() ||
+		bltn.Location == nil || bltn.Proof == nil {
+		t.Fatal(spw(bltn))
+	}
+
+	endo, err := rec.db.GetEndorsement(newSha(txid(4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endo.Bid != txid(1) || !endo.BltnExists || endo.Proof != nil {
+		t.Fatal(spw(endo))
+	}
+}
+
+func TestGetTag(t *testing.T) {
+	rec := setupRecord(t)
+
+	// Tags match without regard to case and the newest bulletin comes first.
+	for _, tag := range []string{"#lambs", "#LAMBS"} {
+		page, err := rec.db.GetTag(ombutil.Tag(tag), nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameTxids(bltnTxids(page.Bulletins), txid(2), txid(1)) {
+			t.Fatalf("%s: %s", tag, spw(page))
+		}
+	}
+
+	page, err := rec.db.GetTag(ombutil.Tag("#lambs"), nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameTxids(bltnTxids(page.Bulletins), txid(2)) || page.Next == "" {
+		t.Fatal(spw(page))
+	}
+	c, err := ombstore.ParseCursor(page.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err = rec.db.GetTag(ombutil.Tag("#lambs"), c, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameTxids(bltnTxids(page.Bulletins), txid(1)) || page.Next != "" {
+		t.Fatal(spw(page))
+	}
+
+	board, err := rec.db.GetBoard("farm", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameTxids(bltnTxids(board.Bulletins), txid(2)) {
+		t.Fatal(spw(board))
+	}
+}
+
+func TestGetNearbyBltns(t *testing.T) {
+	rec := setupRecord(t)
+
+	page, err := rec.db.GetNearbyBltns(0, 0, 10, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameTxids(bltnTxids(page.Bulletins), txid(1)) {
+		t.Fatal(spw(page))
+	}
+
+	// 10, 10 is about 1570 kilometers from 0, 0.
+	bltns, withheld, err := rec.db.GetNearbyBltnsByDist(10, 10, 2000, 0)
+	if err != nil || withheld {
+		t.Fatal(err)
+	}
+	if !sameTxids(bltnTxids(bltns), txid(2), txid(1)) {
+		t.Fatal(spw(bltns))
+	}
+
+	page, err = rec.db.GetBulletinsInBBox(5, 5, 15, 15, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameTxids(bltnTxids(page.Bulletins), txid(2)) {
+		t.Fatal(spw(page))
+	}
+	if _, err := rec.db.GetBulletinsInBBox(15, 5, 5, 15, nil, 0); err != ombstore.ErrBadBBox {
+		t.Fatalf("Inverted box returned: %v", err)
+	}
+
+	g := &ombjson.Geometry{
+		Type:        "Polygon",
+		Coordinates: []byte(`[[[-1, -1], [1, -1], [1, 1], [-1, 1], [-1, -1]]]`),
+	}
+	page, err = rec.db.GetBulletinsInPolygon(g, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameTxids(bltnTxids(page.Bulletins), txid(1)) {
+		t.Fatal(spw(page))
+	}
+}
+
+func TestGetAuthor(t *testing.T) {
+	rec := setupRecord(t)
+
+	auth, err := btcutil.DecodeAddress(authorA, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// authorA sent bltn(1), bltn(3) and endo(5). They come two at a time.
+	first, err := rec.db.GetAuthor(auth, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Summary.NumBltns != 2 || first.Summary.NumEndos != 1 ||
+		first.Summary.NumRecvd != 1 || first.Next == "" {
+		t.Fatal(spw(first))
+	}
+	c, err := ombstore.ParseCursor(first.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rec.db.GetAuthor(auth, c, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Next != "" {
+		t.Fatal(spw(second))
+	}
+
+	n := len(first.Bulletins) + len(first.Endorsements)
+	if n != 2 || len(second.Bulletins)+len(second.Endorsements) != 1 {
+		t.Fatal(spw([]interface{}{first, second}))
+	}
+	if !sameTxids(bltnTxids(second.Bulletins), txid(1)) {
+		t.Fatal(spw(second))
+	}
+
+	authors, err := rec.db.GetAllAuthors(ombstore.SortPosts, ombstore.AuthorFilter{}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authors.Authors) != 2 || authors.Authors[0].Address != authorA {
+		t.Fatal(spw(authors))
+	}
+	if _, err := rec.db.GetAllAuthors("nope", ombstore.AuthorFilter{}, nil, 0); err != ombstore.ErrBadSort {
+		t.Fatalf("Unknown sort returned: %v", err)
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	rec := setupRecord(t)
+	a, c := rec.blocks[0], rec.blocks[2]
+
+	// The range starts at c and stops before a.
+	page, err := rec.db.QueryRange(c.Sha(), a.Sha(), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Bulletins) != 2 || len(page.Endorsements) != 2 ||
+		page.Start != c.Sha().String() || page.Stop != a.Sha().String() {
+		t.Fatal(spw(page))
+	}
+	for _, bltn := range page.Bulletins {
+		if bltn.Txid == txid(1) {
+			t.Fatal(spw(page))
+		}
+	}
+
+	latest, err := rec.db.GetLatestPage(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest.Bulletins) != 3 || len(latest.Endorsements) != 2 ||
+		latest.Stop != peg.GetStartBlock().Sha().String() {
+		t.Fatal(spw(latest))
+	}
+
+	orphans, err := rec.db.GetOrphanEndorsements(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans.Endorsements) != 1 || orphans.Endorsements[0].Txid != txid(5) {
+		t.Fatal(spw(orphans))
+	}
+}
+
+func TestGetStatistics(t *testing.T) {
+	rec := setupRecord(t)
+
+	// Everything after the peg block up to block b.
+	stats, err := rec.db.GetStatistics(testTs.Add(-time.Second), testTs.Add(10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NumBlks != 2 || stats.NumBltns != 2 || stats.NumEndos != 0 {
+		t.Fatal(spw(stats))
+	}
+
+	stats, err = rec.db.GetStatistics(testTs.Add(-time.Second), testTs.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NumBlks != 3 || stats.NumBltns != 3 || stats.NumEndos != 2 {
+		t.Fatal(spw(stats))
+	}
+
+	series, err := rec.db.GetActivitySeries(testTs, testTs.Add(time.Hour), ombstore.BucketHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series.Buckets) != 1 || series.Buckets[0].NumBltns != 3 ||
+		series.Buckets[0].NumAuthors != 2 {
+		t.Fatal(spw(series))
+	}
+}
@@ -0,0 +1,809 @@
+// Package memrecord keeps the public record in memory. It serves the same
+// queries as pubrecdb without a database driver, so it builds without cgo.
+package memrecord
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+	"github.com/soapboxsys/ombudslib/ombutil"
+)
+
+var (
+	ErrConflict     error = errors.New("item is already in the record")
+	ErrMissingBlock error = errors.New("block is not in the record")
+)
+
+// A Record is an ombstore.Store that keeps the public record in memory. It
+// answers every query the way a pubrecdb.PublicRecord does, but it needs
+// neither a file nor cgo, so it can back unit tests and light clients.
+// Nothing is kept once the process exits and raw transactions are never
+// stored.
+type Record struct {
+	mu sync.RWMutex
+
+	blocks map[string]*memBlock
+	bltns  map[string]*memBltn
+	endos  map[string]*memEndo
+	proofs map[string]*memProof
+
+	// bids holds the endorsements of every txid that has been endorsed.
+	bids map[string]map[string]*memEndo
+
+	// nonRecord holds the orphans whose bid is known not to be a bulletin.
+	nonRecord map[string]bool
+	txIndex   ombstore.TxIndex
+
+	blacklist  map[blacklistKey]*ombjson.BlacklistEntry
+	reputation map[string]float64
+
+	// Max Number of Records returned by db
+	maxQueryLimit int
+
+	// Options
+	rawEndoCounts bool
+
+	// Subscriptions to changes
+	feed *ombstore.Feed
+}
+
+type memBlock struct {
+	hash     string
+	prevhash string
+	height   int32
+	ts       int64
+	header   wire.BlockHeader
+}
+
+type memBltn struct {
+	txid   string
+	block  string
+	author string
+	msg    string
+	ts     int64
+	loc    *ombjson.Location
+	tags   []string
+}
+
+type memEndo struct {
+	txid   string
+	block  string
+	bid    string
+	author string
+	ts     int64
+}
+
+type memProof struct {
+	block  string
+	idx    int
+	branch []*wire.ShaHash
+}
+
+type blacklistKey struct {
+	kind, value string
+}
+
+var _ ombstore.Store = (*Record)(nil)
+
+// New returns an empty record that starts from the peg block of the
+// network.
+func New(params *chaincfg.Params) (*Record, error) {
+	db := &Record{
+		blocks:        make(map[string]*memBlock),
+		bltns:         make(map[string]*memBltn),
+		endos:         make(map[string]*memEndo),
+		proofs:        make(map[string]*memProof),
+		bids:          make(map[string]map[string]*memEndo),
+		nonRecord:     make(map[string]bool),
+		blacklist:     make(map[blacklistKey]*ombjson.BlacklistEntry),
+		reputation:    make(map[string]float64),
+		maxQueryLimit: ombstore.DefaultMaxQueryLimit,
+		feed:          ombstore.NewFeed(),
+	}
+
+	pegBlk, err := ombstore.PegBlock(params.Net)
+	if err != nil {
+		return nil, err
+	}
+	if err, _ := db.InsertBlockHead(pegBlk); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// ShowRawEndoCounts works like pubrecdb.PublicRecord.ShowRawEndoCounts.
+func (db *Record) ShowRawEndoCounts(show bool) {
+	db.mu.Lock()
+	db.rawEndoCounts = show
+	db.mu.Unlock()
+}
+
+// Subscribe works like pubrecdb.PublicRecord.Subscribe.
+func (db *Record) Subscribe(filter ombstore.EventFilter) *ombstore.Subscription {
+	return db.feed.Subscribe(filter)
+}
+
+// WithContext returns the record itself. Calls to a Record only ever wait
+// on its lock so there is nothing for ctx to cut short.
+func (db *Record) WithContext(ctx context.Context) ombstore.Store {
+	return db
+}
+
+func newMemBlock(blk *btcutil.Block) *memBlock {
+	h := blk.MsgBlock().Header
+	return &memBlock{
+		hash:     h.BlockSha().String(),
+		prevhash: h.PrevBlock.String(),
+		height:   blk.Height(),
+		ts:       int64(uint32(h.Timestamp.Unix())),
+		header:   h,
+	}
+}
+
+func newMemBltn(bltn *ombutil.Bulletin) *memBltn {
+	b := &memBltn{
+		txid:   bltn.Tx.TxSha().String(),
+		block:  bltn.Block.Sha().String(),
+		author: string(bltn.Author),
+		msg:    bltn.Wire.GetMessage(),
+		ts:     int64(bltn.Wire.GetTimestamp()),
+		tags:   []string{},
+	}
+
+	if loc := bltn.Wire.GetLocation(); loc != nil {
+		b.loc = &ombjson.Location{
+			Lat: loc.GetLat(),
+			Lon: loc.GetLon(),
+			H:   loc.GetH(),
+		}
+	}
+
+	for tag := range bltn.Tags() {
+		b.tags = append(b.tags, string(tag))
+	}
+	sort.Strings(b.tags)
+	return b
+}
+
+func newMemEndo(endo *ombutil.Endorsement) (*memEndo, error) {
+	bid := endo.Wire.GetBid()
+	if len(bid) != wire.HashSize {
+		return nil, fmt.Errorf("Bid length incorrect")
+	}
+
+	e := &memEndo{
+		txid:   endo.Tx.TxSha().String(),
+		block:  endo.Block.Sha().String(),
+		bid:    hex.EncodeToString(bid),
+		author: string(endo.Author),
+		ts:     int64(endo.Wire.GetTimestamp()),
+	}
+	return e, nil
+}
+
+// checkBlock returns why the block cannot be stored. Like the sql record only
+// one block can be stored at each height and after each block, and every
+// block but the first must follow one that is stored.
+func (db *Record) checkBlock(blk *memBlock) error {
+	if _, ok := db.blocks[blk.hash]; ok {
+		return ErrConflict
+	}
+	for _, b := range db.blocks {
+		if b.height == blk.height || b.prevhash == blk.prevhash {
+			return ErrConflict
+		}
+	}
+	if _, ok := db.blocks[blk.prevhash]; !ok && len(db.blocks) > 0 {
+		return ErrMissingBlock
+	}
+	return nil
+}
+
+// checkBltns returns why the bulletins cannot be stored. next is the hash of
+// a block that is stored along with them.
+func (db *Record) checkBltns(bltns []*memBltn, next string) error {
+	seen := make(map[string]bool)
+	for _, b := range bltns {
+		if _, ok := db.blocks[b.block]; !ok && b.block != next {
+			return ErrMissingBlock
+		}
+		if _, ok := db.bltns[b.txid]; ok || seen[b.txid] {
+			return ErrConflict
+		}
+		seen[b.txid] = true
+	}
+	return nil
+}
+
+// checkEndos works like checkBltns for endorsements.
+func (db *Record) checkEndos(endos []*memEndo, next string) error {
+	seen := make(map[string]bool)
+	for _, e := range endos {
+		if _, ok := db.blocks[e.block]; !ok && e.block != next {
+			return ErrMissingBlock
+		}
+		if _, ok := db.endos[e.txid]; ok || seen[e.txid] {
+			return ErrConflict
+		}
+		seen[e.txid] = true
+	}
+	return nil
+}
+
+// addBltn stores the bulletin and links the endorsements waiting for it.
+func (db *Record) addBltn(b *memBltn) {
+	db.bltns[b.txid] = b
+	for txid := range db.bids[b.txid] {
+		delete(db.nonRecord, txid)
+	}
+}
+
+// addEndo stores the endorsement. An orphan whose bid is an endorsement is
+// known not to wait for a bulletin.
+func (db *Record) addEndo(e *memEndo) {
+	db.endos[e.txid] = e
+	if _, ok := db.bids[e.bid]; !ok {
+		db.bids[e.bid] = make(map[string]*memEndo)
+	}
+	db.bids[e.bid][e.txid] = e
+
+	delete(db.nonRecord, e.txid)
+	if _, ok := db.bltns[e.bid]; !ok {
+		if _, ok := db.endos[e.bid]; ok {
+			db.nonRecord[e.txid] = true
+		}
+	}
+}
+
+// dropBltn removes the bulletin and turns its endorsements back into
+// orphans.
+func (db *Record) dropBltn(b *memBltn) {
+	delete(db.bltns, b.txid)
+	for txid := range db.bids[b.txid] {
+		delete(db.nonRecord, txid)
+	}
+}
+
+func (db *Record) dropEndo(e *memEndo) {
+	delete(db.endos, e.txid)
+	delete(db.nonRecord, e.txid)
+	delete(db.bids[e.bid], e.txid)
+	if len(db.bids[e.bid]) == 0 {
+		delete(db.bids, e.bid)
+	}
+}
+
+// dropBlock removes the block along with everything stored in it.
+func (db *Record) dropBlock(hash string) {
+	delete(db.blocks, hash)
+	for _, b := range db.bltns {
+		if b.block == hash {
+			db.dropBltn(b)
+		}
+	}
+	for _, e := range db.endos {
+		if e.block == hash {
+			db.dropEndo(e)
+		}
+	}
+	for txid, p := range db.proofs {
+		if p.block == hash {
+			delete(db.proofs, txid)
+		}
+	}
+}
+
+// InsertUBlock stores the block along with all of its records. Nothing is
+// stored unless all of it can be. If the insert was succesful the function
+// returns (nil, true).
+func (db *Record) InsertUBlock(oblk *ombutil.UBlock) (error, bool) {
+	err, ok := db.insertUBlock(oblk)
+	if ok && db.feed.Active() {
+		blk, err := db.GetBlock(oblk.Block.Sha())
+		db.feed.PublishBlock(ombstore.BlockConnected, blk, err)
+	}
+	return err, ok
+}
+
+func (db *Record) insertUBlock(oblk *ombutil.UBlock) (error, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	blk := newMemBlock(oblk.Block)
+	if err := db.checkBlock(blk); err != nil {
+		return err, false
+	}
+
+	bltns := []*memBltn{}
+	for _, bltn := range oblk.Bulletins {
+		bltns = append(bltns, newMemBltn(bltn))
+	}
+	if err := db.checkBltns(bltns, blk.hash); err != nil {
+		return err, false
+	}
+
+	endos := []*memEndo{}
+	for _, endo := range oblk.Endorsements {
+		e, err := newMemEndo(endo)
+		if err != nil {
+			return err, false
+		}
+		endos = append(endos, e)
+	}
+	if err := db.checkEndos(endos, blk.hash); err != nil {
+		return err, false
+	}
+
+	proofs, err := memProofs(oblk)
+	if err != nil {
+		return err, false
+	}
+	mined, err := db.minedBids(endos)
+	if err != nil {
+		return err, false
+	}
+
+	db.blocks[blk.hash] = blk
+	for _, b := range bltns {
+		db.addBltn(b)
+	}
+	for _, e := range endos {
+		db.addEndo(e)
+	}
+	for txid, p := range proofs {
+		db.proofs[txid] = p
+	}
+
+	// Endorsements waiting on a tx in this block that is not a bulletin
+	// never will be linked
+	inBlk := make(map[string]bool)
+	for _, b := range bltns {
+		inBlk[b.txid] = true
+	}
+	for _, t := range oblk.Block.Transactions() {
+		txid := t.Sha().String()
+		if inBlk[txid] {
+			continue
+		}
+		if _, ok := db.bltns[txid]; ok {
+			continue
+		}
+		for etxid := range db.bids[txid] {
+			db.nonRecord[etxid] = true
+		}
+	}
+	for _, e := range endos {
+		if _, ok := db.bltns[e.bid]; !ok && mined[e.bid] {
+			db.nonRecord[e.txid] = true
+		}
+	}
+
+	// Rank the authors again when the graph could have changed
+	if len(bltns) > 0 || len(endos) > 0 {
+		db.updateReputation()
+	}
+
+	return nil, true
+}
+
+// SetTxIndex lets the record look up the bids of new orphans in idx like
+// pubrecdb.PublicRecord.SetTxIndex.
+func (db *Record) SetTxIndex(idx ombstore.TxIndex) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.txIndex = idx
+}
+
+// minedBids returns the bids of endos that the tx index has seen mined. The
+// caller must hold the lock.
+func (db *Record) minedBids(endos []*memEndo) (map[string]bool, error) {
+	mined := make(map[string]bool)
+	if db.txIndex == nil {
+		return mined, nil
+	}
+	for _, e := range endos {
+		if _, ok := db.bltns[e.bid]; ok {
+			continue
+		}
+		sha, err := wire.NewShaHashFromStr(e.bid)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := db.txIndex.ExistsTxSha(sha)
+		if err != nil {
+			return nil, err
+		}
+		mined[e.bid] = ok
+	}
+	return mined, nil
+}
+
+// memProofs returns the merkle branch of every record in the block by its
+// txid. The tree is only built when the block holds records.
+func memProofs(oblk *ombutil.UBlock) (map[string]*memProof, error) {
+	proofs := make(map[string]*memProof)
+
+	txids := []*wire.ShaHash{}
+	for _, bltn := range oblk.Bulletins {
+		sha := bltn.Tx.TxSha()
+		txids = append(txids, &sha)
+	}
+	for _, endo := range oblk.Endorsements {
+		sha := endo.Tx.TxSha()
+		txids = append(txids, &sha)
+	}
+	if len(txids) == 0 {
+		return proofs, nil
+	}
+
+	blk := oblk.Block
+	index := make(map[wire.ShaHash]int)
+	for i, t := range blk.Transactions() {
+		index[*t.Sha()] = i
+	}
+	store := blockchain.BuildMerkleTreeStore(blk.Transactions())
+	blkHash := blk.Sha().String()
+
+	for _, txid := range txids {
+		i, ok := index[*txid]
+		if !ok {
+			return nil, fmt.Errorf("Record %s is not in block %s", txid, blkHash)
+		}
+		proofs[txid.String()] = &memProof{
+			block:  blkHash,
+			idx:    i,
+			branch: ombutil.MerkleBranch(store, i),
+		}
+	}
+	return proofs, nil
+}
+
+// InsertBlockHead only stores the header of the block. If the block is
+// already in the record an error is returned.
+func (db *Record) InsertBlockHead(blk *btcutil.Block) (error, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	b := newMemBlock(blk)
+	if err := db.checkBlock(b); err != nil {
+		return err, false
+	}
+	db.blocks[b.hash] = b
+	return nil, true
+}
+
+// InsertBulletin stores a single bulletin. Its block must already be in the
+// record.
+func (db *Record) InsertBulletin(bltn *ombutil.Bulletin) (error, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	b := newMemBltn(bltn)
+	if err := db.checkBltns([]*memBltn{b}, ""); err != nil {
+		return err, false
+	}
+	db.addBltn(b)
+	return nil, true
+}
+
+// InsertEndorsement stores a single endorsement. Like in the sql record the
+// bulletin it endorses does not have to be stored yet.
+func (db *Record) InsertEndorsement(endo *ombutil.Endorsement) (error, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e, err := newMemEndo(endo)
+	if err != nil {
+		return err, false
+	}
+	if err := db.checkEndos([]*memEndo{e}, ""); err != nil {
+		return err, false
+	}
+	db.addEndo(e)
+	return nil, true
+}
+
+// DeleteBlockTip removes the block and everything stored in it. It returns
+// ombstore.ErrBlockNotTip for any block that is not the tip.
+func (db *Record) DeleteBlockTip(sha *wire.ShaHash) (error, bool) {
+	var removed *ombjson.Block
+	var readErr error
+	announce := db.feed.Active()
+	if announce {
+		removed, readErr = db.GetBlock(sha)
+	}
+
+	err, ok := db.deleteBlockTip(sha)
+	if ok && announce {
+		db.feed.PublishBlock(ombstore.BlockDisconnected, removed, readErr)
+	}
+	return err, ok
+}
+
+func (db *Record) deleteBlockTip(sha *wire.ShaHash) (error, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	blk, ok := db.blocks[sha.String()]
+	if !ok || blk != db.tip() {
+		return ombstore.ErrBlockNotTip, false
+	}
+	for _, b := range db.blocks {
+		if b.prevhash == blk.hash {
+			return ombstore.ErrBlockNotTip, false
+		}
+	}
+
+	db.dropBlock(blk.hash)
+	return nil, true
+}
+
+// DropAfterBlockBySha removes every block above the passed one.
+func (db *Record) DropAfterBlockBySha(sha *wire.ShaHash) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	blk, ok := db.blocks[sha.String()]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	for hash, b := range db.blocks {
+		if b.height > blk.height {
+			db.dropBlock(hash)
+		}
+	}
+	return nil
+}
+
+// InsertBlacklistEntry works like pubrecdb.PublicRecord.InsertBlacklistEntry.
+func (db *Record) InsertBlacklistEntry(entry *ombjson.BlacklistEntry) (error, bool) {
+	value, err := ombstore.NormBlacklistValue(entry.Kind, entry.Value)
+	if err != nil {
+		return err, false
+	}
+
+	entry.Value = value
+	entry.Timestamp = time.Now().Unix()
+
+	db.mu.Lock()
+	stored := *entry
+	db.blacklist[blacklistKey{entry.Kind, entry.Value}] = &stored
+	db.mu.Unlock()
+
+	return nil, true
+}
+
+// DeleteBlacklistEntry works like pubrecdb.PublicRecord.DeleteBlacklistEntry.
+func (db *Record) DeleteBlacklistEntry(kind, value string) (error, bool) {
+	value, err := ombstore.NormBlacklistValue(kind, value)
+	if err != nil {
+		return err, false
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := blacklistKey{kind, value}
+	if _, ok := db.blacklist[key]; !ok {
+		return sql.ErrNoRows, false
+	}
+	delete(db.blacklist, key)
+	return nil, true
+}
+
+// GetBlacklist returns every entry in the blacklist with the newest first.
+func (db *Record) GetBlacklist() ([]*ombjson.BlacklistEntry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	entries := []*ombjson.BlacklistEntry{}
+	for _, entry := range db.blacklist {
+		e := *entry
+		entries = append(entries, &e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Timestamp != b.Timestamp {
+			return a.Timestamp > b.Timestamp
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Value < b.Value
+	})
+	return entries, nil
+}
+
+// listed reports if the normalized value has an entry in the blacklist.
+func (db *Record) listed(kind, value string) bool {
+	_, ok := db.blacklist[blacklistKey{kind, value}]
+	return ok
+}
+
+// isBlacklisted reports if the item has an entry of its own in the
+// blacklist.
+func (db *Record) isBlacklisted(kind, value string) bool {
+	value, err := ombstore.NormBlacklistValue(kind, value)
+	return err == nil && db.listed(kind, value)
+}
+
+// bltnWithheld is true when the bulletin's txid, its author or any of its
+// tags are blacklisted.
+func (db *Record) bltnWithheld(b *memBltn) bool {
+	if db.listed(ombstore.BlacklistTxid, b.txid) || db.listed(ombstore.BlacklistAuthor, b.author) {
+		return true
+	}
+	for _, tag := range b.tags {
+		if db.listed(ombstore.BlacklistTag, strings.ToLower(tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// endoWithheld is true when the endorsement's txid or its author are
+// blacklisted.
+func (db *Record) endoWithheld(e *memEndo) bool {
+	return db.listed(ombstore.BlacklistTxid, e.txid) || db.listed(ombstore.BlacklistAuthor, e.author)
+}
+
+// UpdateReputation works like pubrecdb.PublicRecord.UpdateReputation.
+func (db *Record) UpdateReputation() error {
+	db.mu.Lock()
+	db.updateReputation()
+	db.mu.Unlock()
+	return nil
+}
+
+// updateReputation ranks every author again the same way the sql record
+// does.
+func (db *Record) updateReputation() {
+	g := ombutil.NewRepGraph()
+
+	first := make(map[string]int32)
+	seen := func(author string, blk string) {
+		h := db.blocks[blk].height
+		if f, ok := first[author]; !ok || h < f {
+			first[author] = h
+		}
+	}
+	for _, b := range db.bltns {
+		if !db.bltnWithheld(b) {
+			seen(b.author, b.block)
+		}
+	}
+	for _, e := range db.endos {
+		if !db.endoWithheld(e) {
+			seen(e.author, e.block)
+		}
+	}
+
+	if tip := db.tip(); tip != nil {
+		for author, h := range first {
+			age := tip.height - h
+			if age > ombstore.RepTrustBlocks {
+				age = ombstore.RepTrustBlocks
+			}
+			g.AddAuthor(author, float64(1+age))
+		}
+	}
+
+	type edge struct {
+		from, to string
+	}
+	edges := make(map[edge]map[string]bool)
+	for _, e := range db.endos {
+		b, ok := db.bltns[e.bid]
+		if !ok || e.author == b.author || db.endoWithheld(e) || db.bltnWithheld(b) {
+			continue
+		}
+		k := edge{e.author, b.author}
+		if _, ok := edges[k]; !ok {
+			edges[k] = make(map[string]bool)
+		}
+		edges[k][e.bid] = true
+	}
+	for k, bids := range edges {
+		g.AddEdge(k.from, k.to, float64(len(bids)))
+	}
+
+	db.reputation = g.Rank(db.reputation)
+}
+
+// tip returns the block with the greatest height or nil when the record is
+// empty.
+func (db *Record) tip() *memBlock {
+	var tip *memBlock
+	for _, b := range db.blocks {
+		if tip == nil || b.height > tip.height {
+			tip = b
+		}
+	}
+	return tip
+}
+
+// GetDBStatus reports on the record like pubrecdb.PublicRecord.GetDBStatus. A
+// Record has no schema version, takes up no file and is never checked for
+// integrity.
+func (db *Record) GetDBStatus() (*ombjson.DBStatus, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	status := &ombjson.DBStatus{
+		Gaps:       []*ombjson.HeightGap{},
+		NumHeaders: int64(len(db.blocks)),
+	}
+
+	var numTags, numLocs int64
+	for _, b := range db.bltns {
+		numTags += int64(len(b.tags))
+		if b.loc != nil {
+			numLocs++
+		}
+	}
+	for _, e := range db.endos {
+		if _, ok := db.bltns[e.bid]; ok {
+			continue
+		}
+		status.NumOrphanEndos++
+		if db.nonRecord[e.txid] {
+			status.NumNonRecordEndos++
+		}
+	}
+	status.NumPendingEndos = status.NumOrphanEndos - status.NumNonRecordEndos
+
+	status.RowCounts = map[string]int64{
+		"blocks":        int64(len(db.blocks)),
+		"bulletins":     int64(len(db.bltns)),
+		"endorsements":  int64(len(db.endos)),
+		"tags":          numTags,
+		"bltn_locs":     numLocs,
+		"blacklist":     int64(len(db.blacklist)),
+		"merkle_proofs": int64(len(db.proofs)),
+		"raw_txs":       0,
+		"orphan_endos":  status.NumOrphanEndos,
+		"reputation":    int64(len(db.reputation)),
+	}
+
+	heights := []int32{}
+	for _, b := range db.blocks {
+		heights = append(heights, b.height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	if len(heights) == 0 {
+		return status, nil
+	}
+
+	for i := 1; i < len(heights); i++ {
+		if heights[i] > heights[i-1]+1 {
+			gap := &ombjson.HeightGap{Start: heights[i-1] + 1, Stop: heights[i] - 1}
+			status.Gaps = append(status.Gaps, gap)
+		}
+	}
+
+	tip := db.tip()
+	status.TipHeight = tip.height
+	for _, b := range db.blocks {
+		if b.height == heights[0] {
+			status.PegBlock = b.ref()
+		}
+	}
+
+	want := int64(status.TipHeight-status.PegBlock.Height) + 1
+	status.Synced = len(status.Gaps) == 0 && status.NumHeaders == want
+
+	return status, nil
+}
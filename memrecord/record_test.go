@@ -0,0 +1,186 @@
+package memrecord_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/memrecord"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+func TestNew(t *testing.T) {
+	db, err := memrecord.New(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk, err := db.GetBlockTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blk.Head.Hash != peg.GetStartBlock().Sha().String() {
+		t.Fatal(spw(blk))
+	}
+
+	if _, err := memrecord.New(&chaincfg.RegressionNetParams); err == nil {
+		t.Fatal("Record made for a network without a peg")
+	}
+}
+
+func TestInsertUBlockConflict(t *testing.T) {
+	rec := setupRecord(t)
+
+	tip := rec.blocks[len(rec.blocks)-1]
+	if err, ok := rec.db.InsertUBlock(&ombutil.UBlock{Block: tip}); ok || err != memrecord.ErrConflict {
+		t.Fatalf("Stored block twice: %v", err)
+	}
+
+	// A block that does not follow the tip.
+	lost := btcutil.NewBlock(&wire.MsgBlock{
+		Header: wire.BlockHeader{PrevBlock: *newSha(txid(1)), Timestamp: testTs},
+	})
+	lost.SetHeight(tip.Height() + 1)
+	if err, ok := rec.db.InsertUBlock(&ombutil.UBlock{Block: lost}); ok || err != memrecord.ErrMissingBlock {
+		t.Fatalf("Stored block without its parent: %v", err)
+	}
+
+	// Nothing is stored when one of the records is already in the record.
+	next := rec.addBlock(t)
+	ublk := &ombutil.UBlock{
+		Block:     next,
+		Bulletins: []*ombutil.Bulletin{rec.bltns[0]},
+	}
+	if err, ok := rec.db.InsertUBlock(ublk); ok || err != memrecord.ErrConflict {
+		t.Fatalf("Stored bulletin twice: %v", err)
+	}
+	if _, err := rec.db.GetBlock(next.Sha()); err != sql.ErrNoRows {
+		t.Fatalf("Block of a failed insert was stored: %v", err)
+	}
+}
+
+func TestDeleteBlockTip(t *testing.T) {
+	rec := setupRecord(t)
+	a, b, c := rec.blocks[0], rec.blocks[1], rec.blocks[2]
+
+	if err, ok := rec.db.DeleteBlockTip(a.Sha()); ok || err != ombstore.ErrBlockNotTip {
+		t.Fatalf("Deleting a block below the tip returned: %v", err)
+	}
+
+	if err, ok := rec.db.DeleteBlockTip(c.Sha()); err != nil || !ok {
+		t.Fatal(err)
+	}
+	blk, err := rec.db.GetBlockTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blk.Head.Hash != b.Sha().String() {
+		t.Fatal(spw(blk))
+	}
+	if _, err := rec.db.GetBulletin(newSha(txid(3))); err != sql.ErrNoRows {
+		t.Fatalf("Bulletin of a deleted block returned: %v", err)
+	}
+	if _, err := rec.db.GetEndorsement(newSha(txid(4))); err != sql.ErrNoRows {
+		t.Fatalf("Endorsement of a deleted block returned: %v", err)
+	}
+
+	// bltn(1) goes with block a.
+	if err := rec.db.DropAfterBlockBySha(peg.GetStartBlock().Sha()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.db.GetBulletin(newSha(txid(1))); err != sql.ErrNoRows {
+		t.Fatalf("Dropped bulletin returned: %v", err)
+	}
+}
+
+func TestBlacklist(t *testing.T) {
+	rec := setupRecord(t)
+
+	entry := &ombjson.BlacklistEntry{
+		Kind:   ombstore.BlacklistTag,
+		Value:  "Lambs",
+		Reason: "test",
+	}
+	if err, ok := rec.db.InsertBlacklistEntry(entry); err != nil || !ok {
+		t.Fatal(err)
+	}
+
+	page, err := rec.db.GetTag(ombutil.Tag("#lambs"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Bulletins) != 0 || !page.Withheld {
+		t.Fatal(spw(page))
+	}
+	if _, err := rec.db.GetBulletin(newSha(txid(2))); err != ombstore.ErrWithheld {
+		t.Fatalf("Withheld bulletin returned: %v", err)
+	}
+
+	// The closest bulletin is withheld without taking up the only place.
+	bltns, withheld, err := rec.db.GetNearbyBltnsByDist(10, 10, 2000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bltns) != 1 || bltns[0].Txid != txid(1) || !withheld {
+		t.Fatal(spw(bltns))
+	}
+
+	list, err := rec.db.GetBlacklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Value != "#lambs" {
+		t.Fatal(spw(list))
+	}
+
+	if err, ok := rec.db.DeleteBlacklistEntry(ombstore.BlacklistTag, "lambs"); err != nil || !ok {
+		t.Fatal(err)
+	}
+	if _, err := rec.db.GetBulletin(newSha(txid(2))); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := &ombjson.BlacklistEntry{Kind: ombstore.BlacklistTxid, Value: "nothex"}
+	if err, ok := rec.db.InsertBlacklistEntry(bad); ok || err != ombstore.ErrBadBlacklistEntry {
+		t.Fatalf("Malformed entry was stored: %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	rec := setupRecord(t)
+
+	sub := rec.db.Subscribe(ombstore.KindFilter(ombstore.BulletinAdded))
+	defer sub.Close()
+
+	blk := rec.addBlock(t)
+	rec.bltns = append(rec.bltns, fakeBltn(6, blk, authorB, "Found the sheep #farm", nil))
+	rec.insert(t, blk)
+
+	ev := <-sub.Events()
+	if ev.Kind != ombstore.BulletinAdded || ev.Bulletin.Txid != txid(6) ||
+		ev.Block.Hash != blk.Sha().String() {
+		t.Fatal(spw(ev))
+	}
+	select {
+	case ev := <-sub.Events():
+		t.Fatalf("Filtered event was delivered: %s", spw(ev))
+	default:
+	}
+
+	sub.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Fatal("Closed subscription got an event")
+	}
+	if sub.Err() != nil {
+		t.Fatal(sub.Err())
+	}
+}
+
+func newSha(s string) *wire.ShaHash {
+	h, _ := wire.NewShaHashFromStr(s)
+	return h
+}
@@ -0,0 +1,166 @@
+package memrecord_test
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/soapboxsys/ombudslib/memrecord"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+// The authors of the records in the test record.
+const (
+	authorA = "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+	authorB = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+)
+
+// The time the first test block was mined. It is on the hour so that the
+// three blocks fall into the same hour. Each block after it comes ten minutes
+// later.
+var testTs = time.Unix(1499997600, 0)
+
+// testRecord holds a record along with what was stored in it.
+type testRecord struct {
+	db     *memrecord.Record
+	blocks []*btcutil.Block
+	bltns  []*ombutil.Bulletin
+	endos  []*ombutil.Endorsement
+}
+
+// setupRecord returns a record with three blocks on top of the peg block:
+//
+//	a: bltn(1) by authorA at 0.01, 0.01 tagged #lambs
+//	b: bltn(2) by authorB at 10, 10 tagged #Lambs and #farm
+//	c: bltn(3) by authorA without a location or tags, endo(4) of bltn(1) by
+//	   authorB and endo(5) by authorA of a tx that is not in the record
+//
+// Nothing of it touches the filesystem.
+func setupRecord(t *testing.T) *testRecord {
+	db, err := memrecord.New(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &testRecord{db: db}
+
+	a := rec.addBlock(t)
+	rec.bltns = append(rec.bltns, fakeBltn(1, a, authorA, "Lambs in the field #lambs", fakeLoc(0.01, 0.01)))
+	rec.insert(t, a)
+
+	b := rec.addBlock(t)
+	rec.bltns = append(rec.bltns, fakeBltn(2, b, authorB, "Lost a sheep #Lambs #farm", fakeLoc(10, 10)))
+	rec.insert(t, b)
+
+	c := rec.addBlock(t)
+	rec.bltns = append(rec.bltns, fakeBltn(3, c, authorA, "Nothing to see here", nil))
+	rec.endos = append(rec.endos,
+		fakeEndo(4, c, authorB, rec.bltns[0].Tx.TxSha()),
+		fakeEndo(5, c, authorA, fakeMsgTx(99).TxSha()))
+	rec.insert(t, c)
+
+	return rec
+}
+
+// addBlock returns the next block of the test chain.
+func (rec *testRecord) addBlock(t *testing.T) *btcutil.Block {
+	prev, height := peg.GetStartBlock().Sha(), peg.StartHeight+1
+	if n := len(rec.blocks); n > 0 {
+		prev, height = rec.blocks[n-1].Sha(), rec.blocks[n-1].Height()+1
+	}
+	msgBlk := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			PrevBlock: *prev,
+			Timestamp: testTs.Add(time.Duration(len(rec.blocks)) * 10 * time.Minute),
+		},
+	}
+	blk := btcutil.NewBlock(msgBlk)
+	blk.SetHeight(height)
+	rec.blocks = append(rec.blocks, blk)
+	return blk
+}
+
+// insert mines the records that go with the block into it and stores it.
+func (rec *testRecord) insert(t *testing.T, blk *btcutil.Block) {
+	msgBlk := blk.MsgBlock()
+	ublk := &ombutil.UBlock{Block: blk}
+	for _, bltn := range rec.bltns {
+		if bltn.Block == blk {
+			ublk.Bulletins = append(ublk.Bulletins, bltn)
+			msgBlk.AddTransaction(bltn.Tx)
+		}
+	}
+	for _, endo := range rec.endos {
+		if endo.Block == blk {
+			ublk.Endorsements = append(ublk.Endorsements, endo)
+			msgBlk.AddTransaction(endo.Tx)
+		}
+	}
+	store := blockchain.BuildMerkleTreeStore(blk.Transactions())
+	if len(store) > 0 {
+		msgBlk.Header.MerkleRoot = *store[len(store)-1]
+	}
+	if err, ok := rec.db.InsertUBlock(ublk); err != nil || !ok {
+		t.Fatalf("Block %s was not stored: %v", blk.Sha(), err)
+	}
+}
+
+func fakeLoc(lat, lon float64) *ombwire.Location {
+	h := 0.0
+	return &ombwire.Location{Lat: &lat, Lon: &lon, H: &h}
+}
+
+func fakeBltn(seed int, blk *btcutil.Block, author, msg string, loc *ombwire.Location) *ombutil.Bulletin {
+	ts := uint64(blk.MsgBlock().Header.Timestamp.Unix())
+	return &ombutil.Bulletin{
+		Tx:     fakeMsgTx(seed),
+		Author: ombutil.Author(author),
+		Wire: &ombwire.Bulletin{
+			Message:   &msg,
+			Timestamp: &ts,
+			Location:  loc,
+		},
+		Block: blk,
+	}
+}
+
+func fakeEndo(seed int, blk *btcutil.Block, author string, bid wire.ShaHash) *ombutil.Endorsement {
+	ts := uint64(blk.MsgBlock().Header.Timestamp.Unix())
+	return &ombutil.Endorsement{
+		Tx:     fakeMsgTx(seed),
+		Author: ombutil.Author(author),
+		Wire: &ombwire.Endorsement{
+			Bid:       bid.Bytes(),
+			Timestamp: &ts,
+		},
+		Block: blk,
+	}
+}
+
+// fakeMsgTx returns a tx that hashes to a different value for every nonce.
+func fakeMsgTx(nonce int) *wire.MsgTx {
+	msgTx := wire.NewMsgTx()
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: 0xffffffff},
+		SignatureScript:  []byte{0x04, 0x31, 0xdc, 0x00, 0x1b, 0x01, 0x62},
+		Sequence:         0xffffffff,
+	})
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(nonce))
+	msgTx.AddTxOut(&wire.TxOut{Value: 5000000000, PkScript: b})
+	return msgTx
+}
+
+func txid(seed int) string {
+	return fakeMsgTx(seed).TxSha().String()
+}
+
+func spw(t interface{}) string {
+	return spew.Sdump(t)
+}
@@ -0,0 +1,93 @@
+package ombjson
+
+// The JSON-LD context of every ActivityStreams document and the collection
+// that addresses a public object. See: https://www.w3.org/TR/activitystreams-core/
+const (
+	ActivityStreams = "https://www.w3.org/ns/activitystreams"
+	PublicAudience  = ActivityStreams + "#Public"
+)
+
+// The context of actors, which also defines their publicKey.
+var ActorContext = []string{ActivityStreams, "https://w3id.org/security/v1"}
+
+// A WebFinger description of an account. See: https://tools.ietf.org/html/rfc7033
+type WebFinger struct {
+	Subject string           `json:"subject"`
+	Aliases []string         `json:"aliases,omitempty"`
+	Links   []*WebFingerLink `json:"links"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+// The key other servers check the signatures of an actor's requests with.
+type PublicKey struct {
+	Id           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// An ActivityPub actor. Ombuds authors are presented as Persons.
+type Actor struct {
+	Context           interface{} `json:"@context,omitempty"`
+	Id                string      `json:"id"`
+	Type              string      `json:"type"`
+	PreferredUsername string      `json:"preferredUsername"`
+	Name              string      `json:"name,omitempty"`
+	Summary           string      `json:"summary,omitempty"`
+	Url               string      `json:"url,omitempty"`
+	Inbox             string      `json:"inbox"`
+	Outbox            string      `json:"outbox,omitempty"`
+	Followers         string      `json:"followers,omitempty"`
+	PublicKey         *PublicKey  `json:"publicKey,omitempty"`
+}
+
+// A hashtag or a place attached to an object.
+type APTag struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Href string `json:"href,omitempty"`
+}
+
+type Place struct {
+	Type      string  `json:"type"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude,omitempty"`
+}
+
+// An ActivityStreams object or activity. Bulletins are Notes that are
+// published with a Create and endorsements are Likes of the bulletin's Note.
+// Object holds either the id of the object an activity acts on or the object
+// itself.
+type APObject struct {
+	Context      interface{} `json:"@context,omitempty"`
+	Id           string      `json:"id,omitempty"`
+	Type         string      `json:"type"`
+	Actor        string      `json:"actor,omitempty"`
+	AttributedTo string      `json:"attributedTo,omitempty"`
+	Content      string      `json:"content,omitempty"`
+	Published    string      `json:"published,omitempty"`
+	Url          string      `json:"url,omitempty"`
+	To           []string    `json:"to,omitempty"`
+	Cc           []string    `json:"cc,omitempty"`
+	Tag          []*APTag    `json:"tag,omitempty"`
+	Location     *Place      `json:"location,omitempty"`
+	Object       interface{} `json:"object,omitempty"`
+}
+
+// An OrderedCollection or one of its pages.
+type APCollection struct {
+	Context      interface{} `json:"@context,omitempty"`
+	Id           string      `json:"id"`
+	Type         string      `json:"type"`
+	TotalItems   int64       `json:"totalItems,omitempty"`
+	First        string      `json:"first,omitempty"`
+	PartOf       string      `json:"partOf,omitempty"`
+	Next         string      `json:"next,omitempty"`
+	Prev         string      `json:"prev,omitempty"`
+	OrderedItems []*APObject `json:"orderedItems,omitempty"`
+}
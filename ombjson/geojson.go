@@ -0,0 +1,90 @@
+package ombjson
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// A GeoJSON position. The first two values are the longitude and latitude in
+// that order. See: https://tools.ietf.org/html/rfc7946#section-3.1.1
+type Position []float64
+
+// A GeoJSON geometry object. The coordinates are left raw since their shape
+// depends on the type of the geometry.
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// Polygons returns the linear rings of every polygon in a Polygon or
+// MultiPolygon geometry. The first ring of each polygon is its exterior and
+// any that follow are holes.
+func (g *Geometry) Polygons() ([][][]Position, error) {
+	switch g.Type {
+	case "Polygon":
+		var poly [][]Position
+		if err := json.Unmarshal(g.Coordinates, &poly); err != nil {
+			return nil, err
+		}
+		return [][][]Position{poly}, nil
+	case "MultiPolygon":
+		var polys [][][]Position
+		if err := json.Unmarshal(g.Coordinates, &polys); err != nil {
+			return nil, err
+		}
+		return polys, nil
+	default:
+		return nil, fmt.Errorf("Geometry type %q is not a polygon", g.Type)
+	}
+}
+
+// NewPoint returns a GeoJSON Point geometry at the location. The location's
+// height is included as the third value of the position.
+func NewPoint(loc *Location) *Geometry {
+	b, _ := json.Marshal(Position{loc.Lon, loc.Lat, loc.H})
+	return &Geometry{
+		Type:        "Point",
+		Coordinates: b,
+	}
+}
+
+// A GeoJSON Feature that holds a single bulletin in its properties. Bulletins
+// without a location have a null geometry.
+type Feature struct {
+	Type       string    `json:"type"`
+	Id         string    `json:"id"`
+	Geometry   *Geometry `json:"geometry"`
+	Properties *Bulletin `json:"properties"`
+}
+
+// A GeoJSON FeatureCollection of bulletins.
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+// NewFeature wraps a bulletin in a GeoJSON Feature identified by its txid.
+func NewFeature(bltn *Bulletin) *Feature {
+	f := &Feature{
+		Type:       "Feature",
+		Id:         bltn.Txid,
+		Properties: bltn,
+	}
+	if bltn.Location != nil {
+		f.Geometry = NewPoint(bltn.Location)
+	}
+	return f
+}
+
+// NewFeatureCollection returns a FeatureCollection that contains a Feature
+// for every bulletin in the order they were passed.
+func NewFeatureCollection(bltns []*Bulletin) *FeatureCollection {
+	fc := &FeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []*Feature{},
+	}
+	for _, bltn := range bltns {
+		fc.Features = append(fc.Features, NewFeature(bltn))
+	}
+	return fc
+}
@@ -0,0 +1,72 @@
+package ombjson_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+func TestNewPoint(t *testing.T) {
+	g := ombjson.NewPoint(&ombjson.Location{Lat: 61.2, Lon: -149.9, H: 30})
+	if g.Type != "Point" {
+		t.Fatalf("Wrong geometry type: %s", g.Type)
+	}
+
+	var pos ombjson.Position
+	if err := json.Unmarshal(g.Coordinates, &pos); err != nil {
+		t.Fatal(err)
+	}
+	// GeoJSON puts the longitude first.
+	if len(pos) != 3 || pos[0] != -149.9 || pos[1] != 61.2 || pos[2] != 30 {
+		t.Fatalf("Position is out of order: %v", pos)
+	}
+}
+
+func TestNewFeatureCollection(t *testing.T) {
+	bltns := []*ombjson.Bulletin{
+		{Txid: "aa", Location: &ombjson.Location{Lat: 1, Lon: 2}},
+		{Txid: "bb"},
+	}
+
+	b, err := json.Marshal(ombjson.NewFeatureCollection(bltns))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Type       string          `json:"type"`
+			Id         string          `json:"id"`
+			Geometry   json.RawMessage `json:"geometry"`
+			Properties struct {
+				Txid string `json:"txid"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(b, &fc); err != nil {
+		t.Fatal(err)
+	}
+
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 {
+		t.Fatalf("Bad collection: %s", b)
+	}
+	for i, f := range fc.Features {
+		if f.Type != "Feature" || f.Id != bltns[i].Txid || f.Properties.Txid != bltns[i].Txid {
+			t.Fatalf("Bad feature %d: %s", i, b)
+		}
+	}
+	if string(fc.Features[0].Geometry) != `{"type":"Point","coordinates":[2,1,0]}` {
+		t.Fatalf("Bad geometry: %s", fc.Features[0].Geometry)
+	}
+	// A bulletin without a location keeps its feature with a null geometry.
+	if string(fc.Features[1].Geometry) != "null" {
+		t.Fatalf("Bulletin without a location has a geometry: %s", fc.Features[1].Geometry)
+	}
+
+	empty, _ := json.Marshal(ombjson.NewFeatureCollection(nil))
+	if string(empty) != `{"type":"FeatureCollection","features":[]}` {
+		t.Fatalf("Empty collection is not a list: %s", empty)
+	}
+}
@@ -1,9 +1,19 @@
 package ombjson
 
+// Cursors point at the pages on either side of a page of records. They are
+// opaque to clients and are passed back as they are to fetch the next or
+// previous page. An empty cursor means there is nothing in that direction.
+type Cursors struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
 type BltnPage struct {
 	Start     string      `json:"start"`
 	Stop      string      `json:"stop"`
 	Bulletins []*Bulletin `json:"bulletins"`
+	Withheld  bool        `json:"withheld,omitempty"` // Set when blacklisted items were left out
+	Cursors
 }
 
 type Page struct {
@@ -11,4 +21,14 @@ type Page struct {
 	Stop         string         `json:"stop"`
 	Bulletins    []*Bulletin    `json:"bulletins"`
 	Endorsements []*Endorsement `json:"endorsements"`
+	Withheld     bool           `json:"withheld,omitempty"`
+	Cursors
+}
+
+type EndoPage struct {
+	Start        string         `json:"start"`
+	Stop         string         `json:"stop"`
+	Endorsements []*Endorsement `json:"endorsements"`
+	Withheld     bool           `json:"withheld,omitempty"`
+	Cursors
 }
@@ -22,19 +22,30 @@ type Bulletin struct {
 	Author       string         `json:"author"`
 	Message      string         `json:"msg"`
 	Timestamp    int64          `json:"timestamp",omitempty`
-	NumEndos     int32          `json:"numEndos"`
+	NumEndos     int32          `json:"numEndos"`              // Unique authors that endorsed it
+	NumRawEndos  int32          `json:"numRawEndos,omitempty"` // Every endorsement including repeats
 	BlockRef     *BlockRef      `json:"blkref",omitempty`
 	Location     *Location      `json:"loc",omitempty`
 	Endorsements []*Endorsement `json:"endos",omitempty`
+	Proof        *MerkleProof   `json:"proof,omitempty"`
 }
 
 type Endorsement struct {
-	Txid       string    `json:"txid"`       // txid of the endorsements transaction
-	Author     string    `json:"author"`     // the creator of the endorsement
-	Bid        string    `json:"bid"`        // txid of the endorsed bulletin
-	Timestamp  int64     `json:"timestamp"`  // User generated timestamp
-	BltnExists bool      `json:"bltnExists"` // Indicates existence of Bid in the record
-	BlockRef   *BlockRef `json:"blkref",omitempty`
+	Txid       string       `json:"txid"`                // txid of the endorsements transaction
+	Author     string       `json:"author"`              // the creator of the endorsement
+	Bid        string       `json:"bid"`                 // txid of the endorsed bulletin
+	Timestamp  int64        `json:"timestamp"`           // User generated timestamp
+	BltnExists bool         `json:"bltnExists"`          // Indicates existence of Bid in the record
+	NonRecord  bool         `json:"nonRecord,omitempty"` // Set when Bid is known not to be a bulletin
+	BlockRef   *BlockRef    `json:"blkref",omitempty`
+	Proof      *MerkleProof `json:"proof,omitempty"`
+}
+
+// Proves that a record's transaction was mined in the block it references
+type MerkleProof struct {
+	Header string   `json:"header"` // The serialized block header as hex
+	Index  int      `json:"index"`  // The position of the tx in the block
+	Branch []string `json:"branch"` // The hashes from the tx's sibling up to the root
 }
 
 // Holds meta information about a single unique block
@@ -52,13 +63,18 @@ type Block struct {
 	Head         *BlockHead     `json:"head"`
 	Bulletins    []*Bulletin    `json:"bltns"`
 	Endorsements []*Endorsement `json:"endos"`
+	Withheld     bool           `json:"withheld,omitempty"` // Set when blacklisted items were left out
 }
 
 // Holds meta information about a single author
 type AuthorSummary struct {
-	Address    string `json:"addr"`
-	FirstBlkTs int64  `json:"firstBlkTs,omitempty"`
-	LastBlkTs  int64  `json:"lastBlkTs,omitempty"`
+	Address    string  `json:"addr"`
+	FirstBlkTs int64   `json:"firstBlkTs,omitempty"`
+	LastBlkTs  int64   `json:"lastBlkTs,omitempty"`
+	NumBltns   int32   `json:"numBltns"`
+	NumEndos   int32   `json:"numEndos"`   // Endorsements the author sent
+	NumRecvd   int32   `json:"numRecvd"`   // Unique endorsers of each of the author's bulletins
+	Reputation float64 `json:"reputation"` // Rank in the endorsement graph, 1 is average
 }
 
 // Contains info about an author and posts by that author
@@ -66,6 +82,16 @@ type AuthorResp struct {
 	Summary      *AuthorSummary `json:"summary"`
 	Bulletins    []*Bulletin    `json:"bltns",omitempty`
 	Endorsements []*Endorsement `json:"endos",omitempty`
+	Withheld     bool           `json:"withheld,omitempty"`
+	Cursors
+}
+
+// Contains a page of the authors in the record in the order they were sorted
+// by
+type AuthorPage struct {
+	Sort    string           `json:"sort"`
+	Authors []*AuthorSummary `json:"authors"`
+	Cursors
 }
 
 // Holds meta information about the server
@@ -77,15 +103,52 @@ type Status struct {
 	UptimeH    string     `json:"uptimeh"`    // The same as above but human readable
 }
 
+// A run of heights that are missing from the record
+type HeightGap struct {
+	Start int32 `json:"start"`
+	Stop  int32 `json:"stop"` // The last missing height
+}
+
+// Holds the result of a SQLite integrity check
+type IntegrityCheck struct {
+	Ok        bool     `json:"ok"`
+	Messages  []string `json:"messages,omitempty"` // The problems found when not ok
+	Timestamp int64    `json:"timestamp"`          // When the check was run
+}
+
+// Holds information about the health of the public record
+type DBStatus struct {
+	SchemaVersion     string           `json:"schemaVersion"`
+	FileSize          int64            `json:"fileSize"` // The size of the DB in bytes
+	RowCounts         map[string]int64 `json:"rowCounts"`
+	PegBlock          *BlockRef        `json:"pegBlk"` // The block the record starts from
+	TipHeight         int32            `json:"tipHeight"`
+	NumHeaders        int64            `json:"numHeaders"`
+	Gaps              []*HeightGap     `json:"gaps"`
+	NumOrphanEndos    int64            `json:"numOrphanEndos"`    // Endorsements of bulletins not in the record
+	NumPendingEndos   int64            `json:"numPendingEndos"`   // Orphans still waiting for their bulletin
+	NumNonRecordEndos int64            `json:"numNonRecordEndos"` // Orphans whose bid is not a bulletin
+	Synced            bool             `json:"synced"`            // Set when every height from the peg to the tip is stored
+	Integrity         *IntegrityCheck  `json:"integrity,omitempty"`
+}
+
 // Holds summary information about a given board
 type BoardSummary struct {
 	Name       string `json:"name"`
 	NumBltns   uint64 `json:"numBltns"`
 	CreatedAt  int64  `json:"createdAt"`  // The block timestamp of when this board was started.
-	LastActive int64  `json:"lastActive"` // The bulletin timestamp of the latest post.
+	LastActive int64  `json:"lastActive"` // The block timestamp of the latest post.
 	CreatedBy  string `json:"createdBy"`
 }
 
+// Contains a board's summary and a page of the bulletins posted to it
+type BoardResp struct {
+	Summary   *BoardSummary `json:"summary"`
+	Bulletins []*Bulletin   `json:"bltns"`
+	Withheld  bool          `json:"withheld,omitempty"`
+	Cursors
+}
+
 // Holds statistics about the public record
 type Statistics struct {
 	StartTs  int64 `json:"startTs"`
@@ -94,3 +157,42 @@ type Statistics struct {
 	NumBltns int64 `json:"numBltns"`
 	NumEndos int64 `json:"numEndos"`
 }
+
+// Holds the counts of what was stored in the record during one bucket of an
+// activity series
+type Activity struct {
+	StartTs    int64 `json:"startTs"`
+	StopTs     int64 `json:"stopTs"`
+	NumBlks    int64 `json:"numBlks"`
+	NumBltns   int64 `json:"numBltns"`
+	NumEndos   int64 `json:"numEndos"`
+	NumAuthors int64 `json:"numAuthors"` // Authors that sent a bulletin or an endorsement
+	NumNewTags int64 `json:"numNewTags"` // Tags that were used for the first time
+}
+
+// Contains the activity in the record over a period cut into buckets
+type ActivitySeries struct {
+	Bucket  string      `json:"bucket"` // One of hour, day or week
+	StartTs int64       `json:"startTs"`
+	StopTs  int64       `json:"stopTs"`
+	Buckets []*Activity `json:"buckets"`
+}
+
+// A single entry in a relay's moderation blacklist
+type BlacklistEntry struct {
+	Kind      string `json:"kind"` // One of txid, author or tag
+	Value     string `json:"value"`
+	Reason    string `json:"reason"`
+	Timestamp int64  `json:"timestamp"` // When the entry was added
+}
+
+// A single message pushed to clients of the live stream. Kind is one of
+// bulletinAdded, endorsementAdded, bulletinRemoved, endorsementRemoved or
+// resync. Cursor marks the record in the latest list so that a client can
+// resume the stream from it.
+type StreamEvent struct {
+	Kind        string       `json:"kind"`
+	Cursor      string       `json:"cursor,omitempty"`
+	Bulletin    *Bulletin    `json:"bltn,omitempty"`
+	Endorsement *Endorsement `json:"endo,omitempty"`
+}
@@ -1,28 +1,10 @@
 package ombjson
 
 type Tag struct {
-	Value   string `json:"val"`
-	FirstTs int64  `json:"ts"`
-	Count   int64  `json:"num"`
-	Score   int64  `json:"score"`
-}
-
-func NewTag(value string, cnt, ts int64) Tag {
-	s := tagScore(cnt, ts)
-	return Tag{
-		Value:   value,
-		FirstTs: ts,
-		Count:   cnt,
-		Score:   s,
-	}
-}
-
-// tagScore uses the ratio of time passed since the peg block along with the
-// passed timestamp to compute the tags 'score'
-func tagScore(cnt, ts int64) int64 {
-	pegStart := 1451606601.0
-	var r = int64((float64(ts) - pegStart) / 86000.0)
-	return cnt + r
+	Value   string  `json:"val"`
+	FirstTs int64   `json:"ts"`
+	Count   int64   `json:"num"`
+	Score   float64 `json:"score"`
 }
 
 type ByScore []*Tag
@@ -30,3 +12,24 @@ type ByScore []*Tag
 func (a ByScore) Len() int           { return len(a) }
 func (a ByScore) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByScore) Less(i, j int) bool { return a[i].Score > a[j].Score }
+
+// Holds a bulletin along with how much it is trending
+type TrendingBltn struct {
+	Bulletin *Bulletin `json:"bltn"`
+	Score    float64   `json:"score"`
+}
+
+// An author along with how many bulletins they tagged with a tag
+type TagAuthor struct {
+	Address  string `json:"addr"`
+	NumBltns int64  `json:"numBltns"`
+}
+
+// Holds everything known about a single tag
+type TagDetail struct {
+	Value      string          `json:"val"`
+	FirstUse   *Bulletin       `json:"firstUse"` // The first bulletin to use the tag
+	TopAuthors []*TagAuthor    `json:"topAuthors"`
+	Activity   *ActivitySeries `json:"activity"`
+	Related    []*Tag          `json:"related"` // Tags used on the same bulletins
+}
@@ -0,0 +1,66 @@
+package ombstore
+
+import (
+	"errors"
+	"time"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+// The widths of the buckets an activity series can be cut into.
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+var (
+	ErrBadSeries error = errors.New("activity series is malformed")
+
+	bucketWidths = map[string]time.Duration{
+		BucketHour: time.Hour,
+		BucketDay:  24 * time.Hour,
+		BucketWeek: 7 * 24 * time.Hour,
+	}
+)
+
+// BucketWidth returns how much time a bucket of an activity series covers.
+func BucketWidth(bucket string) (time.Duration, bool) {
+	width, ok := bucketWidths[bucket]
+	return width, ok
+}
+
+// NewActivitySeries cuts the time between start and end into empty buckets
+// the way Store.GetActivitySeries describes and returns the width of each. A
+// series can have at most max buckets.
+func NewActivitySeries(start, end time.Time, bucket string, max int) (*ombjson.ActivitySeries, time.Duration, error) {
+	width, ok := BucketWidth(bucket)
+	if !ok || !end.After(start) {
+		return nil, 0, ErrBadSeries
+	}
+
+	start = start.UTC().Truncate(width)
+	n := int((end.Sub(start) + width - 1) / width)
+	if n > max {
+		return nil, 0, ErrBadSeries
+	}
+
+	series := &ombjson.ActivitySeries{
+		Bucket:  bucket,
+		StartTs: start.Unix(),
+		StopTs:  end.Unix(),
+		Buckets: make([]*ombjson.Activity, n),
+	}
+	for i := range series.Buckets {
+		bStart := start.Add(time.Duration(i) * width)
+		bStop := bStart.Add(width)
+		if bStop.After(end) {
+			bStop = end
+		}
+		series.Buckets[i] = &ombjson.Activity{
+			StartTs: bStart.Unix(),
+			StopTs:  bStop.Unix(),
+		}
+	}
+	return series, width, nil
+}
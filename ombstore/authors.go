@@ -0,0 +1,39 @@
+package ombstore
+
+import (
+	"errors"
+	"time"
+)
+
+// The orders the author directory can be listed in. Every order goes from
+// the highest value to the lowest, so SortFirstSeen lists the newest authors
+// first.
+const (
+	SortPosts      = "posts"
+	SortEndorsed   = "endorsed"
+	SortFirstSeen  = "first"
+	SortLastActive = "active"
+)
+
+// RepTrustBlocks is the age in blocks at which an author is fully trusted.
+// That is about a month of blocks.
+const RepTrustBlocks = 4320
+
+var ErrBadSort error = errors.New("author sort order is unknown")
+
+// AuthorFilter narrows down the authors listed by GetAllAuthors. The zero
+// value lists every author.
+type AuthorFilter struct {
+	MinBltns    int       // The fewest bulletins an author can have sent
+	ActiveSince time.Time // The earliest an author can have last been active
+}
+
+// IsSort reports if sort is one of the orders the author directory can be
+// listed in.
+func IsSort(sort string) bool {
+	switch sort {
+	case SortPosts, SortEndorsed, SortFirstSeen, SortLastActive:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package ombstore
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+var ErrFellBehind error = errors.New("subscription fell behind the record")
+
+// The kinds of events a record publishes.
+type EventKind string
+
+const (
+	BlockConnected    EventKind = "blockConnected"
+	BlockDisconnected EventKind = "blockDisconnected"
+	BulletinAdded     EventKind = "bulletinAdded"
+	EndorsementAdded  EventKind = "endorsementAdded"
+)
+
+// The number of events a subscription holds before it falls behind.
+var subscriptionBuffer = 256
+
+// An Event tells subscribers about a change to the record. A connected block
+// is followed by an event for each of its bulletins and then one for each of
+// its endorsements. A disconnected block carries the records that went with
+// it. Withheld records are left out like they are from every query. Events
+// are shared between subscribers and must not be changed.
+type Event struct {
+	Kind EventKind
+
+	// Block is the block that was connected or disconnected or that the
+	// record was stored in.
+	Block *ombjson.BlockHead
+
+	// Bulletin is set on BulletinAdded and Endorsement on EndorsementAdded.
+	Bulletin    *ombjson.Bulletin
+	Endorsement *ombjson.Endorsement
+
+	// Bulletins and Endorsements are set on BlockDisconnected to the
+	// records that were removed along with the block.
+	Bulletins    []*ombjson.Bulletin
+	Endorsements []*ombjson.Endorsement
+}
+
+// An EventFilter picks the events a subscription gets. A nil filter lets
+// every event through.
+type EventFilter func(ev *Event) bool
+
+// KindFilter lets through the events of the kinds passed.
+func KindFilter(kinds ...EventKind) EventFilter {
+	return func(ev *Event) bool {
+		for _, k := range kinds {
+			if ev.Kind == k {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// A Subscription delivers the events published after it was made. A
+// subscriber that does not keep up is dropped: its channel is closed and Err
+// returns ErrFellBehind. It can then catch up with the paged queries and
+// subscribe again.
+type Subscription struct {
+	feed   *Feed
+	filter EventFilter
+	events chan *Event
+	err    error
+}
+
+// Events returns the channel the events are delivered on. It is closed once
+// the subscription ends.
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// Err returns why the subscription ended. It is nil while the subscription
+// is open and after it was closed by Close.
+func (s *Subscription) Err() error {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	s.feed.drop(s, nil)
+}
+
+// A Feed hands the events of a record to its subscribers. Publishing never
+// waits on a subscriber.
+type Feed struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// NewFeed returns a feed with no subscribers.
+func NewFeed() *Feed {
+	return &Feed{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe returns a subscription to the events that pass filter.
+func (f *Feed) Subscribe(filter EventFilter) *Subscription {
+	s := &Subscription{
+		feed:   f,
+		filter: filter,
+		events: make(chan *Event, subscriptionBuffer),
+	}
+	f.mu.Lock()
+	f.subs[s] = struct{}{}
+	f.mu.Unlock()
+	return s
+}
+
+// Active reports if anyone is subscribed. Events are only built when there
+// is someone to send them to.
+func (f *Feed) Active() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs) > 0
+}
+
+// drop ends the subscription with err. The caller holds the lock.
+func (f *Feed) drop(s *Subscription, err error) {
+	if _, ok := f.subs[s]; !ok {
+		return
+	}
+	delete(f.subs, s)
+	s.err = err
+	close(s.events)
+}
+
+// Publish hands the events to every subscriber whose filter lets them
+// through.
+func (f *Feed) Publish(evs []*Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for s := range f.subs {
+		for _, ev := range evs {
+			if s.filter != nil && !s.filter(ev) {
+				continue
+			}
+			select {
+			case s.events <- ev:
+			default:
+				f.drop(s, ErrFellBehind)
+			}
+			if _, ok := f.subs[s]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// PublishBlock publishes the events of a block that was connected or
+// disconnected. If the block could not be read back every subscriber is
+// dropped with the error, since they would otherwise miss its records.
+func (f *Feed) PublishBlock(kind EventKind, blk *ombjson.Block, err error) {
+	if err != nil {
+		f.End(err)
+		return
+	}
+	f.Publish(blockEvents(kind, blk))
+}
+
+// End drops every subscriber with err.
+func (f *Feed) End(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		f.drop(s, err)
+	}
+}
+
+// blockEvents returns the events of a block that was connected or
+// disconnected.
+func blockEvents(kind EventKind, blk *ombjson.Block) []*Event {
+	if kind == BlockDisconnected {
+		return []*Event{{
+			Kind:         BlockDisconnected,
+			Block:        blk.Head,
+			Bulletins:    blk.Bulletins,
+			Endorsements: blk.Endorsements,
+		}}
+	}
+
+	evs := []*Event{{Kind: BlockConnected, Block: blk.Head}}
+	for _, bltn := range blk.Bulletins {
+		evs = append(evs, &Event{Kind: BulletinAdded, Block: blk.Head, Bulletin: bltn})
+	}
+	for _, endo := range blk.Endorsements {
+		evs = append(evs, &Event{Kind: EndorsementAdded, Block: blk.Head, Endorsement: endo})
+	}
+	return evs
+}
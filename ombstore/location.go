@@ -0,0 +1,101 @@
+package ombstore
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrBadBBox error = errors.New("bounding box minLat is greater than maxLat")
+
+// Earth's radius in meters.
+const earthRadius = 6371000.0
+
+// A GeoBox is a range of latitudes and longitudes measured in degrees.
+type GeoBox struct {
+	MinLat, MaxLat float64
+	MinLon, MaxLon float64
+}
+
+// NewGeoBox returns the boxes that cover the passed latitudes and longitudes
+// within [-90, 90] and [-180, 180]. The longitudes are read eastward from
+// minLon to maxLon, so when maxLon is less than minLon or past 180 the range
+// crosses the antimeridian and it is split into two boxes. Otherwise both of
+// the returned boxes are the same.
+func NewGeoBox(minLat, minLon, maxLat, maxLon float64) (GeoBox, GeoBox) {
+	a := GeoBox{
+		MinLat: math.Max(minLat, -90),
+		MaxLat: math.Min(maxLat, 90),
+		MinLon: minLon,
+		MaxLon: maxLon,
+	}
+
+	if a.MaxLon < a.MinLon {
+		a.MaxLon += 360
+	}
+	if a.MaxLon-a.MinLon >= 360 {
+		a.MinLon, a.MaxLon = -180, 180
+		return a, a
+	}
+
+	// Shift the range so that it starts within [-180, 180).
+	shift := 360 * math.Floor((a.MinLon+180)/360)
+	a.MinLon -= shift
+	a.MaxLon -= shift
+
+	b := a
+	if a.MaxLon > 180 {
+		a.MaxLon = 180
+		b.MinLon, b.MaxLon = -180, b.MaxLon-360
+	}
+
+	return a, b
+}
+
+// BoundingBox returns the smallest boxes that contain every point within r
+// meters of lat, lon. The boxes are split along the antimeridian like those
+// from NewGeoBox. When the circle contains a pole every longitude is included.
+// The method is described here:
+// http://janmatuschek.de/LatitudeLongitudeBoundingCoordinates
+func BoundingBox(lat, lon, r float64) (GeoBox, GeoBox) {
+	ToRad := func(x float64) float64 {
+		return x * (math.Pi / 180)
+	}
+	ToDeg := func(x float64) float64 {
+		return x * (180 / math.Pi)
+	}
+
+	// The angular radius of the circle.
+	δ := r / earthRadius
+	φ := ToRad(lat)
+
+	minφ, maxφ := φ-δ, φ+δ
+	if minφ <= -math.Pi/2 || maxφ >= math.Pi/2 {
+		// A pole is inside of the circle.
+		return NewGeoBox(ToDeg(minφ), -180, ToDeg(maxφ), 180)
+	}
+
+	Δλ := ToDeg(math.Asin(math.Sin(δ) / math.Cos(φ)))
+	return NewGeoBox(ToDeg(minφ), lon-Δλ, ToDeg(maxφ), lon+Δλ)
+}
+
+// Distance uses the distance formula derived using the spherical law of cosines
+// to reasonablely accurate approximations of the distances between 'a' and
+// 'b' on the earth's surface in meters. The reference implementation lives at
+// this site:
+// http://www.movable-type.co.uk/scripts/latlong.html
+func Distance(a_lat, a_lon, b_lat, b_lon float64) float64 {
+	ToRad := func(x float64) float64 {
+		return x * (math.Pi / 180)
+	}
+	φ1 := ToRad(a_lat)
+	φ2 := ToRad(b_lat)
+	λ := ToRad(b_lon - a_lon)
+
+	R := earthRadius
+	z := math.Sin(φ1)*math.Sin(φ2) + math.Cos(φ1)*math.Cos(φ2)*math.Cos(λ)
+	// Rounding can push z just past 1 for identical points.
+	z = math.Max(-1, math.Min(1, z))
+	d := math.Acos(z) * R
+
+	return d
+}
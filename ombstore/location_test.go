@@ -0,0 +1,88 @@
+package ombstore
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceFormula(t *testing.T) {
+
+	// Pass known good values and see if the thing works
+	tests := []struct {
+		a_lat float64
+		a_lon float64
+		b_lat float64
+		b_lon float64
+		dist  int
+	}{
+		{44, 22, 51.5, -0.12, 1842197},
+		{44, 22, 10.02, 125, 10252779},
+	}
+
+	for _, test := range tests {
+		d := Distance(test.a_lat, test.a_lon, test.b_lat, test.b_lon)
+		if int(d) != int(test.dist) {
+			t.Fatalf("Expected: %d, got: %f", test.dist, d)
+		}
+	}
+}
+
+func TestBoundingBox(t *testing.T) {
+
+	tests := []struct {
+		lat float64
+		lon float64
+		r   float64
+		a   GeoBox
+		b   GeoBox
+	}{
+		// A box that needs no splitting.
+		{0, 0, 111195, GeoBox{-1, 1, -1, 1}, GeoBox{-1, 1, -1, 1}},
+		// A box that crosses the antimeridian.
+		{0, 179.5, 111195, GeoBox{-1, 1, 178.5, 180}, GeoBox{-1, 1, -180, -179.5}},
+		{0, -179.5, 111195, GeoBox{-1, 1, 179.5, 180}, GeoBox{-1, 1, -180, -178.5}},
+		// A circle that contains the north pole.
+		{89.5, 0, 111195, GeoBox{88.5, 90, -180, 180}, GeoBox{88.5, 90, -180, 180}},
+	}
+
+	near := func(x, y float64) bool {
+		return math.Abs(x-y) < 0.001
+	}
+
+	for _, test := range tests {
+		a, b := BoundingBox(test.lat, test.lon, test.r)
+		for _, pair := range [][2]GeoBox{{a, test.a}, {b, test.b}} {
+			got, want := pair[0], pair[1]
+			if !near(got.MinLat, want.MinLat) || !near(got.MaxLat, want.MaxLat) ||
+				!near(got.MinLon, want.MinLon) || !near(got.MaxLon, want.MaxLon) {
+				t.Fatalf("Expected: %v, got: %v", want, got)
+			}
+		}
+	}
+}
+
+func TestNewGeoBox(t *testing.T) {
+
+	tests := []struct {
+		minLat, minLon, maxLat, maxLon float64
+		a, b                           GeoBox
+	}{
+		{-1, -1, 1, 1, GeoBox{-1, 1, -1, 1}, GeoBox{-1, 1, -1, 1}},
+		// minLon greater than maxLon crosses the antimeridian.
+		{-1, 170, 1, -170, GeoBox{-1, 1, 170, 180}, GeoBox{-1, 1, -180, -170}},
+		// So does a range that runs past 180.
+		{-1, 170, 1, 190, GeoBox{-1, 1, 170, 180}, GeoBox{-1, 1, -180, -170}},
+		{-1, -190, 1, -170, GeoBox{-1, 1, 170, 180}, GeoBox{-1, 1, -180, -170}},
+		// Latitudes are clamped to the poles.
+		{-100, -10, 100, 10, GeoBox{-90, 90, -10, 10}, GeoBox{-90, 90, -10, 10}},
+		// Ranges wider than the globe cover every longitude.
+		{-1, -200, 1, 200, GeoBox{-1, 1, -180, 180}, GeoBox{-1, 1, -180, 180}},
+	}
+
+	for _, test := range tests {
+		a, b := NewGeoBox(test.minLat, test.minLon, test.maxLat, test.maxLon)
+		if a != test.a || b != test.b {
+			t.Fatalf("Expected: %v %v, got: %v %v", test.a, test.b, a, b)
+		}
+	}
+}
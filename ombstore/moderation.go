@@ -0,0 +1,47 @@
+package ombstore
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// The kinds of items that can be blacklisted.
+const (
+	BlacklistTxid   = "txid"
+	BlacklistAuthor = "author"
+	BlacklistTag    = "tag"
+)
+
+var (
+	ErrWithheld          error = errors.New("item was withheld by this relay")
+	ErrBadBlacklistEntry error = errors.New("blacklist entry is malformed")
+)
+
+// NormBlacklistValue checks that the value fits its kind and puts it in the
+// form it is stored in. Txids are lower case hex and tags start with a '#'
+// and are lower case.
+func NormBlacklistValue(kind, value string) (string, error) {
+	switch kind {
+	case BlacklistTxid:
+		txid, err := wire.NewShaHashFromStr(value)
+		if err != nil || len(value) != 2*wire.HashSize {
+			return "", ErrBadBlacklistEntry
+		}
+		return txid.String(), nil
+	case BlacklistAuthor:
+		if value == "" || strings.ContainsAny(value, " \t\n") {
+			return "", ErrBadBlacklistEntry
+		}
+		return value, nil
+	case BlacklistTag:
+		tag := strings.TrimPrefix(value, "#")
+		if tag == "" || strings.ContainsAny(tag, " \t\n#") {
+			return "", ErrBadBlacklistEntry
+		}
+		return "#" + strings.ToLower(tag), nil
+	default:
+		return "", ErrBadBlacklistEntry
+	}
+}
@@ -0,0 +1,165 @@
+package ombstore
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+var ErrBadCursor error = errors.New("cursor is malformed")
+
+// The number of records in a page when the caller does not ask for a limit.
+var DefaultPageLimit = 100
+
+// A Cursor marks a place in a list of records. Every list is ordered by block
+// height and then by txid, newest first, so a cursor stays put as new blocks
+// are added to the record.
+type Cursor struct {
+	Height int32
+	Txid   string
+	// Before asks for the records that come before the cursor in the list
+	// instead of the ones that come after it.
+	Before bool
+}
+
+// ParseCursor decodes a cursor that was handed out with a page.
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+
+	parts := strings.SplitN(string(b), ":", 3)
+	if len(parts) != 3 || (parts[0] != "a" && parts[0] != "b") {
+		return nil, ErrBadCursor
+	}
+
+	h, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+
+	c := &Cursor{
+		Height: int32(h),
+		Txid:   parts[2],
+		Before: parts[0] == "b",
+	}
+	return c, nil
+}
+
+// String encodes the cursor so that it can be handed to clients.
+func (c *Cursor) String() string {
+	dir := "a"
+	if c.Before {
+		dir = "b"
+	}
+	s := fmt.Sprintf("%s:%d:%s", dir, c.Height, c.Txid)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// FirstPage is the cursor that sits in front of every record.
+var FirstPage = &Cursor{Height: math.MaxInt32}
+
+// A PageKey is the place of a single record within a list.
+type PageKey struct {
+	Height int32
+	Txid   string
+	Block  string // The hash of the block the record is in
+}
+
+// HeldSpan returns the keys that bound the part of the list a page covers.
+// It reaches from the cursor the page was fetched with to its last key, or
+// to the end of the list when there are no more records.
+func HeldSpan(c *Cursor, keys []PageKey, more bool) (PageKey, PageKey) {
+	upper := PageKey{Height: FirstPage.Height}
+	lower := PageKey{Height: -1}
+	switch {
+	case c != nil && c.Before:
+		lower = PageKey{Height: c.Height, Txid: c.Txid}
+		if more {
+			upper = keys[0]
+		}
+	default:
+		if c != nil {
+			upper = PageKey{Height: c.Height, Txid: c.Txid}
+		}
+		if more {
+			lower = keys[len(keys)-1]
+		}
+	}
+	return upper, lower
+}
+
+// CapLimit returns the number of records to put in a page that asked for
+// limit. It falls back to DefaultPageLimit and is capped at max.
+func CapLimit(limit, max int) int {
+	if limit <= 0 {
+		return DefaultPageLimit
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
+
+// newCursors returns the cursors to the pages around a page that was fetched
+// with c. The first and last keys are from the page in list order and more
+// reports if the query found records past the page.
+func newCursors(c *Cursor, first, last PageKey, n int, more bool) ombjson.Cursors {
+	cs := ombjson.Cursors{}
+	if c == nil && n == 0 {
+		return cs
+	}
+	if n == 0 {
+		// An empty page still leads back to where it was asked for.
+		first = PageKey{Height: c.Height, Txid: c.Txid}
+		last = first
+	}
+
+	backwards := c != nil && c.Before
+	if more && !backwards || backwards {
+		cs.Next = (&Cursor{Height: last.Height, Txid: last.Txid}).String()
+	}
+	if more && backwards || c != nil && !backwards {
+		cs.Prev = (&Cursor{Height: first.Height, Txid: first.Txid, Before: true}).String()
+	}
+	return cs
+}
+
+// CutPage trims the keys returned by a paged query down to the limit and puts
+// them in list order.
+func CutPage(c *Cursor, keys []PageKey, limit int) ([]PageKey, bool) {
+	more := len(keys) > limit
+	if more {
+		keys = keys[:limit]
+	}
+	if c != nil && c.Before {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+	return keys, more
+}
+
+// PageSpan fills in the cursors of a page along with the hashes of the
+// blocks it starts and stops at. At either end of the list the passed start
+// and stop hashes are used instead.
+func PageSpan(c *Cursor, keys []PageKey, more bool, start, stop string) (string, string, ombjson.Cursors) {
+	var first, last PageKey
+	if len(keys) > 0 {
+		first, last = keys[0], keys[len(keys)-1]
+	}
+	cs := newCursors(c, first, last, len(keys), more)
+	if cs.Prev != "" && len(keys) > 0 {
+		start = first.Block
+	}
+	if cs.Next != "" && len(keys) > 0 {
+		stop = last.Block
+	}
+	return start, stop, cs
+}
@@ -0,0 +1,151 @@
+package ombstore
+
+import (
+	"errors"
+	"math"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+var ErrBadPolygon error = errors.New("geometry is not a valid GeoJSON polygon")
+
+// ring is a closed loop of [lon, lat] points. The longitudes are unwrapped so
+// that no edge is longer than 180 degrees, which means that a ring that
+// crosses the antimeridian has longitudes past -180 or 180.
+type ring [][2]float64
+
+// A Polygon holds an exterior ring followed by any holes cut out of it.
+type Polygon []ring
+
+// newRing builds a ring out of a GeoJSON linear ring. Following RFC 7946, edges
+// are straight lines in longitude and latitude. The exception is an edge that
+// spans more than 180 degrees of longitude, which is taken to cross the
+// antimeridian. If such edges make the ring circle the globe, it is closed
+// over the pole on its left: the north pole when heading east, the south
+// pole when heading west.
+func newRing(ps []ombjson.Position) (ring, error) {
+	if len(ps) < 4 {
+		return nil, ErrBadPolygon
+	}
+
+	r := make(ring, 0, len(ps)+2)
+	var offset float64
+	for i, p := range ps {
+		if len(p) < 2 || math.Abs(p[0]) > 180 || math.Abs(p[1]) > 90 {
+			return nil, ErrBadPolygon
+		}
+		lon, lat := p[0]+offset, p[1]
+		if i > 0 {
+			// Edges that run exactly from one side of the map to the other
+			// lie along the antimeridian or a pole and are left alone.
+			d := lon - r[i-1][0]
+			if d > 180 && d < 360 {
+				offset -= 360
+				lon -= 360
+			} else if d < -180 && d > -360 {
+				offset += 360
+				lon += 360
+			}
+		}
+		r = append(r, [2]float64{lon, lat})
+	}
+
+	first, last := ps[0], ps[len(ps)-1]
+	if first[0] != last[0] || first[1] != last[1] {
+		return nil, ErrBadPolygon
+	}
+
+	start, end := r[0], r[len(r)-1]
+	switch offset {
+	case 0:
+	case 360:
+		r = append(r, [2]float64{end[0], 90}, [2]float64{start[0], 90}, start)
+	case -360:
+		r = append(r, [2]float64{end[0], -90}, [2]float64{start[0], -90}, start)
+	default:
+		return nil, ErrBadPolygon
+	}
+
+	return r, nil
+}
+
+// contains uses the even-odd rule to decide if the point is inside the ring.
+func (r ring) contains(lon, lat float64) bool {
+	in := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a[1] > lat) != (b[1] > lat) &&
+			lon < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+			in = !in
+		}
+	}
+	return in
+}
+
+// NewPolygon builds a polygon from the linear rings of a GeoJSON polygon.
+func NewPolygon(rings [][]ombjson.Position) (Polygon, error) {
+	if len(rings) < 1 {
+		return nil, ErrBadPolygon
+	}
+
+	poly := Polygon{}
+	for _, ps := range rings {
+		r, err := newRing(ps)
+		if err != nil {
+			return nil, err
+		}
+		poly = append(poly, r)
+	}
+	return poly, nil
+}
+
+// Contains determines if the point is inside of the exterior ring and outside
+// of all of the holes. Since the rings can run past the antimeridian the
+// point is also checked one turn around the globe in either direction.
+func (poly Polygon) Contains(lon, lat float64) bool {
+	for _, shift := range []float64{0, 360, -360} {
+		if !poly[0].contains(lon+shift, lat) {
+			continue
+		}
+		inHole := false
+		for _, hole := range poly[1:] {
+			if hole.contains(lon+shift, lat) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// Bounds returns the boxes that cover the exterior ring of the polygon.
+func (poly Polygon) Bounds() (GeoBox, GeoBox) {
+	minLat, maxLat := math.Inf(1), math.Inf(-1)
+	minLon, maxLon := math.Inf(1), math.Inf(-1)
+	for _, p := range poly[0] {
+		minLon, maxLon = math.Min(minLon, p[0]), math.Max(maxLon, p[0])
+		minLat, maxLat = math.Min(minLat, p[1]), math.Max(maxLat, p[1])
+	}
+	return NewGeoBox(minLat, minLon, maxLat, maxLon)
+}
+
+// NewPolygons builds the polygons of a GeoJSON Polygon or MultiPolygon.
+func NewPolygons(g *ombjson.Geometry) ([]Polygon, error) {
+	rings, err := g.Polygons()
+	if err != nil {
+		return nil, ErrBadPolygon
+	}
+
+	polys := []Polygon{}
+	for _, r := range rings {
+		poly, err := NewPolygon(r)
+		if err != nil {
+			return nil, err
+		}
+		polys = append(polys, poly)
+	}
+	return polys, nil
+}
@@ -0,0 +1,107 @@
+package ombstore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+func mustPolygon(t *testing.T, geojson string) Polygon {
+	var g ombjson.Geometry
+	if err := json.Unmarshal([]byte(geojson), &g); err != nil {
+		t.Fatal(err)
+	}
+	polys, err := g.Polygons()
+	if err != nil {
+		t.Fatal(err)
+	}
+	poly, err := NewPolygon(polys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return poly
+}
+
+func TestPolygonContains(t *testing.T) {
+
+	tests := []struct {
+		geojson string
+		in      [][2]float64
+		out     [][2]float64
+	}{
+		// A square with a hole cut out of its middle.
+		{
+			`{"type": "Polygon", "coordinates": [
+				[[-10, -10], [10, -10], [10, 10], [-10, 10], [-10, -10]],
+				[[-5, -5], [-5, 5], [5, 5], [5, -5], [-5, -5]]
+			]}`,
+			[][2]float64{{-7, 0}, {9, 9}},
+			[][2]float64{{0, 0}, {11, 0}},
+		},
+		// A square that crosses the antimeridian.
+		{
+			`{"type": "Polygon", "coordinates": [
+				[[170, -10], [-170, -10], [-170, 10], [170, 10], [170, -10]]
+			]}`,
+			[][2]float64{{175, 0}, {-175, 0}, {180, 0}},
+			[][2]float64{{0, 0}, {165, 0}, {-165, 0}},
+		},
+		// A ring that circles the north pole.
+		{
+			`{"type": "Polygon", "coordinates": [
+				[[0, 80], [120, 80], [-120, 80], [0, 80]]
+			]}`,
+			[][2]float64{{0, 85}, {-100, 89}, {179, 81}},
+			[][2]float64{{0, 75}, {-100, -85}},
+		},
+		// The same area as the ring above in the form RFC 7946 suggests.
+		{
+			`{"type": "Polygon", "coordinates": [
+				[[-180, 80], [180, 80], [180, 90], [-180, 90], [-180, 80]]
+			]}`,
+			[][2]float64{{0, 85}, {-100, 89}, {179, 81}},
+			[][2]float64{{0, 75}, {-100, -85}},
+		},
+	}
+
+	for i, test := range tests {
+		poly := mustPolygon(t, test.geojson)
+		for _, p := range test.in {
+			if !poly.Contains(p[0], p[1]) {
+				t.Fatalf("Polygon(%d) should contain: %v", i, p)
+			}
+		}
+		for _, p := range test.out {
+			if poly.Contains(p[0], p[1]) {
+				t.Fatalf("Polygon(%d) should not contain: %v", i, p)
+			}
+		}
+	}
+}
+
+func TestBadPolygon(t *testing.T) {
+
+	tests := []string{
+		// Not closed
+		`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 1]]]}`,
+		// Too few positions
+		`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [0, 0]]]}`,
+		// Latitude out of range
+		`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 91], [0, 0]]]}`,
+	}
+
+	for _, test := range tests {
+		var g ombjson.Geometry
+		if err := json.Unmarshal([]byte(test), &g); err != nil {
+			t.Fatal(err)
+		}
+		polys, err := g.Polygons()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewPolygon(polys[0]); err != ErrBadPolygon {
+			t.Fatalf("Polygon should be rejected: %s", test)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package ombstore holds the Store interface that the public record is served
+// from along with everything its implementations share: cursors, the change
+// feed, moderation, geometry and the limits queries are held to. It uses no
+// database driver, so stores that keep the record some other way can be built
+// without cgo. pubrecdb keeps the record in SQL and memrecord keeps it in
+// memory.
+package ombstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+var ErrBlockNotTip error = errors.New("block is not chain tip")
+
+// DefaultMaxQueryLimit is the most items a store returns from a single query
+// unless it was told otherwise.
+var DefaultMaxQueryLimit = 10000
+
+// A Store keeps the public record and answers the queries the json api
+// serves. pubrecdb.PublicRecord is a Store kept in a SQL database and
+// memrecord.Record is one kept in memory. Every Store reports items that are
+// not in the record with sql.ErrNoRows and items that are blacklisted with
+// ErrWithheld.
+type Store interface {
+	// WithContext returns the Store with its calls bound to ctx.
+	WithContext(ctx context.Context) Store
+
+	// Writes made as the chain is followed
+	InsertUBlock(oblk *ombutil.UBlock) (error, bool)
+	InsertBlockHead(blk *btcutil.Block) (error, bool)
+	InsertBulletin(bltn *ombutil.Bulletin) (error, bool)
+	InsertEndorsement(endo *ombutil.Endorsement) (error, bool)
+	DeleteBlockTip(sha *wire.ShaHash) (error, bool)
+	DropAfterBlockBySha(sha *wire.ShaHash) error
+
+	// Changes published as the chain is followed
+	Subscribe(filter EventFilter) *Subscription
+
+	// Moderation
+	InsertBlacklistEntry(entry *ombjson.BlacklistEntry) (error, bool)
+	DeleteBlacklistEntry(kind, value string) (error, bool)
+	GetBlacklist() ([]*ombjson.BlacklistEntry, error)
+
+	// Single items
+	GetBulletin(txid *wire.ShaHash, opts ...RecordOption) (*ombjson.Bulletin, error)
+	GetEndorsement(txid *wire.ShaHash, opts ...RecordOption) (*ombjson.Endorsement, error)
+	GetBlock(hash *wire.ShaHash) (*ombjson.Block, error)
+	GetBlockTip() (*ombjson.Block, error)
+	GetProof(txid *wire.ShaHash) (*ombjson.MerkleProof, error)
+
+	// Paged lists
+	GetLatestPage(c *Cursor, limit int) (*ombjson.Page, error)
+	QueryRange(start, stop *wire.ShaHash, c *Cursor, limit int) (*ombjson.Page, error)
+	GetTag(tag ombutil.Tag, c *Cursor, limit int) (*ombjson.BltnPage, error)
+	GetBoard(name string, c *Cursor, limit int) (*ombjson.BoardResp, error)
+	GetAuthor(author btcutil.Address, c *Cursor, limit int) (*ombjson.AuthorResp, error)
+	GetAllAuthors(sort string, f AuthorFilter, c *Cursor, limit int) (*ombjson.AuthorPage, error)
+	GetOrphanEndorsements(c *Cursor, limit int) (*ombjson.EndoPage, error)
+	GetNearbyBltns(lat, lon, r float64, c *Cursor, limit int) (*ombjson.BltnPage, error)
+	GetBulletinsInBBox(minLat, minLon, maxLat, maxLon float64, c *Cursor, limit int) (*ombjson.BltnPage, error)
+	GetBulletinsInPolygon(g *ombjson.Geometry, c *Cursor, limit int) (*ombjson.BltnPage, error)
+	GetNearbyBltnsByDist(lat, lon, r float64, limit int) ([]*ombjson.Bulletin, bool, error)
+
+	// Aggregates
+	GetBestTags() ([]*ombjson.Tag, bool, error)
+	GetTrendingTags(halfLife time.Duration, limit int) ([]*ombjson.Tag, bool, error)
+	GetTrendingBltns(halfLife time.Duration, limit int) ([]*ombjson.TrendingBltn, bool, error)
+	GetTagDetail(tag ombutil.Tag, start, end time.Time, bucket string) (*ombjson.TagDetail, error)
+	GetMostEndorsedBltns(lim int) ([]*ombjson.Bulletin, bool, error)
+	GetAllBoards() ([]*ombjson.BoardSummary, error)
+	GetTopAuthors(limit int) ([]*ombjson.AuthorSummary, bool, error)
+	GetStatistics(start, fin time.Time) (*ombjson.Statistics, error)
+	GetActivitySeries(start, end time.Time, bucket string) (*ombjson.ActivitySeries, error)
+	GetDBStatus() (*ombjson.DBStatus, error)
+}
+
+// TxIndex reports whether a transaction has been mined. btcd's block
+// database satisfies it when its transaction index is on.
+type TxIndex interface {
+	ExistsTxSha(sha *wire.ShaHash) (bool, error)
+}
+
+// A RecordOption asks GetBulletin and GetEndorsement for more than the
+// record itself.
+type RecordOption int
+
+const (
+	// WithProof adds the merkle proof of the record's transaction so that
+	// clients can check it against the header themselves. Records stored
+	// without a proof are returned without one.
+	WithProof RecordOption = iota + 1
+)
+
+// OptProof returns the proof of txid looked up with get when opts ask for it.
+func OptProof(opts []RecordOption, txid *wire.ShaHash,
+	get func(*wire.ShaHash) (*ombjson.MerkleProof, error)) (*ombjson.MerkleProof, error) {
+
+	for _, opt := range opts {
+		if opt != WithProof {
+			continue
+		}
+		proof, err := get(txid)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return proof, err
+	}
+	return nil, nil
+}
+
+// PegBlock returns the block that a record of the network starts from.
+func PegBlock(net wire.BitcoinNet) (*btcutil.Block, error) {
+	switch net {
+	case wire.MainNet:
+		return peg.GetStartBlock(), nil
+	case wire.TestNet3:
+		return peg.GetTestStartBlock(), nil
+	default:
+		return nil, fmt.Errorf("No peg for non-default Bitcoin Net")
+	}
+}
@@ -0,0 +1,53 @@
+package ombstore
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/soapboxsys/ombudslib/ombutil"
+)
+
+const (
+	// trendHalfLives is how many half lives back from the tip records are
+	// still counted in a trend. Anything older weighs less than 1/256th of a
+	// record at the tip.
+	trendHalfLives = 8
+
+	// BestTagsHalfLife is the half life of the popular tags.
+	BestTagsHalfLife = 7 * 24 * time.Hour
+
+	// RelatedTagsHalfLife is how long it takes a bulletin's tags to count
+	// for half as much towards each other.
+	RelatedTagsHalfLife = 30 * 24 * time.Hour
+
+	// NumTagDetailItems is how many of the top authors and related tags a
+	// tag's detail lists.
+	NumTagDetailItems = 10
+)
+
+var ErrBadWindow error = errors.New("trend window is shorter than a second")
+
+// Decay weighs something that is age seconds old against a half life.
+func Decay(age, halfLife float64) float64 {
+	if halfLife <= 0 {
+		return 0
+	}
+	return math.Pow(0.5, age/halfLife)
+}
+
+// TrendArgs returns the half life and the span of a trend in seconds.
+func TrendArgs(halfLife time.Duration) (int64, int64, error) {
+	hl := int64(halfLife / time.Second)
+	if hl <= 0 {
+		return 0, 0, ErrBadWindow
+	}
+	return hl, hl * trendHalfLives, nil
+}
+
+// BoardTag returns the tag that backs the named board. The name may be
+// passed with or without its leading '#'.
+func BoardTag(name string) ombutil.Tag {
+	return ombutil.Tag("#" + strings.TrimPrefix(name, "#"))
+}
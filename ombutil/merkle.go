@@ -0,0 +1,110 @@
+package ombutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+var ErrBadProof error = errors.New("merkle proof does not hold")
+
+// MerkleBranch returns the hashes that link the transaction at index to the
+// merkle root of the tree in store. The store is laid out the way
+// blockchain.BuildMerkleTreeStore builds it and the branch runs from the
+// transaction's sibling up to the child of the root.
+func MerkleBranch(store []*wire.ShaHash, index int) []*wire.ShaHash {
+	branch := []*wire.ShaHash{}
+
+	offset := 0
+	width := (len(store) + 1) / 2
+	for width > 1 {
+		sibling := store[offset+(index^1)]
+		// Nodes without a right sibling are hashed with themselves.
+		if sibling == nil {
+			sibling = store[offset+index]
+		}
+		branch = append(branch, sibling)
+
+		offset += width
+		width /= 2
+		index /= 2
+	}
+	return branch
+}
+
+// MerkleRoot folds the branch into the transaction's hash and returns the
+// root the branch leads to.
+func MerkleRoot(txid *wire.ShaHash, index int, branch []*wire.ShaHash) *wire.ShaHash {
+	root, _ := foldBranch(txid, index, branch)
+	return root
+}
+
+// foldBranch works like MerkleRoot. It also reports if the branch ever puts
+// a node to the right of a copy of itself. Only a node without a right
+// sibling is hashed with itself, and it is always on the left, so such a
+// branch proves a transaction that was duplicated into the tree
+// (CVE-2012-2459).
+func foldBranch(txid *wire.ShaHash, index int, branch []*wire.ShaHash) (*wire.ShaHash, bool) {
+	h := txid
+	for _, b := range branch {
+		if index&1 == 0 {
+			h = blockchain.HashMerkleBranches(h, b)
+		} else {
+			if b.IsEqual(h) {
+				return h, false
+			}
+			h = blockchain.HashMerkleBranches(b, h)
+		}
+		index /= 2
+	}
+	return h, true
+}
+
+// VerifyMerkleProof checks that the transaction txid was mined in the block
+// blkHash. The proof's header must hash to blkHash and its branch must link
+// txid to the header's merkle root from the position the index gives.
+// ErrBadProof is returned if either does not hold or if the branch proves a
+// duplicated transaction. Checking that blkHash is part of the best chain is
+// left to the caller.
+func VerifyMerkleProof(txid, blkHash string, p *ombjson.MerkleProof) error {
+	tx, err := wire.NewShaHashFromStr(txid)
+	if err != nil {
+		return err
+	}
+
+	raw, err := hex.DecodeString(p.Header)
+	if err != nil {
+		return ErrBadProof
+	}
+	var h wire.BlockHeader
+	if err := h.Deserialize(bytes.NewReader(raw)); err != nil {
+		return ErrBadProof
+	}
+	if h.BlockSha().String() != blkHash {
+		return ErrBadProof
+	}
+
+	// The index can only pick one of the leaves the branch reaches.
+	if p.Index < 0 || uint64(p.Index)>>uint(len(p.Branch)) != 0 {
+		return ErrBadProof
+	}
+
+	branch := []*wire.ShaHash{}
+	for _, s := range p.Branch {
+		b, err := wire.NewShaHashFromStr(s)
+		if err != nil {
+			return ErrBadProof
+		}
+		branch = append(branch, b)
+	}
+
+	root, ok := foldBranch(tx, p.Index, branch)
+	if !ok || !root.IsEqual(&h.MerkleRoot) {
+		return ErrBadProof
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package ombutil_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombutil"
+)
+
+// merkleBlock builds a block of n distinct transactions with a header that
+// commits to them.
+func merkleBlock(n int) *btcutil.Block {
+	msg := &wire.MsgBlock{}
+	for i := 0; i < n; i++ {
+		tx := wire.NewMsgTx()
+		tx.LockTime = uint32(i)
+		msg.AddTransaction(tx)
+	}
+	blk := btcutil.NewBlock(msg)
+
+	store := blockchain.BuildMerkleTreeStore(blk.Transactions())
+	msg.Header = wire.BlockHeader{
+		MerkleRoot: *store[len(store)-1],
+		Timestamp:  time.Unix(123456789, 0),
+	}
+	return btcutil.NewBlock(msg)
+}
+
+func TestMerkleProof(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 7} {
+		blk := merkleBlock(n)
+		store := blockchain.BuildMerkleTreeStore(blk.Transactions())
+
+		var header bytes.Buffer
+		if err := blk.MsgBlock().Header.Serialize(&header); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, tx := range blk.Transactions() {
+			p := &ombjson.MerkleProof{
+				Header: hex.EncodeToString(header.Bytes()),
+				Index:  i,
+				Branch: []string{},
+			}
+			for _, h := range ombutil.MerkleBranch(store, i) {
+				p.Branch = append(p.Branch, h.String())
+			}
+
+			txid, blkHash := tx.Sha().String(), blk.Sha().String()
+			if err := ombutil.VerifyMerkleProof(txid, blkHash, p); err != nil {
+				t.Fatalf("Proof of tx %d of %d failed: %v", i, n, err)
+			}
+
+			// The same branch cannot prove a different position.
+			if n > 1 {
+				p.Index = (i + 1) % n
+				if err := ombutil.VerifyMerkleProof(txid, blkHash, p); err != ombutil.ErrBadProof {
+					t.Fatalf("Moved proof of tx %d of %d should fail: %v", i, n, err)
+				}
+			}
+		}
+	}
+}
+
+func TestMerkleProofForgery(t *testing.T) {
+	blk := merkleBlock(3)
+	store := blockchain.BuildMerkleTreeStore(blk.Transactions())
+
+	var header bytes.Buffer
+	if err := blk.MsgBlock().Header.Serialize(&header); err != nil {
+		t.Fatal(err)
+	}
+	blkHash := blk.Sha().String()
+
+	proof := func(i int) *ombjson.MerkleProof {
+		p := &ombjson.MerkleProof{
+			Header: hex.EncodeToString(header.Bytes()),
+			Index:  i,
+			Branch: []string{},
+		}
+		for _, h := range ombutil.MerkleBranch(store, i) {
+			p.Branch = append(p.Branch, h.String())
+		}
+		return p
+	}
+
+	// The last tx is hashed with itself so its branch also leads to the
+	// root from the copy to its right.
+	last := blk.Transactions()[2].Sha().String()
+	if err := ombutil.VerifyMerkleProof(last, blkHash, proof(2)); err != nil {
+		t.Fatal(err)
+	}
+	dup := proof(2)
+	dup.Index = 3
+	if err := ombutil.VerifyMerkleProof(last, blkHash, dup); err != ombutil.ErrBadProof {
+		t.Fatalf("Proof of the duplicated tx should fail: %v", err)
+	}
+
+	// Bits of the index above the branch would let one proof claim many
+	// positions.
+	first := blk.Transactions()[0].Sha().String()
+	for _, index := range []int{4, 1 << 20, -4} {
+		p := proof(0)
+		p.Index = index
+		if err := ombutil.VerifyMerkleProof(first, blkHash, p); err != ombutil.ErrBadProof {
+			t.Fatalf("Proof at index %d should fail: %v", index, err)
+		}
+	}
+}
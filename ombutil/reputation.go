@@ -0,0 +1,137 @@
+package ombutil
+
+import "math"
+
+const (
+	// RepDamping is the share of an author's rank that is passed along the
+	// endorsements they sent. The rest is handed out by trust.
+	RepDamping float64 = 0.85
+
+	repTolerance float64 = 1e-6
+	repMaxIter   int     = 100
+)
+
+// RepGraph is the directed graph of endorsements between authors. An edge
+// runs from the author of an endorsement to the author of the bulletin it
+// endorses. Every author also has a trust weight that decides how much of the
+// rank that is not passed along edges they get. Giving fresh addresses little
+// trust keeps a ring of them from raising each other's rank out of nothing.
+type RepGraph struct {
+	trust map[string]float64
+	out   map[string]map[string]float64
+}
+
+// NewRepGraph returns an empty graph.
+func NewRepGraph() *RepGraph {
+	return &RepGraph{
+		trust: make(map[string]float64),
+		out:   make(map[string]map[string]float64),
+	}
+}
+
+// AddAuthor adds an author to the graph with the trust weight. Adding an
+// author again replaces their weight.
+func (g *RepGraph) AddAuthor(author string, trust float64) {
+	g.trust[author] = trust
+}
+
+// AddEdge adds w to the weight of the edge from one author to another.
+// Authors that are not in the graph yet are added with a trust weight of 1.
+// Edges from an author to themselves are dropped.
+func (g *RepGraph) AddEdge(from, to string, w float64) {
+	for _, a := range []string{from, to} {
+		if _, ok := g.trust[a]; !ok {
+			g.trust[a] = 1
+		}
+	}
+	if from == to || w <= 0 {
+		return
+	}
+	edges, ok := g.out[from]
+	if !ok {
+		edges = make(map[string]float64)
+		g.out[from] = edges
+	}
+	edges[to] += w
+}
+
+// Rank runs PageRank over the graph and returns the score of every author.
+// Scores are scaled so that the average author has a score of 1. The ranking
+// starts from the scores in prev, so a graph that has only changed a little
+// since it was last ranked settles in a few iterations. Authors missing from
+// prev start at 1.
+func (g *RepGraph) Rank(prev map[string]float64) map[string]float64 {
+	n := float64(len(g.trust))
+	scores := make(map[string]float64)
+	if n == 0 {
+		return scores
+	}
+
+	// Authors are handed the rank that is not passed along edges in
+	// proportion to their trust. With no trust at all it is split evenly.
+	var total float64
+	for _, t := range g.trust {
+		total += t
+	}
+	tele := make(map[string]float64)
+	for a, t := range g.trust {
+		if total > 0 {
+			tele[a] = t / total
+		} else {
+			tele[a] = 1 / n
+		}
+	}
+
+	rank := make(map[string]float64)
+	var sum float64
+	for a := range g.trust {
+		r, ok := prev[a]
+		if !ok || r <= 0 {
+			r = 1
+		}
+		rank[a] = r
+		sum += r
+	}
+	for a := range rank {
+		rank[a] /= sum
+	}
+
+	for i := 0; i < repMaxIter; i++ {
+		next := make(map[string]float64)
+
+		// The rank of authors that endorsed no one is spread like the
+		// rest of the undamped rank.
+		var dangling float64
+		for a, r := range rank {
+			edges, ok := g.out[a]
+			if !ok {
+				dangling += r
+				continue
+			}
+			var w float64
+			for _, ew := range edges {
+				w += ew
+			}
+			for b, ew := range edges {
+				next[b] += RepDamping * r * ew / w
+			}
+		}
+		for a := range rank {
+			next[a] += (1 - RepDamping + RepDamping*dangling) * tele[a]
+		}
+
+		var diff float64
+		for a := range rank {
+			diff += math.Abs(next[a] - rank[a])
+		}
+		rank = next
+		if diff < repTolerance {
+			break
+		}
+	}
+
+	for a, r := range rank {
+		scores[a] = r * n
+	}
+	return scores
+}
@@ -0,0 +1,71 @@
+package ombutil_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/soapboxsys/ombudslib/ombutil"
+)
+
+func repGraph() *ombutil.RepGraph {
+	g := ombutil.NewRepGraph()
+	for _, a := range []string{"old1", "old2", "old3"} {
+		g.AddAuthor(a, 100)
+	}
+	g.AddEdge("old1", "old2", 1)
+	g.AddEdge("old3", "old2", 1)
+
+	// A ring of fresh addresses endorsing each other.
+	for _, a := range []string{"ring1", "ring2", "ring3"} {
+		g.AddAuthor(a, 1)
+	}
+	g.AddEdge("ring1", "ring2", 5)
+	g.AddEdge("ring2", "ring3", 5)
+	g.AddEdge("ring3", "ring1", 5)
+	g.AddEdge("ring1", "ring1", 5)
+	return g
+}
+
+func TestRank(t *testing.T) {
+	scores := repGraph().Rank(nil)
+	if len(scores) != 6 {
+		t.Fatalf("Expected 6 scores: %v", scores)
+	}
+
+	var sum float64
+	for _, s := range scores {
+		sum += s
+	}
+	if math.Abs(sum-6) > 1e-3 {
+		t.Fatalf("Scores should average 1: %v", scores)
+	}
+
+	if scores["old2"] <= scores["old1"] {
+		t.Fatalf("Endorsed author should outrank the others: %v", scores)
+	}
+	for _, a := range []string{"ring1", "ring2", "ring3"} {
+		if scores[a] >= scores["old1"] {
+			t.Fatalf("%s should be discounted: %v", a, scores)
+		}
+	}
+}
+
+func TestRankWarmStart(t *testing.T) {
+	g := repGraph()
+	cold := g.Rank(nil)
+
+	g.AddEdge("old2", "old3", 1)
+	warm := g.Rank(cold)
+	fresh := g.Rank(nil)
+	for a, s := range fresh {
+		if math.Abs(warm[a]-s) > 1e-3 {
+			t.Fatalf("Warm start diverged for %s: %f != %f", a, warm[a], s)
+		}
+	}
+}
+
+func TestRankEmpty(t *testing.T) {
+	if scores := ombutil.NewRepGraph().Rank(nil); len(scores) != 0 {
+		t.Fatalf("Empty graph has scores: %v", scores)
+	}
+}
@@ -74,6 +74,51 @@ func DecodeWireType(b []byte) (proto.Message, error) {
 	return pm, nil
 }
 
+// RecordOuts returns the indices of the TxOuts that the record in tx was
+// pushed into. The record runs from the magic bytes to the end of the length
+// given in its header.
+func RecordOuts(tx *wire.MsgTx) ([]int, error) {
+	alldata := make([]byte, 0)
+	ends := []int{}
+	for _, txout := range tx.TxOut {
+		pushMatrix, err := txscript.PushedData(txout.PkScript)
+		if err != nil {
+			return nil, err
+		}
+		for _, pushedD := range pushMatrix {
+			alldata = append(alldata, pushedD...)
+		}
+		ends = append(ends, len(alldata))
+	}
+
+	i := bytes.Index(alldata, Magic[:])
+	if i < 0 {
+		return nil, fmt.Errorf("No magic prefix")
+	}
+	buf := bytes.NewBuffer(alldata[i+len(Magic):])
+	if _, err := buf.ReadByte(); err != nil {
+		return nil, err
+	}
+	raw_l, n, err := readVarInt(buf)
+	if err != nil {
+		return nil, fmt.Errorf("Parse failed: %s", err)
+	}
+	if raw_l > MaxRecordLength || raw_l > uint64(buf.Len()) {
+		return nil, ErrRecordTooBig
+	}
+	stop := i + len(Magic) + 1 + n + int(raw_l)
+
+	outs := []int{}
+	start := 0
+	for j, end := range ends {
+		if end > i && start < stop {
+			outs = append(outs, j)
+		}
+		start = end
+	}
+	return outs, nil
+}
+
 // Munges the pushed data of TxOuts into a single universal slice that we can
 // use as a whole message.
 func extractData(txOuts []*wire.TxOut) ([]byte, error) {
@@ -0,0 +1,89 @@
+package pubrecdb
+
+import (
+	"time"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+)
+
+var (
+	// selectActivitySql counts everything that was stored in the record
+	// between $1 and $2 in buckets that are $3 seconds wide. Records are placed
+	// by the timestamp of the block they were mined in since the timestamps
+	// authors put on them can be anything. A tag is new in the bucket that
+	// holds the first bulletin that used it.
+	selectActivitySql string = `
+		SELECT (ts - $1) / $3 AS bucket, sum(kind = 0), sum(kind = 1),
+			sum(kind = 2), count(DISTINCT author), sum(kind = 3)
+		FROM (
+			SELECT 0 AS kind, blocks.timestamp AS ts, NULL AS author
+			FROM blocks
+			UNION ALL
+			SELECT 1, blocks.timestamp, bulletins.author
+			FROM bulletins JOIN blocks ON bulletins.block = blocks.hash
+			WHERE NOT ` + withheldBltnSql("bulletins") + `
+			UNION ALL
+			SELECT 2, blocks.timestamp, e.author
+			FROM endorsements AS e JOIN blocks ON e.block = blocks.hash
+			WHERE NOT ` + withheldEndoSql("e") + `
+			UNION ALL
+			SELECT 3, min(blocks.timestamp), NULL
+			FROM tags JOIN bulletins ON tags.txid = bulletins.txid
+			JOIN blocks ON bulletins.block = blocks.hash
+			WHERE NOT ` + withheldBltnSql("bulletins") + `
+			GROUP BY tags.value COLLATE NOCASE
+		) AS records
+		WHERE ts >= $1 AND ts < $2
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`
+)
+
+// GetActivitySeries counts the blocks, bulletins, endorsements, unique
+// authors and new tags in the record between start and end, one count per
+// bucket. The bucket is one of BucketHour, BucketDay or BucketWeek. Start is
+// moved back to the beginning of its bucket in UTC and every bucket up to end
+// is returned even if nothing happened in it. ErrBadSeries is returned if the
+// bucket is unknown, end does not come after start or the series has more
+// buckets than the record's query limit.
+func (db *PublicRecord) GetActivitySeries(start, end time.Time, bucket string) (*ombjson.ActivitySeries, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	series, width, err := ombstore.NewActivitySeries(start, end, bucket, db.maxQueryLimit)
+	if err != nil {
+		return nil, err
+	}
+	n := len(series.Buckets)
+
+	rows, err := db.selectActivity.QueryContext(ctx, series.StartTs, series.StopTs, int64(width.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i int
+		var nBlks, nBltns, nEndos, nAuthors, nTags int64
+		err := rows.Scan(&i, &nBlks, &nBltns, &nEndos, &nAuthors, &nTags)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= n {
+			continue
+		}
+
+		a := series.Buckets[i]
+		a.NumBlks = nBlks
+		a.NumBltns = nBltns
+		a.NumEndos = nEndos
+		a.NumAuthors = nAuthors
+		a.NumNewTags = nTags
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
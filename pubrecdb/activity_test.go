@@ -0,0 +1,41 @@
+package pubrecdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+func TestGetActivitySeries(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	// The three test blocks share a timestamp and bltn(9) is the only
+	// bulletin in them.
+	ts := time.Unix(123456789, 0)
+	start, end := ts.Add(-24*time.Hour), ts.Add(24*time.Hour)
+
+	series, err := db.GetActivitySeries(start, end, pubrecdb.BucketDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series.Buckets) != 3 {
+		t.Fatal(spw(series))
+	}
+
+	a := series.Buckets[1]
+	if a.StartTs > ts.Unix() || a.StopTs <= ts.Unix() || a.NumBlks != 3 ||
+		a.NumBltns != 1 || a.NumEndos != 0 || a.NumAuthors != 1 || a.NumNewTags != 1 {
+		t.Fatal(spw(a))
+	}
+	if series.Buckets[0].NumBlks != 0 || series.Buckets[2].NumBlks != 0 {
+		t.Fatal(spw(series))
+	}
+
+	if _, err := db.GetActivitySeries(end, start, pubrecdb.BucketDay); err != pubrecdb.ErrBadSeries {
+		t.Fatalf("Backwards series should be malformed: %v", err)
+	}
+	if _, err := db.GetActivitySeries(start, end, "month"); err != pubrecdb.ErrBadSeries {
+		t.Fatalf("Unknown buckets should be malformed: %v", err)
+	}
+}
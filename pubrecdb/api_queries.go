@@ -2,44 +2,68 @@ package pubrecdb
 
 import (
 	"database/sql"
-	"sort"
 
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
 	"github.com/soapboxsys/ombudslib/ombutil"
 	"github.com/soapboxsys/ombudslib/ombwire/peg"
 )
 
 var (
+	// bltnSql counts an author's endorsements of a bulletin once no matter how
+	// many they sent. The raw count of every endorsement follows it.
 	bltnSql string = `
 		SELECT bulletins.txid, bulletins.author, message, bulletins.timestamp, 
-		bulletins.block, blocks.timestamp, blocks.height, count(endorsements.txid), 
-		latitude, longitude, bulletins.height
-	`
+		bulletins.block, blocks.timestamp, blocks.height,
+		count(DISTINCT endorsements.author), count(endorsements.txid),
+		latitude, longitude, bulletins.height,
+	` + withheldBltnSql("bulletins")
 
 	selectBltnSql string = bltnSql + `
 		FROM bulletins LEFT JOIN blocks ON bulletins.block = blocks.hash
 		LEFT JOIN endorsements ON bulletins.txid = endorsements.bid
 		WHERE bulletins.txid = $1 
-		GROUP BY bulletins.txid HAVING bulletins.txid NOT null
+		GROUP BY bulletins.txid, blocks.hash HAVING bulletins.txid IS NOT NULL
 	`
 
-	selectTagSql string = bltnSql + `
+	// pagedBltnSql and groupBltnSql wrap the filters of the paged bulletin
+	// queries.
+	pagedBltnSql string = bltnSql + `
 		FROM bulletins LEFT JOIN blocks ON bulletins.block = blocks.hash
 		LEFT JOIN endorsements ON bulletins.txid = endorsements.bid
+	`
+
+	groupBltnSql string = `
+		GROUP BY bulletins.txid, blocks.hash HAVING bulletins.txid IS NOT NULL
+	`
+
+	selectTagSql string = pagedBltnSql + `
 		LEFT JOIN tags ON bulletins.txid = tags.txid
-		WHERE tags.value = $1 COLLATE NOCASE
-		GROUP BY bulletins.txid HAVING bulletins.txid NOT null
-		ORDER BY blocks.height DESC, bulletins.timestamp DESC
-		LIMIT $2
+	`
+
+	// recordsSql lists the keys of every bulletin and endorsement so that
+	// both can be paged through together.
+	// Withheld records are left out before the page is cut.
+	recordsSql string = `
+		SELECT height, txid, block FROM (
+			SELECT blocks.height AS height, bulletins.txid AS txid,
+				bulletins.block AS block, bulletins.author AS author
+			FROM bulletins JOIN blocks ON bulletins.block = blocks.hash
+			WHERE NOT ` + withheldBltnSql("bulletins") + `
+			UNION ALL
+			SELECT blocks.height, e.txid, e.block, e.author
+			FROM endorsements AS e JOIN blocks ON e.block = blocks.hash
+			WHERE NOT ` + withheldEndoSql("e") + `
+		) AS records
 	`
 
 	selectBltnsHeightSql string = bltnSql + `
 		FROM bulletins LEFT JOIN blocks ON bulletins.block = blocks.hash
 		LEFT JOIN endorsements ON bulletins.txid = endorsements.bid
 		WHERE blocks.height <= $1 AND blocks.height > $2
-		GROUP BY bulletins.txid HAVING bulletins.txid NOT null
+		GROUP BY bulletins.txid, blocks.hash HAVING bulletins.txid IS NOT NULL
 		ORDER BY blocks.height DESC, bulletins.timestamp DESC
 	`
 
@@ -56,265 +80,240 @@ var (
 		FROM blocks LEFT JOIN endorsements ON endorsements.block = blocks.hash
 		LEFT JOIN bulletins ON bulletins.block = blocks.hash
 		WHERE blocks.hash = $1
-		GROUP BY blocks.hash HAVING blocks.hash NOT null
+		GROUP BY blocks.hash HAVING blocks.hash IS NOT NULL
 	`
 
 	selectBlockTipSql string = blockHeadSql + `
 		FROM blocks LEFT JOIN endorsements ON endorsements.block = blocks.hash
 		LEFT JOIN bulletins ON bulletins.block = blocks.hash
-		GROUP BY blocks.hash HAVING blocks.hash NOT null
+		GROUP BY blocks.hash HAVING blocks.hash IS NOT NULL
 		ORDER BY blocks.height DESC
 		LIMIT 1
 	`
 
-	selectBestTagsSql string = `
-		SELECT tags.value, count(*), bulletins.timestamp 
-		FROM tags LEFT JOIN bulletins on tags.txid = bulletins.txid
-		GROUP BY tags.value
-		ORDER BY count(tags.value) DESC, bulletins.timestamp DESC
-		LIMIT $1
-	`
-
-	selectAuthorBltnsSql string = bltnSql + `
-		FROM bulletins LEFT JOIN blocks ON bulletins.block = blocks.hash
-		LEFT JOIN endorsements ON bulletins.txid = endorsements.bid
-		WHERE bulletins.author = $1 
-		GROUP BY bulletins.txid HAVING bulletins.txid NOT null
-		ORDER BY blocks.timestamp DESC
-	`
-
 	selectMostEndoBltnsSql string = bltnSql + `
 		FROM bulletins LEFT JOIN blocks ON bulletins.block = blocks.hash
 		INNER JOIN endorsements ON bulletins.txid = endorsements.bid
-		GROUP BY bulletins.txid
-		ORDER BY count(endorsements.txid) DESC
-		LIMIT $1
+		GROUP BY bulletins.txid, blocks.hash
+		ORDER BY count(DISTINCT endorsements.author) DESC
 	`
 )
 
 func prepareQueries(db *PublicRecord) error {
 	var err error
 
-	db.computeStatistics, err = db.conn.Prepare(computeStatisticsSql)
+	db.computeStatistics, err = db.prepare(computeStatisticsSql)
 	if err != nil {
 		return err
 	}
 
-	db.selectEndosByHeight, err = db.conn.Prepare(selectEndosByHeightSql)
+	db.selectActivity, err = db.prepare(selectActivitySql)
 	if err != nil {
 		return err
 	}
 
-	db.selectMostEndoBltns, err = db.conn.Prepare(selectMostEndoBltnsSql)
+	db.selectEndosByHeight, err = db.prepare(selectEndosByHeightSql)
 	if err != nil {
 		return err
 	}
 
-	db.selectNearbyBltns, err = db.conn.Prepare(selectNearbyBltns)
+	db.selectMostEndoBltns, err = db.prepare(selectMostEndoBltnsSql)
 	if err != nil {
 		return err
 	}
 
-	db.selectAuthorEndos, err = db.conn.Prepare(selectAuthorEndosSql)
+	db.selectNearbyBltns, err = prepareWithheld(db, pagedBltnSql, nearbyCond,
+		withheldBltnSql("bulletins"), groupBltnSql, "blocks.height", "bulletins.txid", 9)
 	if err != nil {
 		return err
 	}
 
-	db.selectAuthorBltns, err = db.conn.Prepare(selectAuthorBltnsSql)
+	db.selectNearbyBltnsByDist, err = db.prepare(selectNearbyBltnsByDist)
 	if err != nil {
 		return err
 	}
 
-	db.selectBestTags, err = db.conn.Prepare(selectBestTagsSql)
+	db.selectBBoxBltns, err = prepareWithheld(db, pagedBltnSql, inBoxSql,
+		withheldBltnSql("bulletins"), groupBltnSql, "blocks.height", "bulletins.txid", 6)
 	if err != nil {
 		return err
 	}
 
-	db.selectEndosByBid, err = db.conn.Prepare(selectEndosByBidSql)
+	db.selectAllBoards, err = db.prepare(selectAllBoardsSql)
 	if err != nil {
 		return err
 	}
 
-	db.selectBlock, err = db.conn.Prepare(selectBlockSql)
+	db.selectBoard, err = db.prepare(selectBoardSql)
 	if err != nil {
 		return err
 	}
 
-	db.selectBlockTip, err = db.conn.Prepare(selectBlockTipSql)
-	if err != nil {
+	if err = prepareAuthors(db); err != nil {
 		return err
 	}
 
-	db.selectBltn, err = db.conn.Prepare(selectBltnSql)
-	if err != nil {
+	if err = prepareStatus(db); err != nil {
 		return err
 	}
 
-	db.selectTag, err = db.conn.Prepare(selectTagSql)
+	db.selectAuthorRecords, err = preparePaged(db, recordsSql, "author = $1",
+		"", "height", "txid", 1)
 	if err != nil {
 		return err
 	}
 
-	db.selectEndo, err = db.conn.Prepare(selectEndoSql)
+	db.selectAuthorBltns, err = db.prepare(betweenSql(pagedBltnSql,
+		"bulletins.author = $1", groupBltnSql, "blocks.height", "bulletins.txid", 1))
 	if err != nil {
 		return err
 	}
 
-	db.findHeight, err = db.conn.Prepare(findHeightSql)
+	db.selectAuthorEndos, err = db.prepare(betweenSql(endoSql,
+		"e.author = $1", "", "blocks.height", "e.txid", 1))
 	if err != nil {
 		return err
 	}
 
-	db.selectBltnsHeight, err = db.conn.Prepare(selectBltnsHeightSql)
+	db.selectEndosByBid, err = db.prepare(selectEndosByBidSql)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// GetLatestPage returns all of the bulletins and endorsements under the max query
-// limit.
-func (db *PublicRecord) GetLatestPage() (*ombjson.Page, error) {
-	tipBlk, err := db.GetBlockTip()
+	db.selectBlock, err = db.prepare(selectBlockSql)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	pegBlk := peg.GetStartBlock()
+	db.selectBlockTip, err = db.prepare(selectBlockTipSql)
+	if err != nil {
+		return err
+	}
 
-	startH := tipBlk.Head.Height
-	stopH := pegBlk.Height() - 1
-	// Query for bltns between heights
-	bltns, err := db.getBltnsByHeight(startH, stopH)
+	db.selectBltn, err = db.prepare(selectBltnSql)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	endos, err := db.GetEndosByHeight(startH, stopH)
+	db.selectTag, err = prepareWithheld(db, selectTagSql, "tags.value = $1 COLLATE NOCASE",
+		withheldBltnSql("bulletins"), groupBltnSql, "blocks.height", "bulletins.txid", 1)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	page := &ombjson.Page{
-		Start:        tipBlk.Head.Hash,
-		Stop:         pegBlk.Sha().String(),
-		Bulletins:    bltns,
-		Endorsements: endos,
+	db.selectEndo, err = db.prepare(selectEndoSql)
+	if err != nil {
+		return err
 	}
 
-	return page, nil
-}
+	db.findHeight, err = db.prepare(findHeightSql)
+	if err != nil {
+		return err
+	}
 
-// QueryRange returns all of the bulletins and endorsements within the
-// selected start and stop block
-func (db *PublicRecord) QueryRange(start, stop *wire.ShaHash) (*ombjson.Page, error) {
-	// Find the heights of the block hashes.
-	startH, err := db.FindHeight(start)
+	db.selectBltnsHeight, err = db.prepare(selectBltnsHeightSql)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	stopH, err := db.FindHeight(stop)
+
+	db.selectRecords, err = preparePaged(db, recordsSql, "height <= $1 AND height > $2",
+		"", "height", "txid", 2)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Query for bltns between heights
-	rows, err := db.selectBltnsHeight.Query(startH, stopH)
-	defer rows.Close()
+	db.selectRangeBltns, err = db.prepare(betweenSql(pagedBltnSql,
+		"blocks.height <= $1 AND blocks.height > $2", groupBltnSql,
+		"blocks.height", "bulletins.txid", 2))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	bltns, err := scanBltns(rows)
+	db.selectRangeEndos, err = db.prepare(betweenSql(endoSql,
+		"blocks.height <= $1 AND blocks.height > $2", "", "blocks.height", "e.txid", 2))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	endos, err := db.GetEndosByHeight(startH, stopH)
+	return nil
+}
+
+// GetLatestPage returns a page of the bulletins and endorsements in the
+// record starting from the cursor. A nil cursor returns the newest records
+// and a limit of 0 uses the default page size.
+func (db *PublicRecord) GetLatestPage(c *Cursor, limit int) (*ombjson.Page, error) {
+	tipBlk, err := db.GetBlockTip()
 	if err != nil {
 		return nil, err
 	}
 
-	page := &ombjson.Page{
-		Start:        start.String(),
-		Stop:         stop.String(),
-		Bulletins:    bltns,
-		Endorsements: endos,
-	}
+	pegBlk := peg.GetStartBlock()
 
-	return page, nil
+	startH := tipBlk.Head.Height
+	stopH := pegBlk.Height() - 1
+
+	return db.queryRange(startH, stopH, tipBlk.Head.Hash, pegBlk.Sha().String(), c, limit)
 }
 
-// GetTag returns a blk cursor with all of the bulletins in a tag ordered by the
-// bulletins timestamp. If no bulletins exist in the record with that tag, an empty
-// list is returned. WARNING THIS DOES NOT PROVIDE THE RIGHT ANSWER FOR TESTNET
-func (db *PublicRecord) GetTag(tag ombutil.Tag) (*ombjson.BltnPage, error) {
-	rows, err := db.selectTag.Query(string(tag), db.maxQueryLimit)
-	defer rows.Close()
+// QueryRange returns a page of the bulletins and endorsements within the
+// selected start and stop block starting from the cursor.
+func (db *PublicRecord) QueryRange(start, stop *wire.ShaHash, c *Cursor, limit int) (*ombjson.Page, error) {
+	// Find the heights of the block hashes.
+	startH, err := db.FindHeight(start)
 	if err != nil {
 		return nil, err
 	}
-
-	bltns, err := scanBltns(rows)
+	stopH, err := db.FindHeight(stop)
 	if err != nil {
 		return nil, err
 	}
 
-	page := &ombjson.BltnPage{
-		Bulletins: bltns,
-	}
+	return db.queryRange(startH, stopH, start.String(), stop.String(), c, limit)
+}
 
-	blk, err := db.GetBlockTip()
+// queryRange pages through the records between the heights. The start and
+// stop hashes bound the page when it reaches either end of the range.
+func (db *PublicRecord) queryRange(startH, stopH int32, start, stop string, c *Cursor, limit int) (*ombjson.Page, error) {
+	recs, err := db.queryRecords(db.selectRecords, db.selectRangeBltns,
+		db.selectRangeEndos, c, limit, startH, stopH)
 	if err != nil {
 		return nil, err
 	}
-	page.Start = blk.Head.Hash
 
-	if len(bltns) < db.maxQueryLimit {
-		// This is ugly
-		page.Stop = peg.GetStartBlock().Sha().String()
-	} else {
-		page.Stop = bltns[len(bltns)-1].BlockRef.Hash
+	page := &ombjson.Page{
+		Bulletins:    recs.bltns,
+		Endorsements: recs.endos,
+		Withheld:     recs.withheld,
 	}
+	page.Start, page.Stop, page.Cursors = ombstore.PageSpan(c, recs.keys, recs.more, start, stop)
 
 	return page, nil
 }
 
-// GetBestTag returns the 'best' tags as determined by a simple geometric
-// formula that takes into account the number of times the tag has been used
-// and the first time the tag was seen in the record.
-func (db *PublicRecord) GetBestTags() ([]*ombjson.Tag, error) {
-	tags := []*ombjson.Tag{}
-
-	rows, err := db.selectBestTags.Query(50)
-	defer rows.Close()
-	if err != nil {
-		return nil, err
-	}
-	for rows.Next() {
-		var ts, count int64
-		var val string
-		err := rows.Scan(&val, &count, &ts)
-		if err != nil {
-			return tags, err
-		}
-		tag := ombjson.NewTag(val, count, ts)
-		tags = append(tags, &tag)
-	}
-	// Sort tags by score.
-	sort.Sort(ombjson.ByScore(tags))
+// GetTag returns a page of the bulletins in a tag starting from the cursor.
+// If no bulletins exist in the record with that tag, an empty list is
+// returned. WARNING THIS DOES NOT PROVIDE THE RIGHT ANSWER FOR TESTNET
+func (db *PublicRecord) GetTag(tag ombutil.Tag, c *Cursor, limit int) (*ombjson.BltnPage, error) {
+	return db.queryBltnPage(db.selectTag, c, limit, string(tag))
+}
 
-	return tags, nil
+// GetBestTags returns the 50 tags that trended the most over the last few
+// weeks and reports if any were withheld like GetTrendingTags.
+func (db *PublicRecord) GetBestTags() ([]*ombjson.Tag, bool, error) {
+	return db.GetTrendingTags(ombstore.BestTagsHalfLife, 50)
 }
 
 // GetBulletin returns a single bulletin as json that is identified by txid.
-// If the bltn does not exist the functions returns sql.ErrNoRows. The function
-// assumes that the passed txid string is correctly formed (all lower case hex
-// string).
-func (db *PublicRecord) GetBulletin(txid *wire.ShaHash) (*ombjson.Bulletin, error) {
-	row := db.selectBltn.QueryRow(txid.String())
-	bltn, err := scanBltn(row)
+// If the bltn does not exist the functions returns sql.ErrNoRows and if it
+// is blacklisted ErrWithheld. Passing WithProof adds its merkle proof. The
+// function assumes that the passed txid string is correctly formed (all lower
+// case hex string).
+func (db *PublicRecord) GetBulletin(txid *wire.ShaHash, opts ...RecordOption) (*ombjson.Bulletin, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	row := db.selectBltn.QueryRowContext(ctx, txid.String())
+	bltn, err := db.scanBltn(row)
 	if err != nil {
 		return nil, err
 	}
@@ -325,76 +324,104 @@ func (db *PublicRecord) GetBulletin(txid *wire.ShaHash) (*ombjson.Bulletin, erro
 	}
 	bltn.Endorsements = endos
 
-	return bltn, nil
-}
-
-// getAuthorBltns just returns the bulletins that have been signed by the
-// passed bitcoin address.
-func (db *PublicRecord) getAuthorBltns(author btcutil.Address) ([]*ombjson.Bulletin, error) {
-	rows, err := db.selectAuthorBltns.Query(author.String())
+	bltn.Proof, err = ombstore.OptProof(opts, txid, db.GetProof)
 	if err != nil {
-		return []*ombjson.Bulletin{}, err
+		return nil, err
 	}
-	return scanBltns(rows)
+
+	return bltn, nil
 }
 
-// GetAuthor returns the bulletins and the endorsements a bitcoin address has
-// sent.
-func (db *PublicRecord) GetAuthor(author btcutil.Address) (*ombjson.AuthorResp, error) {
+// GetAuthor returns a page of the bulletins and the endorsements a bitcoin
+// address has sent starting from the cursor. The summary covers everything
+// the author has sent. If the author is blacklisted ErrWithheld is returned.
+func (db *PublicRecord) GetAuthor(author btcutil.Address, c *Cursor, limit int) (*ombjson.AuthorResp, error) {
 
-	bltns, err := db.getAuthorBltns(author)
+	listed, err := db.isBlacklisted(BlacklistAuthor, author.String())
 	if err != nil {
 		return nil, err
 	}
+	if listed {
+		return nil, ErrWithheld
+	}
 
-	endos, err := db.getAuthorEndos(author)
+	recs, err := db.queryRecords(db.selectAuthorRecords, db.selectAuthorBltns,
+		db.selectAuthorEndos, c, limit, author.String())
 	if err != nil {
 		return nil, err
 	}
 
 	auth := &ombjson.AuthorResp{
-		Bulletins:    bltns,
-		Endorsements: endos,
+		Bulletins:    recs.bltns,
+		Endorsements: recs.endos,
+		Withheld:     recs.withheld,
 	}
+	_, _, auth.Cursors = ombstore.PageSpan(c, recs.keys, recs.more, "", "")
 
-	if len(bltns) > 0 {
-		auth.Summary = &ombjson.AuthorSummary{
-			Address:    author.String(),
-			LastBlkTs:  bltns[0].BlockRef.Timestamp,
-			FirstBlkTs: bltns[len(bltns)-1].BlockRef.Timestamp,
-		}
+	summary, err := db.getAuthorSummary(author.String())
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
 	}
+	auth.Summary = summary
 
 	return auth, nil
 }
 
 // GetMostEndorsedBltns returns a list of bltns sorted by number of
-// endorsements received. It does not return bltns with 0 endorsements.
-func (db *PublicRecord) GetMostEndorsedBltns(lim int) ([]*ombjson.Bulletin, error) {
-	rows, err := db.selectMostEndoBltns.Query(lim)
-	defer rows.Close()
+// unique authors that endorsed them. It does not return bltns with 0
+// endorsements. It reports if any bulletin that would have been listed was
+// withheld.
+func (db *PublicRecord) GetMostEndorsedBltns(lim int) ([]*ombjson.Bulletin, bool, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	rows, err := db.selectMostEndoBltns.QueryContext(ctx)
 	if err != nil {
-		return []*ombjson.Bulletin{}, err
+		return []*ombjson.Bulletin{}, false, err
 	}
+	defer rows.Close()
 
-	bltns, err := scanBltns(rows)
+	bltns, withheld, err := db.scanTopBltns(rows, lim)
 	if err != nil {
-		return []*ombjson.Bulletin{}, err
+		return []*ombjson.Bulletin{}, false, err
 	}
 
-	return bltns, nil
+	return bltns, withheld, nil
+}
+
+// ShowRawEndoCounts turns reporting the raw number of endorsements next to
+// the number of unique endorsers of each bulletin on or off. It is off by
+// default.
+func (db *PublicRecord) ShowRawEndoCounts(show bool) {
+	db.rawEndoCounts = show
+}
+
+// scanBltn scans a single bulletin. If the bulletin is blacklisted
+// ErrWithheld is returned.
+func (db *PublicRecord) scanBltn(cursor scannable) (*ombjson.Bulletin, error) {
+	bltn, withheld, err := db.scanBltnRow(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if withheld {
+		return nil, ErrWithheld
+	}
+	return bltn, nil
 }
 
-func scanBltn(cursor scannable) (*ombjson.Bulletin, error) {
+// scanBltnRow scans a bulletin and whether it is withheld. The raw count of
+// endorsements is only kept when the record shows raw endorsement counts.
+func (db *PublicRecord) scanBltnRow(cursor scannable) (*ombjson.Bulletin, bool, error) {
 
 	var txid, author, blkHash, msg string
-	var bltnTs, blkTs, blkHeight, numEndos int64
+	var bltnTs, blkTs, blkHeight, numEndos, numRawEndos int64
 	var lat, lon, h sql.NullFloat64
+	var withheld bool
 
-	err := cursor.Scan(&txid, &author, &msg, &bltnTs,
-		&blkHash, &blkTs, &blkHeight, &numEndos, &lat, &lon, &h)
+	err := cursor.Scan(&txid, &author, &msg, &bltnTs, &blkHash, &blkTs,
+		&blkHeight, &numEndos, &numRawEndos, &lat, &lon, &h, &withheld)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	bltn := &ombjson.Bulletin{
@@ -409,6 +436,9 @@ func scanBltn(cursor scannable) (*ombjson.Bulletin, error) {
 		},
 		NumEndos: int32(numEndos),
 	}
+	if db.rawEndoCounts {
+		bltn.NumRawEndos = int32(numRawEndos)
+	}
 
 	if lat.Valid && lon.Valid && h.Valid {
 		bltn.Location = &ombjson.Location{
@@ -418,19 +448,67 @@ func scanBltn(cursor scannable) (*ombjson.Bulletin, error) {
 		}
 	}
 
-	return bltn, nil
+	return bltn, withheld, nil
+}
+
+// scanBltns returns the bulletins in rows that are not blacklisted and
+// reports if any were withheld.
+func (db *PublicRecord) scanBltns(rows *sql.Rows) ([]*ombjson.Bulletin, bool, error) {
+	all, withheld, err := db.scanBltnRows(rows)
+	if err != nil {
+		return []*ombjson.Bulletin{}, false, err
+	}
+
+	bltns := []*ombjson.Bulletin{}
+	anyWithheld := false
+	for i, bltn := range all {
+		if withheld[i] {
+			anyWithheld = true
+			continue
+		}
+		bltns = append(bltns, bltn)
+	}
+	return bltns, anyWithheld, nil
+}
+
+// scanTopBltns returns the first limit bulletins in rows that are not
+// blacklisted and reports if any were withheld before the list was full. The
+// withheld ones are ranked with the rest so that they do not take up room in
+// the list. A negative limit reads every row.
+func (db *PublicRecord) scanTopBltns(rows *sql.Rows, limit int) ([]*ombjson.Bulletin, bool, error) {
+	bltns := []*ombjson.Bulletin{}
+	withheld := false
+	for (limit < 0 || len(bltns) < limit) && rows.Next() {
+		bltn, w, err := db.scanBltnRow(rows)
+		if err != nil {
+			return []*ombjson.Bulletin{}, false, err
+		}
+		if w {
+			withheld = true
+			continue
+		}
+		bltns = append(bltns, bltn)
+	}
+	if err := rows.Err(); err != nil {
+		return []*ombjson.Bulletin{}, false, err
+	}
+	return bltns, withheld, nil
 }
 
-func scanBltns(rows *sql.Rows) ([]*ombjson.Bulletin, error) {
+// scanBltnRows scans every bulletin in rows along with whether each one is
+// withheld.
+func (db *PublicRecord) scanBltnRows(rows *sql.Rows) ([]*ombjson.Bulletin, []bool, error) {
 	bltns := []*ombjson.Bulletin{}
+	withheld := []bool{}
 	for rows.Next() {
-		bltn, err := scanBltn(rows)
+		bltn, w, err := db.scanBltnRow(rows)
 		if err != nil {
-			return []*ombjson.Bulletin{}, err
+			return []*ombjson.Bulletin{}, []bool{}, err
 		}
 		bltns = append(bltns, bltn)
+		withheld = append(withheld, w)
 	}
-	return bltns, nil
+	return bltns, withheld, nil
 }
 
 type scannable interface {
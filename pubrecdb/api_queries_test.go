@@ -11,9 +11,11 @@ import (
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/soapboxsys/ombudslib/ombjson"
 	"github.com/soapboxsys/ombudslib/ombutil"
 	"github.com/soapboxsys/ombudslib/ombwire"
 	"github.com/soapboxsys/ombudslib/ombwire/peg"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
 )
 
 func newSha(s string) *wire.ShaHash {
@@ -51,11 +53,21 @@ func TestGetBulletin(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Check that num endos is right
-	if bltn.NumEndos != 3 {
+	// Check that num endos is right. 4end0 endorsed it twice and counts once.
+	if bltn.NumEndos != 2 || bltn.NumRawEndos != 0 {
 		t.Fatal(spew.Sdump("bltn(4) query returned:", bltn))
 	}
 
+	db.ShowRawEndoCounts(true)
+	defer db.ShowRawEndoCounts(false)
+	bltn, err = db.GetBulletin(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bltn.NumEndos != 2 || bltn.NumRawEndos != 3 {
+		t.Fatal(spew.Sdump("bltn(4) with raw counts returned:", bltn))
+	}
+
 }
 
 // Tests a bulletins whole round trip, to see if the location values where set
@@ -103,7 +115,7 @@ func TestNilLocBulletin(t *testing.T) {
 func TestGetTag(t *testing.T) {
 	db, _ := SetupTestDB(true)
 
-	page, err := db.GetTag(ombutil.Tag("#wistful"))
+	page, err := db.GetTag(ombutil.Tag("#wistful"), nil, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -112,7 +124,7 @@ func TestGetTag(t *testing.T) {
 		t.Fatal("Page should be empty")
 	}
 
-	page, err = db.GetTag(ombutil.Tag("#preflight"))
+	page, err = db.GetTag(ombutil.Tag("#preflight"), nil, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -130,7 +142,7 @@ func TestGetRange(t *testing.T) {
 	// Stop is the hash of the blk before the peg blk.
 	stop := newSha("000000000000000002dfcd5cd05cd4f80d792e51ecdc5942cd6cec1365b22a2d")
 
-	page, err := db.QueryRange(start, stop)
+	page, err := db.QueryRange(start, stop, nil, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -150,7 +162,7 @@ func TestGetAuthorResp(t *testing.T) {
 	net := chaincfg.MainNetParams
 	auth, _ := btcutil.DecodeAddress("3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", &net)
 
-	authResp, err := db.GetAuthor(auth)
+	authResp, err := db.GetAuthor(auth, nil, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -164,24 +176,146 @@ func TestGetAuthorResp(t *testing.T) {
 func TestGetNearbyBltns(t *testing.T) {
 	db, _ := SetupTestDB(true)
 
-	b, err := db.GetNearbyBltns(45.0, 44.0, 20000)
+	b, err := db.GetNearbyBltns(45.0, 44.0, 20000, nil, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if len(b.Bulletins) != 5 {
+		t.Fatal(spw(b))
+	}
+}
+
+func TestGetNearbyBltnsByDist(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	// Place a bulletin further away from the point than the others.
+	bltn := fakeUBltn(11)
+	var lat float64 = 1.0
+	bltn.Wire.Location.Lat = &lat
+	if err, ok := db.InsertBulletin(bltn); err != nil || !ok {
+		t.Fatal(err)
+	}
+
+	b, withheld, err := db.GetNearbyBltnsByDist(0.0, 0.0, 200, 0)
+	if err != nil || withheld {
+		t.Fatal(err)
+	}
+
+	if len(b) != 6 || b[5].Txid != bltn.Tx.TxSha().String() {
+		t.Fatal(spw(b))
+	}
+
+	// Only the far bulletin is outside of this circle.
+	b, withheld, err = db.GetNearbyBltnsByDist(0.0, 0.0, 10, 0)
+	if err != nil || withheld {
+		t.Fatal(err)
+	}
+
 	if len(b) != 5 {
 		t.Fatal(spw(b))
 	}
 }
 
-func TestGetMostEndorsedBltns(t *testing.T) {
+func TestGetBulletinsInBBox(t *testing.T) {
 	db, _ := SetupTestDB(true)
 
-	bltns, err := db.GetMostEndorsedBltns(100)
+	b, err := db.GetBulletinsInBBox(-1.0, -1.0, 1.0, 1.0, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.Bulletins) != 5 {
+		t.Fatal(spw(b))
+	}
+
+	b, err = db.GetBulletinsInBBox(10.0, 10.0, 20.0, 20.0, nil, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if len(b.Bulletins) != 0 {
+		t.Fatal(spw(b))
+	}
+
+	// Deleting the bulletins must remove them from the spatial index.
+	db.EmptyTables()
+	b, err = db.GetBulletinsInBBox(-1.0, -1.0, 1.0, 1.0, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.Bulletins) != 0 {
+		t.Fatal(spw(b))
+	}
+}
+
+func TestGetBulletinsInBBoxAntimeridian(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	bltn := fakeUBltn(11)
+	var lon float64 = 179.9
+	bltn.Wire.Location.Lon = &lon
+	if err, ok := db.InsertBulletin(bltn); err != nil || !ok {
+		t.Fatal(err)
+	}
+
+	b, err := db.GetBulletinsInBBox(-1.0, 179.0, 1.0, -179.0, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.Bulletins) != 1 || b.Bulletins[0].Txid != bltn.Tx.TxSha().String() {
+		t.Fatal(spw(b))
+	}
+
+	if _, err := db.GetBulletinsInBBox(1.0, 0.0, -1.0, 0.0, nil, 0); err != pubrecdb.ErrBadBBox {
+		t.Fatalf("Inverted latitudes should fail not: %v", err)
+	}
+}
+
+func TestGetBulletinsInPolygon(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	bltn := fakeUBltn(11)
+	var lon float64 = -179.9
+	bltn.Wire.Location.Lon = &lon
+	if err, ok := db.InsertBulletin(bltn); err != nil || !ok {
+		t.Fatal(err)
+	}
+
+	var g ombjson.Geometry
+	err := json.Unmarshal([]byte(`{"type": "MultiPolygon", "coordinates": [
+		[[[-1, -1], [1, -1], [1, 1], [-1, 1], [-1, -1]]],
+		[[[179, -1], [-179, -1], [-179, 1], [179, 1], [179, -1]]]
+	]}`), &g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := db.GetBulletinsInPolygon(&g, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.Bulletins) != 6 {
+		t.Fatal(spw(b))
+	}
+
+	g.Type = "Point"
+	if _, err := db.GetBulletinsInPolygon(&g, nil, 0); err != pubrecdb.ErrBadPolygon {
+		t.Fatalf("Points are not polygons: %v", err)
+	}
+}
+
+func TestGetMostEndorsedBltns(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	bltns, withheld, err := db.GetMostEndorsedBltns(100)
+	if err != nil || withheld {
+		t.Fatal(err)
+	}
+
 	if len(bltns) != 1 {
 		t.Fatalf(spw(bltns))
 	}
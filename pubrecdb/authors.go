@@ -0,0 +1,177 @@
+package pubrecdb
+
+import (
+	"database/sql"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+)
+
+var (
+	// authorSortCols maps the sort orders to the columns of authorsSql they
+	// page on. First seen and last active are ordered by block height.
+	authorSortCols = map[string]string{
+		SortPosts:      "num_bltns",
+		SortEndorsed:   "num_recvd",
+		SortFirstSeen:  "first_h",
+		SortLastActive: "last_h",
+	}
+
+	// authorsSql sums up everything each author has sent to the record along
+	// with their reputation.
+	authorsSql string = authorSumsSql("", "")
+
+	// selectAuthorSql filters on the author inside of the union so that only
+	// their own records are summed.
+	selectAuthorSql string = authorSumsSql("bulletins.author = $1", "e.author = $1")
+
+	// allAuthorsCond filters the directory down to the authors with at least
+	// $1 bulletins that were active at or after the block timestamp $2.
+	allAuthorsCond string = "num_bltns >= $1 AND last_ts >= $2"
+)
+
+// authorSumsSql builds the query of authorsSql. The bulletins and the
+// endorsements that are summed are narrowed down by bltnCond and endoCond.
+func authorSumsSql(bltnCond, endoCond string) string {
+	return `
+		SELECT author, num_bltns, num_endos, num_recvd, first_h, last_h,
+			first_ts, last_ts, coalesce((
+				SELECT r.score FROM reputation AS r WHERE r.author = sums.author
+			), 0) AS score
+		FROM (
+			SELECT author, sum(kind = 0) AS num_bltns, sum(kind = 1) AS num_endos,
+				sum(recvd) AS num_recvd, min(height) AS first_h,
+				max(height) AS last_h, min(ts) AS first_ts, max(ts) AS last_ts
+			FROM (
+				SELECT 0 AS kind, bulletins.author AS author,
+					blocks.height AS height, blocks.timestamp AS ts, (
+						SELECT count(DISTINCT re.author) FROM endorsements AS re
+						WHERE re.bid = bulletins.txid AND
+							NOT ` + withheldEndoSql("re") + `
+					) AS recvd
+				FROM bulletins JOIN blocks ON bulletins.block = blocks.hash
+				` + where("NOT "+withheldBltnSql("bulletins"), bltnCond) + `
+				UNION ALL
+				SELECT 1, e.author, blocks.height, blocks.timestamp, 0
+				FROM endorsements AS e JOIN blocks ON e.block = blocks.hash
+				` + where("NOT "+withheldEndoSql("e"), endoCond) + `
+			) AS records
+			GROUP BY author
+		) AS sums
+	`
+}
+
+func prepareAuthors(db *PublicRecord) (err error) {
+	db.selectAuthor, err = db.prepare(selectAuthorSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectAllAuthors = make(map[string]*pagedStmt)
+	for sort, col := range authorSortCols {
+		db.selectAllAuthors[sort], err = preparePaged(db, authorsSql,
+			allAuthorsCond, "", col, "author", 2)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAllAuthors returns a page of the authors that have sent something to
+// the record starting from the cursor. The page is ordered by sort which is
+// one of SortPosts, SortEndorsed, SortFirstSeen or SortLastActive. A cursor
+// only points into the order it was handed out with. ErrBadSort is returned
+// for any other order.
+func (db *PublicRecord) GetAllAuthors(sort string, f AuthorFilter, c *Cursor, limit int) (*ombjson.AuthorPage, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	q, ok := db.selectAllAuthors[sort]
+	if !ok {
+		return nil, ErrBadSort
+	}
+
+	var since int64
+	if !f.ActiveSince.IsZero() {
+		since = f.ActiveSince.Unix()
+	}
+
+	limit = db.pageLimit(limit)
+	rows, err := q.query(ctx, c, limit, f.MinBltns, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []ombstore.PageKey{}
+	byAddr := make(map[string]*ombjson.AuthorSummary)
+	for rows.Next() {
+		summary, h, err := scanAuthorSummary(rows, sort)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, ombstore.PageKey{Height: h, Txid: summary.Address})
+		byAddr[summary.Address] = summary
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keys, more := ombstore.CutPage(c, keys, limit)
+	page := &ombjson.AuthorPage{
+		Sort:    sort,
+		Authors: []*ombjson.AuthorSummary{},
+	}
+	for _, k := range keys {
+		page.Authors = append(page.Authors, byAddr[k.Txid])
+	}
+	_, _, page.Cursors = ombstore.PageSpan(c, keys, more, "", "")
+
+	return page, nil
+}
+
+// getAuthorSummary returns the summary of everything the author has sent.
+// If the author has sent nothing sql.ErrNoRows is returned.
+func (db *PublicRecord) getAuthorSummary(author string) (*ombjson.AuthorSummary, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	row := db.selectAuthor.QueryRowContext(ctx, author)
+	summary, _, err := scanAuthorSummary(row, SortPosts)
+	return summary, err
+}
+
+// scanAuthorSummary scans a row of authorsSql along with the value of the
+// column the row is sorted on.
+func scanAuthorSummary(cursor scannable, sort string) (*ombjson.AuthorSummary, int32, error) {
+	var addr string
+	var nBltns, nEndos, nRecvd, firstH, lastH int32
+	var firstTs, lastTs sql.NullInt64
+	var score float64
+
+	err := cursor.Scan(&addr, &nBltns, &nEndos, &nRecvd, &firstH, &lastH,
+		&firstTs, &lastTs, &score)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	summary := &ombjson.AuthorSummary{
+		Address:    addr,
+		FirstBlkTs: firstTs.Int64,
+		LastBlkTs:  lastTs.Int64,
+		NumBltns:   nBltns,
+		NumEndos:   nEndos,
+		NumRecvd:   nRecvd,
+		Reputation: score,
+	}
+
+	key := map[string]int32{
+		SortPosts:      nBltns,
+		SortEndorsed:   nRecvd,
+		SortFirstSeen:  firstH,
+		SortLastActive: lastH,
+	}[sort]
+	return summary, key, nil
+}
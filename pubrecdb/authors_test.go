@@ -0,0 +1,47 @@
+package pubrecdb_test
+
+import (
+	"testing"
+
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+func TestGetAllAuthors(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	page, err := db.GetAllAuthors(pubrecdb.SortPosts, pubrecdb.AuthorFilter{}, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Authors) != 1 || page.Next == "" {
+		t.Fatal(spw(page))
+	}
+	a := page.Authors[0]
+	if a.Address != "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy" || a.NumBltns != 5 ||
+		a.NumEndos != 1 || a.NumRecvd != 2 {
+		t.Fatal(spw(a))
+	}
+
+	c, _ := pubrecdb.ParseCursor(page.Next)
+	page, err = db.GetAllAuthors(pubrecdb.SortPosts, pubrecdb.AuthorFilter{}, c, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Authors) != 1 || page.Authors[0].Address != "4end0" ||
+		page.Authors[0].NumEndos != 2 || page.Next != "" {
+		t.Fatal(spw(page))
+	}
+
+	f := pubrecdb.AuthorFilter{MinBltns: 1}
+	page, err = db.GetAllAuthors(pubrecdb.SortLastActive, f, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Authors) != 1 {
+		t.Fatal(spw(page))
+	}
+
+	if _, err := db.GetAllAuthors("loudest", f, nil, 0); err != pubrecdb.ErrBadSort {
+		t.Fatalf("Unknown sorts should fail: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package pubrecdb
+
+import (
+	"strings"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+)
+
+// A board is the feed of bulletins that share a tag. The board "news" holds
+// every bulletin tagged with #news in any case.
+var (
+	selectAllBoardsSql string = boardSql("") + `
+		ORDER BY num_bltns DESC, last_h DESC
+	`
+
+	selectBoardSql string = boardSql("AND tags.value = $1 COLLATE NOCASE")
+)
+
+// boardSql sums up every board whose bulletins match cond. The boards are
+// grouped first so that each one is named after a single one of its tags.
+func boardSql(cond string) string {
+	return `
+		SELECT value, num_bltns, first_ts, last_ts, (
+			SELECT b.author FROM tags AS t
+			JOIN bulletins AS b ON t.txid = b.txid
+			JOIN blocks AS k ON b.block = k.hash
+			WHERE t.value = boards.value COLLATE NOCASE AND
+				NOT ` + withheldBltnSql("b") + `
+			ORDER BY k.height ASC, b.txid ASC
+			LIMIT 1
+		)
+		FROM (
+			SELECT min(tags.value) AS value, count(DISTINCT tags.txid) AS num_bltns,
+				min(blocks.timestamp) AS first_ts,
+				max(blocks.timestamp) AS last_ts, max(blocks.height) AS last_h
+			FROM tags JOIN bulletins ON tags.txid = bulletins.txid
+			JOIN blocks ON bulletins.block = blocks.hash
+			WHERE NOT ` + withheldBltnSql("bulletins") + `
+			` + cond + `
+			GROUP BY tags.value COLLATE NOCASE
+		) AS boards
+	`
+}
+
+// GetAllBoards returns a summary of every board in the record. The busiest
+// boards come first.
+func (db *PublicRecord) GetAllBoards() ([]*ombjson.BoardSummary, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	rows, err := db.selectAllBoards.QueryContext(ctx)
+	if err != nil {
+		return []*ombjson.BoardSummary{}, err
+	}
+	defer rows.Close()
+
+	boards := []*ombjson.BoardSummary{}
+	for rows.Next() {
+		board, err := scanBoard(rows)
+		if err != nil {
+			return []*ombjson.BoardSummary{}, err
+		}
+		boards = append(boards, board)
+	}
+	return boards, nil
+}
+
+// GetBoardSummary returns the summary of a single board. If nothing has been
+// posted to the board sql.ErrNoRows is returned and if the board's tag is
+// blacklisted ErrWithheld is.
+func (db *PublicRecord) GetBoardSummary(name string) (*ombjson.BoardSummary, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	listed, err := db.isBlacklisted(BlacklistTag, name)
+	if err != nil {
+		return nil, err
+	}
+	if listed {
+		return nil, ErrWithheld
+	}
+
+	row := db.selectBoard.QueryRowContext(ctx, string(ombstore.BoardTag(name)))
+	return scanBoard(row)
+}
+
+// GetBoard returns the summary of a board along with a page of its bulletins
+// starting from the cursor. If nothing has been posted to the board
+// sql.ErrNoRows is returned.
+func (db *PublicRecord) GetBoard(name string, c *Cursor, limit int) (*ombjson.BoardResp, error) {
+	summary, err := db.GetBoardSummary(name)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := db.queryBltnPage(db.selectTag, c, limit, string(ombstore.BoardTag(name)))
+	if err != nil {
+		return nil, err
+	}
+
+	board := &ombjson.BoardResp{
+		Summary:   summary,
+		Bulletins: page.Bulletins,
+		Withheld:  page.Withheld,
+		Cursors:   page.Cursors,
+	}
+	return board, nil
+}
+
+func scanBoard(cursor scannable) (*ombjson.BoardSummary, error) {
+	var val, createdBy string
+	var numBltns uint64
+	var createdAt, lastActive int64
+
+	err := cursor.Scan(&val, &numBltns, &createdAt, &lastActive, &createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	board := &ombjson.BoardSummary{
+		Name:       strings.TrimPrefix(val, "#"),
+		NumBltns:   numBltns,
+		CreatedAt:  createdAt,
+		LastActive: lastActive,
+		CreatedBy:  createdBy,
+	}
+	return board, nil
+}
@@ -0,0 +1,50 @@
+package pubrecdb_test
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestGetAllBoards(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	boards, err := db.GetAllBoards()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(boards) != 2 || boards[0].Name != "preflight" || boards[0].NumBltns != 2 ||
+		boards[1].Name != "lambs" || boards[1].NumBltns != 1 {
+		t.Fatal(spw(boards))
+	}
+}
+
+func TestGetBoard(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	summary, err := db.GetBoardSummary("#PreFlight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Name != "preflight" || summary.NumBltns != 2 ||
+		summary.CreatedBy != "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy" {
+		t.Fatal(spw(summary))
+	}
+	// Both posts are in the peg block so the board was last active when it
+	// was started, whatever the authors put in their timestamps.
+	if summary.LastActive != summary.CreatedAt {
+		t.Fatal(spw(summary))
+	}
+
+	board, err := db.GetBoard("preflight", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(board.Bulletins) != 1 || board.Next == "" {
+		t.Fatal(spw(board))
+	}
+
+	if _, err := db.GetBoard("wistful", nil, 0); err != sql.ErrNoRows {
+		t.Fatalf("Empty boards should not exist: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package pubrecdb
+
+import (
+	"context"
+	"time"
+)
+
+// WithContext returns a view of the record whose queries and writes are
+// abandoned once ctx is done. The view shares everything else with the
+// record, so it is cheap enough to make one per request.
+func (db *PublicRecord) WithContext(ctx context.Context) Store {
+	view := *db
+	view.ctx = ctx
+	return &view
+}
+
+// SetQueryTimeout bounds how long a single query can run. A query that runs
+// past it fails with context.DeadlineExceeded. Writes are not bounded by it.
+// 0, the default, lets queries run until they are done.
+func (db *PublicRecord) SetQueryTimeout(d time.Duration) {
+	db.queryTimeout = d
+}
+
+// baseCtx returns the context the record was scoped to with WithContext.
+// Writes run in it.
+func (db *PublicRecord) baseCtx() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+	return db.ctx
+}
+
+// queryCtx returns the context a query runs in along with the func that
+// releases it once the query is done.
+func (db *PublicRecord) queryCtx() (context.Context, context.CancelFunc) {
+	if db.queryTimeout > 0 {
+		return context.WithTimeout(db.baseCtx(), db.queryTimeout)
+	}
+	return context.WithCancel(db.baseCtx())
+}
@@ -0,0 +1,47 @@
+package pubrecdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithContextCanceled(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	view := db.WithContext(ctx)
+	if _, err := view.GetLatestPage(nil, 0); err != context.Canceled {
+		t.Fatalf("Canceled query returned: %v", err)
+	}
+	if _, err := view.GetBlockTip(); err != context.Canceled {
+		t.Fatalf("Canceled query returned: %v", err)
+	}
+
+	// The record itself is left alone.
+	if _, err := db.GetLatestPage(nil, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	db.SetQueryTimeout(time.Nanosecond)
+	defer db.SetQueryTimeout(0)
+
+	if _, err := db.GetTag("#preflight", nil, 0); err != context.DeadlineExceeded {
+		t.Fatalf("Query past its deadline returned: %v", err)
+	}
+
+	db.SetQueryTimeout(time.Minute)
+	page, err := db.GetTag("#preflight", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Bulletins) != 2 {
+		t.Fatal(spw(page))
+	}
+}
@@ -2,34 +2,31 @@ package pubrecdb
 
 import (
 	"database/sql"
-	"errors"
 
 	"github.com/btcsuite/btcd/wire"
+	"github.com/soapboxsys/ombudslib/ombjson"
 )
 
 var (
-	ErrBlockNotTip error = errors.New("block is not chain tip")
-
 	// This stmt causes a foreign key cascade.
 	deleteBlockSql string = `
-	DELETE FROM blocks WHERE hash == $1;
+	DELETE FROM blocks WHERE hash = $1;
 	`
 
 	// Utility query
 	blockIsTipSql string = `
-	SELECT EXISTS(SELECT hash FROM 
-		(SELECT hash, MAX(height) FROM blocks) 
-	WHERE hash == $1) AND 
-	NOT EXISTS(SELECT hash FROM blocks where prevhash == $1);
+	SELECT EXISTS(SELECT hash FROM blocks
+		WHERE hash = $1 AND height = (SELECT max(height) FROM blocks)) AND
+	NOT EXISTS(SELECT hash FROM blocks WHERE prevhash = $1);
 	`
 )
 
 func prepareDeletes(db *PublicRecord) (err error) {
-	db.deleteBlockStmt, err = db.conn.Prepare(deleteBlockSql)
+	db.deleteBlockStmt, err = db.prepareWrite(deleteBlockSql)
 	if err != nil {
 		return err
 	}
-	db.blockIsTipStmt, err = db.conn.Prepare(blockIsTipSql)
+	db.blockIsTipStmt, err = db.prepareWrite(blockIsTipSql)
 	if err != nil {
 		return err
 	}
@@ -40,9 +37,16 @@ func prepareDeletes(db *PublicRecord) (err error) {
 // a ErrBlockNotTip  error if you try to delete any block that is not the tip.
 func (db *PublicRecord) DeleteBlockTip(sha *wire.ShaHash) (error, bool) {
 
+	// The block is read before it is gone so that subscribers can be told
+	// what went with it.
+	var removed *ombjson.Block
+	if db.feed.Active() {
+		removed, _ = db.GetBlock(sha)
+	}
+
 	var tx *sql.Tx
 	var err error
-	if tx, err = db.conn.Begin(); err != nil {
+	if tx, err = db.conn.BeginTx(db.baseCtx(), nil); err != nil {
 		return err, false
 	}
 
@@ -54,7 +58,7 @@ func (db *PublicRecord) DeleteBlockTip(sha *wire.ShaHash) (error, bool) {
 	}
 
 	// Delete the block head which cascades deletes through the db
-	_, err = tx.Stmt(db.deleteBlockStmt).Exec(sha.String())
+	_, err = tx.Stmt(db.deleteBlockStmt).ExecContext(db.baseCtx(), sha.String())
 	if err != nil {
 		return tx.Rollback(), false
 	}
@@ -64,6 +68,10 @@ func (db *PublicRecord) DeleteBlockTip(sha *wire.ShaHash) (error, bool) {
 		return err, true
 	}
 
+	if removed != nil && removed.Head != nil {
+		db.watcher.remember(removed)
+	}
+	db.syncFeed()
 	return nil, true
 }
 
@@ -97,6 +105,6 @@ func (db *PublicRecord) DropAfterBlockBySha(sha *wire.ShaHash) error {
 	}
 
 	query := "DELETE FROM blocks WHERE height > $1"
-	_, err = db.conn.Exec(query, blk.Head.Height)
+	_, err = db.conn.ExecContext(db.baseCtx(), query, blk.Head.Height)
 	return err
 }
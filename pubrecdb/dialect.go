@@ -0,0 +1,54 @@
+package pubrecdb
+
+import "database/sql"
+
+// A dialect holds everything about a record that depends on the database it
+// is kept in. The queries themselves are written so that they run on every
+// dialect.
+type dialect struct {
+	// create brings the schema of a record up to date when it is loaded.
+	create func(db *PublicRecord) error
+
+	// replace holds the statements that have to be written differently.
+	// They are keyed by the statement they stand in for.
+	replace map[string]string
+
+	// foreignKeys turns enforcing foreign keys on or off.
+	foreignKeys func(db *PublicRecord, on bool) error
+
+	// fileSize returns the number of bytes the record takes up.
+	fileSize func(db *PublicRecord) (int64, error)
+
+	// integrityCheck returns the problems found in the record. A record
+	// without any returns the single message "ok".
+	integrityCheck func(db *PublicRecord) ([]string, error)
+}
+
+// sqliteDialect keeps the record in a single sqlite file.
+var sqliteDialect = &dialect{
+	create:         createSqlite,
+	replace:        map[string]string{},
+	foreignKeys:    sqliteForeignKeys,
+	fileSize:       sqliteFileSize,
+	integrityCheck: sqliteIntegrityCheck,
+}
+
+// prepare compiles the query in the dialect of the record. It runs on the
+// read pool.
+func (db *PublicRecord) prepare(query string) (*sql.Stmt, error) {
+	return db.rconn.Prepare(db.dialect.rewrite(query))
+}
+
+// prepareWrite compiles a statement that writes, or that is used inside a
+// transaction that does, on the writer.
+func (db *PublicRecord) prepareWrite(query string) (*sql.Stmt, error) {
+	return db.conn.Prepare(db.dialect.rewrite(query))
+}
+
+// rewrite returns the statement the dialect uses in place of query.
+func (d *dialect) rewrite(query string) string {
+	if q, ok := d.replace[query]; ok {
+		return q
+	}
+	return query
+}
@@ -0,0 +1,113 @@
+package pubrecdb
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// The consensus rules that set the difficulty of a block. They are the same
+// on mainnet and testnet.
+const (
+	retargetInterval = 2016
+	targetTimespan   = int64(14 * 24 * time.Hour / time.Second)
+	retargetFactor   = 4
+
+	// On testnet a block mined this long after the one before it may use
+	// the lowest difficulty.
+	minDiffReduction = int64(20 * time.Minute / time.Second)
+)
+
+// calcRetarget returns the difficulty that follows a retarget window that
+// started at firstTs and whose last block at lastTs had lastBits.
+func calcRetarget(params *chaincfg.Params, firstTs, lastTs int64, lastBits uint32) uint32 {
+	timespan := lastTs - firstTs
+	if timespan < targetTimespan/retargetFactor {
+		timespan = targetTimespan / retargetFactor
+	}
+	if timespan > targetTimespan*retargetFactor {
+		timespan = targetTimespan * retargetFactor
+	}
+
+	target := blockchain.CompactToBig(lastBits)
+	target.Mul(target, big.NewInt(timespan))
+	target.Div(target, big.NewInt(targetTimespan))
+	if target.Cmp(params.PowLimit) > 0 {
+		target.Set(params.PowLimit)
+	}
+	return blockchain.BigToCompact(target)
+}
+
+// diffCheck follows the difficulty along the chain as each header is checked
+// in order of height. A record only holds the blocks from its peg block up,
+// so a retarget whose window starts below the peg is not recomputed.
+type diffCheck struct {
+	params   *chaincfg.Params
+	lastTs   int64
+	lastBits uint32
+	// realBits is the difficulty of the last testnet block that did not use
+	// the lowest difficulty. It is 0 until one is seen.
+	realBits uint32
+	// windowTs holds the timestamps of the blocks that start a window.
+	windowTs map[int32]int64
+}
+
+func newDiffCheck(params *chaincfg.Params) *diffCheck {
+	return &diffCheck{
+		params:   params,
+		windowTs: make(map[int32]int64),
+	}
+}
+
+// next checks the difficulty of the block at height and then moves on to it.
+// The first block passed in is only checked against the proof of work limit.
+// It returns why the difficulty is wrong or "" if it is right.
+func (d *diffCheck) next(height int32, ts int64, bits uint32, first bool) string {
+	reason := d.check(height, ts, bits, first)
+
+	if height%retargetInterval == 0 {
+		d.windowTs[height] = ts
+	}
+	if height%retargetInterval == 0 || bits != d.params.PowLimitBits {
+		d.realBits = bits
+	}
+	d.lastTs, d.lastBits = ts, bits
+	return reason
+}
+
+func (d *diffCheck) check(height int32, ts int64, bits uint32, first bool) string {
+	if blockchain.CompactToBig(bits).Cmp(d.params.PowLimit) > 0 {
+		return fmt.Sprintf("difficulty %08x is easier than the proof of work limit", bits)
+	}
+	if first {
+		return ""
+	}
+
+	var want uint32
+	switch {
+	case height%retargetInterval == 0:
+		firstTs, ok := d.windowTs[height-retargetInterval]
+		if !ok {
+			return ""
+		}
+		want = calcRetarget(d.params, firstTs, d.lastTs, d.lastBits)
+	case d.params.Net == wire.TestNet3 && ts > d.lastTs+minDiffReduction:
+		want = d.params.PowLimitBits
+	case d.params.Net == wire.TestNet3:
+		if d.realBits == 0 {
+			return ""
+		}
+		want = d.realBits
+	default:
+		want = d.lastBits
+	}
+
+	if bits != want {
+		return fmt.Sprintf("difficulty %08x should be %08x", bits, want)
+	}
+	return ""
+}
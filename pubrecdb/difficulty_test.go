@@ -0,0 +1,63 @@
+package pubrecdb
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestCalcRetarget(t *testing.T) {
+	// Retargets taken from mainnet.
+	tests := []struct {
+		firstTs  int64
+		lastTs   int64
+		lastBits uint32
+		want     uint32
+	}{
+		{1261130161, 1262152739, 0x1d00ffff, 0x1d00d86a}, // Block 32256
+		{1231006505, 1233061996, 0x1d00ffff, 0x1d00ffff}, // Capped at the limit
+		{1279008237, 1279297671, 0x1c05a3f4, 0x1c0168fd}, // Capped at 4x harder
+		{1263163443, 1269211443, 0x1c387f6f, 0x1d00e1fd}, // Capped at 4x easier
+	}
+	for _, test := range tests {
+		got := calcRetarget(&chaincfg.MainNetParams, test.firstTs, test.lastTs, test.lastBits)
+		if got != test.want {
+			t.Errorf("Retarget of %08x is %08x not %08x", test.lastBits, got, test.want)
+		}
+	}
+}
+
+func TestDiffCheck(t *testing.T) {
+	d := newDiffCheck(&chaincfg.MainNetParams)
+	if r := d.next(retargetInterval-1, 1000, 0x1d00ffff, true); r != "" {
+		t.Fatal(r)
+	}
+
+	// Difficulty only changes at a retarget.
+	if r := d.next(retargetInterval, 2000, 0x1d00d86a, false); r != "" {
+		t.Fatalf("Retarget below the peg should pass: %s", r)
+	}
+	if r := d.next(retargetInterval+1, 3000, 0x1c00d86a, false); r == "" {
+		t.Fatal("Difficulty changed between retargets")
+	}
+
+	d = newDiffCheck(&chaincfg.MainNetParams)
+	if r := d.next(10, 1000, 0x1e00ffff, true); r == "" {
+		t.Fatal("Difficulty above the proof of work limit passed")
+	}
+
+	// A testnet block mined 20 minutes after the last may use the lowest
+	// difficulty but the one after it goes back.
+	params := &chaincfg.TestNet3Params
+	d = newDiffCheck(params)
+	d.next(11, 1000, 0x1c00ffff, true)
+	if r := d.next(12, 1000+minDiffReduction+1, params.PowLimitBits, false); r != "" {
+		t.Fatal(r)
+	}
+	if r := d.next(13, 1000+minDiffReduction+2, params.PowLimitBits, false); r == "" {
+		t.Fatal("Lowest difficulty used too soon")
+	}
+	if r := d.next(14, 1000+minDiffReduction+3, 0x1c00ffff, false); r != "" {
+		t.Fatal(r)
+	}
+}
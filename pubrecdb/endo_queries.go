@@ -4,14 +4,21 @@ import (
 	"database/sql"
 
 	"github.com/btcsuite/btcd/wire"
-	"github.com/btcsuite/btcutil"
 	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
 )
 
 var (
+	// nonRecordSql is true for the endorsement aliased as e when its bid is
+	// known not to be a bulletin.
+	nonRecordSql string = `
+		EXISTS(SELECT * FROM orphan_endos WHERE txid = e.txid AND non_record != 0)
+	`
+
 	selectEndosByBidSql string = `
 		SELECT e.txid, e.author, e.bid, e.timestamp, e.block, 
-			   blocks.height, blocks.timestamp, NULL
+			   blocks.height, blocks.timestamp, NULL, ` + withheldEndoSql("e") + `,
+			   ` + nonRecordSql + `
 		From endorsements as e
 		LEFT JOIN blocks ON blocks.hash = e.block
 		WHERE e.bid = $1
@@ -19,24 +26,27 @@ var (
 
 	selectEndoSql string = `
 		SELECT e.txid, e.author, e.bid, e.timestamp, e.block, 
-			   blocks.height, blocks.timestamp, bulletins.txid
+			   blocks.height, blocks.timestamp, bulletins.txid, ` + withheldEndoSql("e") + `,
+			   ` + nonRecordSql + `
 		FROM endorsements as e
 		LEFT JOIN blocks ON blocks.hash = e.block
 		LEFT JOIN bulletins ON bulletins.txid = e.bid
 		WHERE e.txid = $1
 	`
 
-	selectAuthorEndosSql string = `
+	// endoSql selects endorsements for the paged queries that filter them.
+	endoSql string = `
 		SELECT e.txid, e.author, e.bid, e.timestamp, e.block, 
-			   blocks.height, blocks.timestamp, bulletins.txid
+			   blocks.height, blocks.timestamp, bulletins.txid, ` + withheldEndoSql("e") + `,
+			   ` + nonRecordSql + `
 		FROM endorsements as e
 		LEFT JOIN blocks ON blocks.hash = e.block
 		LEFT JOIN bulletins ON bulletins.txid = e.bid
-		WHERE e.author = $1
 	`
 	selectEndosByHeightSql string = `
 		SELECT e.txid, e.author, e.bid, e.timestamp, e.block, 
-			   blocks.height, blocks.timestamp, bulletins.txid
+			   blocks.height, blocks.timestamp, bulletins.txid, ` + withheldEndoSql("e") + `,
+			   ` + nonRecordSql + `
 		FROM endorsements as e
 		LEFT JOIN blocks ON blocks.hash = e.block
 		LEFT JOIN bulletins ON bulletins.txid = e.bid
@@ -47,68 +57,104 @@ var (
 // GetEndosByHeight returns all of the endorsements between start and
 // stop where anything stored at the stop height is excluded
 func (db *PublicRecord) GetEndosByHeight(startH, stopH int32) ([]*ombjson.Endorsement, error) {
-	rows, err := db.selectEndosByHeight.Query(startH, stopH)
-	defer rows.Close()
-	if err != nil {
-		return []*ombjson.Endorsement{}, err
-	}
-	endos, err := scanEndos(rows)
+	endos, _, err := db.getEndosByHeight(startH, stopH)
+	return endos, err
+}
+
+// getEndosByHeight works like GetEndosByHeight and also reports if any of the
+// endorsements were withheld.
+func (db *PublicRecord) getEndosByHeight(startH, stopH int32) ([]*ombjson.Endorsement, bool, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	rows, err := db.selectEndosByHeight.QueryContext(ctx, startH, stopH)
 	if err != nil {
-		return []*ombjson.Endorsement{}, err
+		return []*ombjson.Endorsement{}, false, err
 	}
-	return endos, nil
+	defer rows.Close()
+	return scanEndos(rows)
 }
 
 // GetEndorsement returns a single json Endorsement. If the record does not
-// exist the method throws sql.ErrNoRows
-func (db *PublicRecord) GetEndorsement(txid *wire.ShaHash) (*ombjson.Endorsement, error) {
-	row := db.selectEndo.QueryRow(txid.String())
-	return scanEndo(row)
+// exist the method throws sql.ErrNoRows and if it is blacklisted ErrWithheld.
+// Passing WithProof adds its merkle proof.
+func (db *PublicRecord) GetEndorsement(txid *wire.ShaHash, opts ...RecordOption) (*ombjson.Endorsement, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	row := db.selectEndo.QueryRowContext(ctx, txid.String())
+	endo, err := scanEndo(row)
+	if err != nil {
+		return nil, err
+	}
+
+	endo.Proof, err = ombstore.OptProof(opts, txid, db.GetProof)
+	if err != nil {
+		return nil, err
+	}
+	return endo, nil
 }
 
 // GetEndosByBid returns all of the endorsements for a specific bulletin. This
 // is used by GetBulletin to fill out the endorsements a specific bulletin has
 // received.
 func (db *PublicRecord) GetEndosByBid(bid *wire.ShaHash) ([]*ombjson.Endorsement, error) {
-	rows, err := db.selectEndosByBid.Query(bid.String())
-	defer rows.Close()
-	if err != nil {
-		return []*ombjson.Endorsement{}, err
-	}
-	return scanEndos(rows)
-}
+	ctx, cancel := db.queryCtx()
+	defer cancel()
 
-func (db *PublicRecord) getAuthorEndos(author btcutil.Address) ([]*ombjson.Endorsement, error) {
-	rows, err := db.selectAuthorEndos.Query(author.String())
-	defer rows.Close()
+	rows, err := db.selectEndosByBid.QueryContext(ctx, bid.String())
 	if err != nil {
 		return []*ombjson.Endorsement{}, err
 	}
-	return scanEndos(rows)
+	defer rows.Close()
+	endos, _, err := scanEndos(rows)
+	return endos, err
 }
 
-func scanEndos(rows *sql.Rows) ([]*ombjson.Endorsement, error) {
+// scanEndos returns the endorsements in rows that are not blacklisted and
+// reports if any were withheld.
+func scanEndos(rows *sql.Rows) ([]*ombjson.Endorsement, bool, error) {
 	endos := []*ombjson.Endorsement{}
+	anyWithheld := false
 	for rows.Next() {
-		endo, err := scanEndo(rows)
+		endo, withheld, err := scanEndoRow(rows)
 		if err != nil {
-			return []*ombjson.Endorsement{}, err
+			return []*ombjson.Endorsement{}, false, err
+		}
+		if withheld {
+			anyWithheld = true
+			continue
 		}
 		endos = append(endos, endo)
 	}
-	return endos, nil
+	return endos, anyWithheld, nil
 }
 
+// scanEndo scans a single endorsement. If the endorsement is blacklisted
+// ErrWithheld is returned.
 func scanEndo(cursor scannable) (*ombjson.Endorsement, error) {
+	endo, withheld, err := scanEndoRow(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if withheld {
+		return nil, ErrWithheld
+	}
+	return endo, nil
+}
+
+// scanEndoRow scans an endorsement and whether it is withheld.
+func scanEndoRow(cursor scannable) (*ombjson.Endorsement, bool, error) {
 
 	var txid, blkHash, bid, author string
 	var bltnTxid sql.NullString
 	var endoTs, blkHeight, blkTs int64
+	var withheld, nonRecord bool
 
 	err := cursor.Scan(&txid, &author, &bid, &endoTs,
-		&blkHash, &blkHeight, &blkTs, &bltnTxid)
+		&blkHash, &blkHeight, &blkTs, &bltnTxid, &withheld, &nonRecord)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	endo := &ombjson.Endorsement{
@@ -117,6 +163,7 @@ func scanEndo(cursor scannable) (*ombjson.Endorsement, error) {
 		Bid:        bid,
 		BltnExists: false,
 		Timestamp:  endoTs,
+		NonRecord:  nonRecord,
 		BlockRef: &ombjson.BlockRef{
 			Hash:      blkHash,
 			Timestamp: blkTs,
@@ -126,5 +173,5 @@ func scanEndo(cursor scannable) (*ombjson.Endorsement, error) {
 	if bltnTxid.Valid {
 		endo.BltnExists = true
 	}
-	return endo, nil
+	return endo, withheld, nil
 }
@@ -0,0 +1,146 @@
+package pubrecdb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+// The most blocks the tip can move by between two looks at it before the
+// subscribers are dropped with ErrFellBehind instead of told what changed.
+var watchDepth = 64
+
+// A watcher turns moves of the block tip into events. It holds the blocks it
+// last published, oldest first, so that it can tell which of them were
+// disconnected when the tip moves onto another branch. It does not matter
+// which process moved the tip.
+type watcher struct {
+	mu    sync.Mutex
+	chain []*ombjson.Block
+}
+
+// find returns the index of the block in the chain or -1.
+func (w *watcher) find(hash string) int {
+	for i, blk := range w.chain {
+		if blk.Head.Hash == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// remember puts the records of a block the watcher already holds next to
+// its head, so that they go out with it if it is disconnected.
+func (w *watcher) remember(blk *ombjson.Block) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if i := w.find(blk.Head.Hash); i >= 0 {
+		w.chain[i] = blk
+	}
+}
+
+// Subscribe returns a subscription to the events that pass filter. Events
+// are published once InsertUBlock and DeleteBlockTip have committed, and for
+// changes made by other processes once Watch sees them. Views made with
+// WithContext share the subscriptions of the record.
+func (db *PublicRecord) Subscribe(filter EventFilter) *Subscription {
+	w := db.watcher
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// The tip is only followed while someone is subscribed.
+	if !db.feed.Active() || len(w.chain) == 0 {
+		w.chain = nil
+		if tip, err := db.GetBlockTip(); err == nil {
+			w.chain = []*ombjson.Block{tip}
+		}
+	}
+	return db.feed.Subscribe(filter)
+}
+
+// Watch publishes the changes other processes make to the record until ctx
+// is done. The tip is read every interval and the blocks disconnected and
+// connected since it was last seen are published. A read that fails is
+// tried again on the next tick.
+func (db *PublicRecord) Watch(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	db.syncFeed()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			db.syncFeed()
+		}
+	}
+}
+
+// syncFeed publishes what changed in the record since the tip was last seen.
+// If the record cannot be read nothing is published and the change is
+// picked up by the next call, so subscribers do not miss it.
+func (db *PublicRecord) syncFeed() error {
+	w := db.watcher
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !db.feed.Active() {
+		w.chain = nil
+		return nil
+	}
+	tip, err := db.GetBlockTip()
+	if err != nil {
+		return err
+	}
+	if len(w.chain) == 0 {
+		w.chain = []*ombjson.Block{tip}
+		return nil
+	}
+	if w.chain[len(w.chain)-1].Head.Hash == tip.Head.Hash {
+		return nil
+	}
+
+	// Walk back from the new tip to the block it shares with the chain. A
+	// block below the oldest one held cannot have changed.
+	fork := -1
+	added := []*ombjson.Block{}
+	hash, height := tip.Head.Hash, tip.Head.Height
+	for height >= w.chain[0].Head.Height {
+		if fork = w.find(hash); fork >= 0 {
+			break
+		}
+		if len(added) == watchDepth {
+			db.feed.End(ErrFellBehind)
+			w.chain = []*ombjson.Block{tip}
+			return nil
+		}
+		sha, err := wire.NewShaHashFromStr(hash)
+		if err != nil {
+			return err
+		}
+		blk, err := db.GetBlock(sha)
+		if err != nil {
+			return err
+		}
+		added = append(added, blk)
+		hash, height = blk.Head.PrevHash, blk.Head.Height-1
+	}
+
+	for i := len(w.chain) - 1; i > fork; i-- {
+		db.feed.PublishBlock(BlockDisconnected, w.chain[i], nil)
+	}
+	chain := append([]*ombjson.Block{}, w.chain[:fork+1]...)
+	for i := len(added) - 1; i >= 0; i-- {
+		db.feed.PublishBlock(BlockConnected, added[i], nil)
+		chain = append(chain, added[i])
+	}
+	if len(chain) > watchDepth {
+		chain = chain[len(chain)-watchDepth:]
+	}
+	w.chain = chain
+	return nil
+}
@@ -0,0 +1,149 @@
+package pubrecdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+// nextEvent returns the event waiting on the subscription. Events are
+// published before the write returns so there is nothing to wait for.
+func nextEvent(t *testing.T, sub *pubrecdb.Subscription) *pubrecdb.Event {
+	select {
+	case ev, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("Subscription ended: %v", sub.Err())
+		}
+		return ev
+	default:
+		t.Fatal("No event was published")
+	}
+	return nil
+}
+
+func TestSubscribe(t *testing.T) {
+	db, _ := SetupTestDB(false)
+
+	all := db.Subscribe(nil)
+	defer all.Close()
+	bltns := db.Subscribe(pubrecdb.KindFilter(pubrecdb.BulletinAdded))
+	defer bltns.Close()
+
+	blk, bltnTx := recordBlock(t, "Tell everyone #feed")
+	ublk := ombutil.CreateUBlock(blk, nil, &chaincfg.MainNetParams)
+	if err, ok := db.InsertUBlock(ublk); err != nil || !ok {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	ev := nextEvent(t, all)
+	if ev.Kind != pubrecdb.BlockConnected || ev.Block.Hash != blk.Sha().String() {
+		t.Fatal(spw(ev))
+	}
+	ev = nextEvent(t, all)
+	if ev.Kind != pubrecdb.BulletinAdded || ev.Bulletin.Txid != bltnTx.TxSha().String() {
+		t.Fatal(spw(ev))
+	}
+	ev = nextEvent(t, bltns)
+	if ev.Kind != pubrecdb.BulletinAdded {
+		t.Fatal(spw(ev))
+	}
+
+	if err, ok := db.DeleteBlockTip(blk.Sha()); err != nil || !ok {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	ev = nextEvent(t, all)
+	if ev.Kind != pubrecdb.BlockDisconnected || len(ev.Bulletins) != 1 {
+		t.Fatal(spw(ev))
+	}
+	select {
+	case ev := <-bltns.Events():
+		t.Fatal(spw(ev))
+	default:
+	}
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	db := setupMemRecord()
+
+	sub := db.Subscribe(nil)
+	sub.Close()
+	sub.Close()
+
+	if _, ok := <-sub.Events(); ok {
+		t.Fatal("Closed subscription got an event")
+	}
+	if sub.Err() != nil {
+		t.Fatal(sub.Err())
+	}
+}
+
+// waitEvent returns the next event on the subscription once Watch has
+// published it.
+func waitEvent(t *testing.T, sub *pubrecdb.Subscription) *pubrecdb.Event {
+	select {
+	case ev, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("Subscription ended: %v", sub.Err())
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("No event was published")
+	}
+	return nil
+}
+
+// TestWatch writes with one record and watches with another, like ombnode
+// and ombwebrelay do with the same file.
+func TestWatch(t *testing.T) {
+	writer, _ := SetupTestDB(false)
+
+	var reader *pubrecdb.PublicRecord
+	var err error
+	if testPgURL != "" {
+		reader, err = pubrecdb.LoadPgDB(testPgURL)
+	} else {
+		reader, err = pubrecdb.LoadDB(getPath(), nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := reader.Subscribe(nil)
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reader.Watch(ctx, 10*time.Millisecond)
+
+	blk, bltnTx := recordBlock(t, "Heard it from the other process #feed")
+	ublk := ombutil.CreateUBlock(blk, nil, &chaincfg.MainNetParams)
+	if err, ok := writer.InsertUBlock(ublk); err != nil || !ok {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	ev := waitEvent(t, sub)
+	if ev.Kind != pubrecdb.BlockConnected || ev.Block.Hash != blk.Sha().String() {
+		t.Fatal(spw(ev))
+	}
+	ev = waitEvent(t, sub)
+	if ev.Kind != pubrecdb.BulletinAdded || ev.Bulletin.Txid != bltnTx.TxSha().String() {
+		t.Fatal(spw(ev))
+	}
+
+	if err, ok := writer.DeleteBlockTip(blk.Sha()); err != nil || !ok {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// The records of the block are gone from the file by now. They come
+	// from what the watcher published before.
+	ev = waitEvent(t, sub)
+	if ev.Kind != pubrecdb.BlockDisconnected || ev.Block.Hash != blk.Sha().String() ||
+		len(ev.Bulletins) != 1 {
+		t.Fatal(spw(ev))
+	}
+}
@@ -31,22 +31,22 @@ var (
 )
 
 func prepareInserts(db *PublicRecord) (err error) {
-	db.insertBlockHeadStmt, err = db.conn.Prepare(insertBlockHeadSql)
+	db.insertBlockHeadStmt, err = db.prepareWrite(insertBlockHeadSql)
 	if err != nil {
 		return err
 	}
 
-	db.insertBulletinStmt, err = db.conn.Prepare(insertBulletinSql)
+	db.insertBulletinStmt, err = db.prepareWrite(insertBulletinSql)
 	if err != nil {
 		return err
 	}
 
-	db.insertTagStmt, err = db.conn.Prepare(insertTagSql)
+	db.insertTagStmt, err = db.prepareWrite(insertTagSql)
 	if err != nil {
 		return err
 	}
 
-	db.insertEndorsementStmt, err = db.conn.Prepare(insertEndoSql)
+	db.insertEndorsementStmt, err = db.prepareWrite(insertEndoSql)
 	if err != nil {
 		return err
 	}
@@ -62,7 +62,7 @@ func prepareInserts(db *PublicRecord) (err error) {
 func (db *PublicRecord) InsertUBlock(oblk *ombutil.UBlock) (error, bool) {
 
 	// Start a Sql Transaction
-	tx, err := db.conn.Begin()
+	tx, err := db.conn.BeginTx(db.baseCtx(), nil)
 
 	err = db.insertBlockHead(tx, oblk.Block)
 	if err != nil {
@@ -85,7 +85,35 @@ func (db *PublicRecord) InsertUBlock(oblk *ombutil.UBlock) (error, bool) {
 		}
 	}
 
-	return tx.Commit(), true
+	// Keep the proof that each record was mined in the block
+	if err = db.insertProofs(tx, oblk); err != nil {
+		return tx.Rollback(), false
+	}
+
+	if db.keepRawTxs {
+		if err = db.insertRawTxs(tx, oblk.Block); err != nil {
+			return tx.Rollback(), false
+		}
+	}
+
+	// Endorsements waiting on a tx in this block that is not a bulletin
+	// never will be linked
+	if err = db.flagNonRecordBids(tx, oblk); err != nil {
+		return tx.Rollback(), false
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err, true
+	}
+
+	// Rank the authors again when the graph could have changed
+	if len(oblk.Bulletins) > 0 || len(oblk.Endorsements) > 0 {
+		db.rankInBackground()
+	}
+
+	// A block that cannot be read back now is published by the next sync
+	db.syncFeed()
+	return nil, true
 }
 
 func (db *PublicRecord) insertBlockHead(tx *sql.Tx, blk *btcutil.Block) error {
@@ -114,7 +142,7 @@ func (db *PublicRecord) insertBlockHead(tx *sql.Tx, blk *btcutil.Block) error {
 // If the block is already in the record then an error is thrown. It
 // makes no effort to insert bulletins or endorsements contained within it.
 func (db *PublicRecord) InsertBlockHead(blk *btcutil.Block) (error, bool) {
-	tx, err := db.conn.Begin()
+	tx, err := db.conn.BeginTx(db.baseCtx(), nil)
 	if err != nil {
 		return err, false
 	}
@@ -181,7 +209,7 @@ func (db *PublicRecord) InsertBulletin(bltn *ombutil.Bulletin) (error, bool) {
 	// Start a sql transaction to insert the bulletin and the relevant tags.
 	var tx *sql.Tx
 	var err error
-	if tx, err = db.conn.Begin(); err != nil {
+	if tx, err = db.conn.BeginTx(db.baseCtx(), nil); err != nil {
 		return err, false
 	}
 
@@ -222,11 +250,12 @@ func (db *PublicRecord) insertEndorsement(tx *sql.Tx, endo *ombutil.Endorsement)
 // InsertEndorsement commits an endorsement into the public record. It DOES NOT
 // enforce foreign key constraints. This allows endorsements to come in out of
 // order (or in a staggered fashion) endorsing a bulletin that is yet to be
-// mined.
+// mined. Until the bulletin is stored the endorsement is listed by
+// GetOrphanEndorsements.
 func (db *PublicRecord) InsertEndorsement(endo *ombutil.Endorsement) (error, bool) {
 	var tx *sql.Tx
 	var err error
-	if tx, err = db.conn.Begin(); err != nil {
+	if tx, err = db.conn.BeginTx(db.baseCtx(), nil); err != nil {
 		return err, false
 	}
 
@@ -4,55 +4,145 @@ import (
 	"math"
 
 	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
 )
 
 var (
-	selectNearbyBltns string = bltnSql + `
-		FROM bulletins LEFT JOIN blocks ON bulletins.block = blocks.hash
-		LEFT JOIN endorsements ON bulletins.txid = endorsements.bid
-		WHERE bulletins.latitude IS NOT NULL AND bulletins.longitude IS NOT NULL AND
-			dist($1, $2, bulletins.latitude, bulletins.longitude) < $3
-		GROUP BY bulletins.txid HAVING bulletins.txid NOT null
-		ORDER BY blocks.timestamp DESC
+	// createSpatialSql is the part of the schema that builds the R*Tree used
+	// to pre-filter location queries.
+	createSpatialSql string = `
+-- The spatial index over located bulletins. bltn_locs gives every located
+-- bulletin a stable integer id that the R*Tree is keyed on. Both are kept in
+-- sync with bulletins by the triggers below.
+CREATE TABLE IF NOT EXISTS bltn_locs (
+    id          INTEGER PRIMARY KEY,
+    txid        TEXT UNIQUE NOT NULL,
+
+    FOREIGN KEY(txid) REFERENCES bulletins(txid) ON DELETE CASCADE
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS bltn_rtree USING rtree(
+    id,
+    minLat, maxLat,
+    minLon, maxLon
+);
+
+CREATE TRIGGER IF NOT EXISTS bltn_locs_insert AFTER INSERT ON bulletins
+WHEN new.latitude IS NOT NULL AND new.longitude IS NOT NULL
+BEGIN
+    INSERT INTO bltn_locs (txid) VALUES (new.txid);
+    INSERT INTO bltn_rtree (id, minLat, maxLat, minLon, maxLon)
+    VALUES (last_insert_rowid(), new.latitude, new.latitude, new.longitude, new.longitude);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bltn_locs_delete AFTER DELETE ON bltn_locs
+BEGIN
+    DELETE FROM bltn_rtree WHERE id = old.id;
+END;
+`
+
+	// backfillSpatialSql indexes any located bulletins that are missing from
+	// the R*Tree.
+	backfillSpatialSql string = `
+		INSERT INTO bltn_locs (txid)
+		SELECT txid FROM bulletins
+		WHERE latitude IS NOT NULL AND longitude IS NOT NULL AND
+			txid NOT IN (SELECT txid FROM bltn_locs);
+
+		INSERT INTO bltn_rtree (id, minLat, maxLat, minLon, maxLon)
+		SELECT bltn_locs.id, latitude, latitude, longitude, longitude
+		FROM bltn_locs JOIN bulletins ON bltn_locs.txid = bulletins.txid
+		WHERE bltn_locs.id NOT IN (SELECT id FROM bltn_rtree);
+	`
+
+	// inBoxSql matches bulletins inside of the latitude band [$1, $2] and
+	// either of the longitude bands [$3, $4] or [$5, $6].
+	inBoxSql string = `
+		bulletins.txid IN (
+			SELECT bltn_locs.txid FROM bltn_rtree
+			JOIN bltn_locs ON bltn_rtree.id = bltn_locs.id
+			WHERE bltn_rtree.maxLat >= $1 AND bltn_rtree.minLat <= $2 AND (
+				(bltn_rtree.maxLon >= $3 AND bltn_rtree.minLon <= $4) OR
+				(bltn_rtree.maxLon >= $5 AND bltn_rtree.minLon <= $6))
+		)
+	`
+
+	// nearbyCond matches bulletins in the box of inBoxSql that are also
+	// within $9 meters of $7, $8.
+	nearbyCond string = inBoxSql + ` AND
+		dist($7, $8, bulletins.latitude, bulletins.longitude) < $9
+	`
+
+	selectNearbyBltnsByDist string = pagedBltnSql + `
+		WHERE ` + nearbyCond + groupBltnSql + `
+		ORDER BY dist($7, $8, bulletins.latitude, bulletins.longitude) ASC
 	`
 )
 
-// GetNearbyBltns returns bulletins that were tagged with a location within r
-// kilometers of lat, lon. The bulletin are ordered by block timestamp and are
-// NOT sorted by distance from the point.
-func (db *PublicRecord) GetNearbyBltns(lat, lon, r float64) ([]*ombjson.Bulletin, error) {
-	rows, err := db.selectNearbyBltns.Query(lat, lon, r*1000)
-	defer rows.Close()
+// buildSpatialIndex creates the R*Tree if it is missing and indexes every
+// located bulletin that is not in it yet.
+func buildSpatialIndex(db *PublicRecord) error {
+	if _, err := db.conn.Exec(createSpatialSql); err != nil {
+		return err
+	}
+	if _, err := db.conn.Exec(backfillSpatialSql); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetNearbyBltns returns a page of bulletins that were tagged with a location
+// within r kilometers of lat, lon starting from the cursor. The bulletins are
+// ordered like every other list and are NOT sorted by distance from the point.
+func (db *PublicRecord) GetNearbyBltns(lat, lon, r float64, c *Cursor, limit int) (*ombjson.BltnPage, error) {
+	// The R*Tree narrows the search down to the box that bounds the circle
+	// before the exact distance is computed for each remaining bulletin.
+	a, b := ombstore.BoundingBox(lat, lon, r*1000)
+	return db.queryBltnPage(db.selectNearbyBltns, c, limit, a.MinLat, a.MaxLat,
+		a.MinLon, a.MaxLon, b.MinLon, b.MaxLon, lat, lon, r*1000)
+}
+
+// GetNearbyBltnsByDist returns up to limit of the bulletins within r
+// kilometers of lat, lon ordered by their distance from the point with the
+// closest first. Since the order is not the one cursors follow the results
+// cannot be paged through. It reports if any bulletin closer than the last
+// one returned was withheld.
+func (db *PublicRecord) GetNearbyBltnsByDist(lat, lon, r float64, limit int) ([]*ombjson.Bulletin, bool, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	a, b := ombstore.BoundingBox(lat, lon, r*1000)
+
+	rows, err := db.selectNearbyBltnsByDist.QueryContext(ctx, a.MinLat, a.MaxLat, a.MinLon,
+		a.MaxLon, b.MinLon, b.MaxLon, lat, lon, r*1000)
 	if err != nil {
-		return []*ombjson.Bulletin{}, err
+		return []*ombjson.Bulletin{}, false, err
 	}
+	defer rows.Close()
 
-	bltns, err := scanBltns(rows)
+	bltns, withheld, err := db.scanTopBltns(rows, db.pageLimit(limit))
 	if err != nil {
-		return []*ombjson.Bulletin{}, err
+		return []*ombjson.Bulletin{}, false, err
 	}
 
-	return bltns, nil
+	return bltns, withheld, nil
 }
 
-// distance uses the distance formula derived using the spherical law of cosines
-// to reasonablely accurate approximations of the distances between 'a' and
-// 'b' on the earth's surface. The reference implementation lives at this site:
-// http://www.movable-type.co.uk/scripts/latlong.html
-func distance(a_lat, a_lon, b_lat, b_lon float64) float64 {
-	ToRad := func(x float64) float64 {
-		return x * (math.Pi / 180)
+// GetBulletinsInBBox returns a page of the bulletins located within the box
+// bounded by the passed latitudes and longitudes starting from the cursor. A
+// box where minLon is greater than maxLon crosses the antimeridian. Latitudes
+// past the poles are clamped to them.
+func (db *PublicRecord) GetBulletinsInBBox(minLat, minLon, maxLat, maxLon float64, c *Cursor, limit int) (*ombjson.BltnPage, error) {
+	if minLat > maxLat {
+		return nil, ErrBadBBox
 	}
-	φ1 := ToRad(a_lat)
-	φ2 := ToRad(b_lat)
-	λ := ToRad(b_lon - a_lon)
-
-	// Earth's radius in meters.
-	R := 6371000.0
-	z := math.Sin(φ1)*math.Sin(φ2) + math.Cos(φ1)*math.Cos(φ2)*math.Cos(λ)
-	d := math.Acos(z) * R
+	a, b := ombstore.NewGeoBox(minLat, minLon, maxLat, maxLon)
+	return db.queryBltnPage(db.selectBBoxBltns, c, limit, boxArgs(a, b)...)
+}
 
-	return d
+// boxArgs returns the params inBoxSql takes for the pair of boxes.
+func boxArgs(a, b ombstore.GeoBox) []interface{} {
+	return []interface{}{a.MinLat, a.MaxLat, a.MinLon, a.MaxLon, b.MinLon, b.MaxLon}
 }
 
 // Exists to help us test our implementation. Computes x^y
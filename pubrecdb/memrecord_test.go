@@ -0,0 +1,129 @@
+package pubrecdb_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/memrecord"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+// setupMemRecord fills a memrecord.Record with the same rows SetupTestDB
+// adds.
+func setupMemRecord() *memrecord.Record {
+	db, err := memrecord.New(&chaincfg.MainNetParams)
+	if err != nil {
+		panic(err)
+	}
+	setupTestInsertBlocks(db)
+	setupTestInsertBltns(db)
+	setupTestInsertEndos(db)
+	return db
+}
+
+// nextPage returns the page after the one fetched with get.
+func nextPage(get func(c *pubrecdb.Cursor) (interface{}, string, error)) (interface{}, error) {
+	first, next, err := get(nil)
+	if err != nil {
+		return nil, err
+	}
+	c, err := pubrecdb.ParseCursor(next)
+	if err != nil {
+		return nil, err
+	}
+	second, _, err := get(c)
+	return []interface{}{first, second}, err
+}
+
+func TestMemRecordParity(t *testing.T) {
+	sqldb, _ := SetupTestDB(true)
+	memdb := setupMemRecord()
+
+	auth, _ := btcutil.DecodeAddress("3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", &chaincfg.MainNetParams)
+	ts := time.Unix(123456789, 0)
+
+	queries := map[string]func(db pubrecdb.Store) (interface{}, error){
+		"bulletin": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetBulletin(newSha("73532d0280dc80bd7b8477522d17cd648eae067d5759cd758b0939159d57dfab"))
+		},
+		"block": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetBlock(tst_blk_a.Sha())
+		},
+		"tip": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetBlockTip()
+		},
+		"tag": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetTag(ombutil.Tag("#preflight"), nil, 0)
+		},
+		"board": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetBoard("lambs", nil, 0)
+		},
+		"boards": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetAllBoards()
+		},
+		"nearby": func(db pubrecdb.Store) (interface{}, error) {
+			return nextPage(func(c *pubrecdb.Cursor) (interface{}, string, error) {
+				page, err := db.GetNearbyBltns(0.0, 0.0, 10, c, 2)
+				if err != nil {
+					return nil, "", err
+				}
+				return page, page.Next, nil
+			})
+		},
+		"author": func(db pubrecdb.Store) (interface{}, error) {
+			return nextPage(func(c *pubrecdb.Cursor) (interface{}, string, error) {
+				page, err := db.GetAuthor(auth, c, 3)
+				if err != nil {
+					return nil, "", err
+				}
+				return page, page.Next, nil
+			})
+		},
+		"authors": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetAllAuthors(pubrecdb.SortEndorsed, pubrecdb.AuthorFilter{}, nil, 0)
+		},
+		"latest": func(db pubrecdb.Store) (interface{}, error) {
+			return nextPage(func(c *pubrecdb.Cursor) (interface{}, string, error) {
+				page, err := db.GetLatestPage(c, 3)
+				if err != nil {
+					return nil, "", err
+				}
+				return page, page.Next, nil
+			})
+		},
+		"range": func(db pubrecdb.Store) (interface{}, error) {
+			return db.QueryRange(tst_blk_a.Sha(), peg.GetStartBlock().Sha(), nil, 0)
+		},
+		"orphans": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetOrphanEndorsements(nil, 0)
+		},
+		"statistics": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetStatistics(time.Unix(0, 0), time.Date(2020, 12, 30, 0, 0, 0, 0, time.UTC))
+		},
+		"activity": func(db pubrecdb.Store) (interface{}, error) {
+			return db.GetActivitySeries(ts.Add(-2*time.Hour), ts.Add(2*time.Hour), pubrecdb.BucketHour)
+		},
+	}
+
+	for name, query := range queries {
+		want, err := query(sqldb)
+		if err != nil {
+			t.Fatalf("%s from sql: %v", name, err)
+		}
+		got, err := query(memdb)
+		if err != nil {
+			t.Fatalf("%s from memory: %v", name, err)
+		}
+
+		a, _ := json.Marshal(want)
+		b, _ := json.Marshal(got)
+		if string(a) != string(b) {
+			t.Fatalf("%s differs\nsql: %s\nmemory: %s", name, a, b)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package pubrecdb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+)
+
+var (
+	// createBlacklistSql is the part of the schema that holds the relay's
+	// moderation blacklist.
+	createBlacklistSql string = `
+-- The relay's moderation blacklist. Bulletins and endorsements that match an
+-- entry are withheld from every read query but stay in the record.
+CREATE TABLE IF NOT EXISTS blacklist (
+    kind        TEXT NOT NULL, -- One of txid, author or tag
+    value       TEXT NOT NULL,
+    reason      TEXT NOT NULL,
+    timestamp   INT NOT NULL,  -- When the entry was added as an epoch time
+
+    PRIMARY KEY(kind, value)
+);
+`
+
+	insertBlacklistSql string = `
+		INSERT OR REPLACE INTO blacklist (kind, value, reason, timestamp)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	deleteBlacklistSql string = `
+		DELETE FROM blacklist WHERE kind = $1 AND value = $2
+	`
+
+	selectBlacklistSql string = `
+		SELECT kind, value, reason, timestamp FROM blacklist
+		ORDER BY timestamp DESC
+	`
+
+	isBlacklistedSql string = `
+		SELECT EXISTS(SELECT * FROM blacklist WHERE kind = $1 AND value = $2)
+	`
+)
+
+// withheldBltnSql is true for the bulletin aliased as t when its txid, its
+// author or any of its tags are blacklisted.
+func withheldBltnSql(t string) string {
+	return fmt.Sprintf(`(
+		%s.txid IN (SELECT value FROM blacklist WHERE kind = 'txid') OR
+		%s.author IN (SELECT value FROM blacklist WHERE kind = 'author') OR
+		EXISTS(SELECT * FROM tags AS wt JOIN blacklist AS wb
+			ON wb.kind = 'tag' AND wt.value = wb.value COLLATE NOCASE
+			WHERE wt.txid = %s.txid)
+	)`, t, t, t)
+}
+
+// withheldEndoSql is true for the endorsement aliased as t when its txid or
+// its author are blacklisted.
+func withheldEndoSql(t string) string {
+	return fmt.Sprintf(`(
+		%s.txid IN (SELECT value FROM blacklist WHERE kind = 'txid') OR
+		%s.author IN (SELECT value FROM blacklist WHERE kind = 'author')
+	)`, t, t)
+}
+
+// createBlacklist adds the blacklist to records that do not have it yet.
+func createBlacklist(db *PublicRecord) error {
+	_, err := db.conn.Exec(createBlacklistSql)
+	return err
+}
+
+func prepareModeration(db *PublicRecord) (err error) {
+	db.insertBlacklistStmt, err = db.prepareWrite(insertBlacklistSql)
+	if err != nil {
+		return err
+	}
+
+	db.deleteBlacklistStmt, err = db.prepareWrite(deleteBlacklistSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectBlacklist, err = db.prepare(selectBlacklistSql)
+	if err != nil {
+		return err
+	}
+
+	db.isBlacklistedStmt, err = db.prepare(isBlacklistedSql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertBlacklistEntry withholds every item that matches the entry from the
+// read queries. The entry's timestamp is set to now and an existing entry for
+// the same item is replaced. ErrBadBlacklistEntry is returned if the entry's
+// kind or value cannot be used.
+func (db *PublicRecord) InsertBlacklistEntry(entry *ombjson.BlacklistEntry) (error, bool) {
+	value, err := ombstore.NormBlacklistValue(entry.Kind, entry.Value)
+	if err != nil {
+		return err, false
+	}
+
+	entry.Value = value
+	entry.Timestamp = time.Now().Unix()
+
+	_, err = db.insertBlacklistStmt.ExecContext(db.baseCtx(), entry.Kind, entry.Value, entry.Reason, entry.Timestamp)
+	if err != nil {
+		return err, false
+	}
+	return nil, true
+}
+
+// DeleteBlacklistEntry lifts the entry for an item. If the item was not
+// blacklisted sql.ErrNoRows is returned.
+func (db *PublicRecord) DeleteBlacklistEntry(kind, value string) (error, bool) {
+	value, err := ombstore.NormBlacklistValue(kind, value)
+	if err != nil {
+		return err, false
+	}
+
+	res, err := db.deleteBlacklistStmt.ExecContext(db.baseCtx(), kind, value)
+	if err != nil {
+		return err, false
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return sql.ErrNoRows, false
+	}
+	return nil, true
+}
+
+// GetBlacklist returns every entry in the blacklist with the newest first.
+func (db *PublicRecord) GetBlacklist() ([]*ombjson.BlacklistEntry, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	rows, err := db.selectBlacklist.QueryContext(ctx)
+	if err != nil {
+		return []*ombjson.BlacklistEntry{}, err
+	}
+	defer rows.Close()
+
+	entries := []*ombjson.BlacklistEntry{}
+	for rows.Next() {
+		entry := &ombjson.BlacklistEntry{}
+		err := rows.Scan(&entry.Kind, &entry.Value, &entry.Reason, &entry.Timestamp)
+		if err != nil {
+			return []*ombjson.BlacklistEntry{}, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// isBlacklisted reports if the item has an entry of its own in the
+// blacklist.
+func (db *PublicRecord) isBlacklisted(kind, value string) (bool, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	value, err := ombstore.NormBlacklistValue(kind, value)
+	if err != nil {
+		return false, nil
+	}
+
+	var listed bool
+	err = db.isBlacklistedStmt.QueryRowContext(ctx, kind, value).Scan(&listed)
+	return listed, err
+}
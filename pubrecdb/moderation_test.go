@@ -0,0 +1,163 @@
+package pubrecdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+func TestBlacklistEntries(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	bad := []*ombjson.BlacklistEntry{
+		{Kind: "bltn", Value: "73532d0280dc80bd7b8477522d17cd648eae067d5759cd758b0939159d57dfab"},
+		{Kind: pubrecdb.BlacklistTxid, Value: "73532d"},
+		{Kind: pubrecdb.BlacklistTag, Value: "#two words"},
+	}
+	for _, entry := range bad {
+		if err, ok := db.InsertBlacklistEntry(entry); ok || err != pubrecdb.ErrBadBlacklistEntry {
+			t.Fatalf("Entry should be malformed: %s", spw(entry))
+		}
+	}
+
+	entry := &ombjson.BlacklistEntry{Kind: pubrecdb.BlacklistTag, Value: "#Lambs", Reason: "spam"}
+	if err, ok := db.InsertBlacklistEntry(entry); err != nil || !ok {
+		t.Fatal(err)
+	}
+
+	entries, err := db.GetBlacklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Value != "#lambs" || entries[0].Timestamp == 0 {
+		t.Fatal(spw(entries))
+	}
+
+	if err, ok := db.DeleteBlacklistEntry(pubrecdb.BlacklistTag, "lambs"); err != nil || !ok {
+		t.Fatal(err)
+	}
+	if err, ok := db.DeleteBlacklistEntry(pubrecdb.BlacklistTag, "lambs"); ok || err == nil {
+		t.Fatal("Deleting a missing entry should fail")
+	}
+}
+
+func TestBlacklistWithholds(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	// bltn(7) is one of the two bulletins tagged #preflight.
+	txid := "196d5c0848253dd156740f5db875a78c4f1fcb384104f395c3ebcc241250f8df"
+	auth := "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+	entries := []*ombjson.BlacklistEntry{
+		{Kind: pubrecdb.BlacklistTxid, Value: txid, Reason: "court order"},
+		{Kind: pubrecdb.BlacklistTag, Value: "lambs", Reason: "spam"},
+	}
+	for _, entry := range entries {
+		if err, ok := db.InsertBlacklistEntry(entry); err != nil || !ok {
+			t.Fatal(err)
+		}
+		defer db.DeleteBlacklistEntry(entry.Kind, entry.Value)
+	}
+
+	if _, err := db.GetBulletin(newSha(txid)); err != pubrecdb.ErrWithheld {
+		t.Fatalf("Blacklisted bulletin should be withheld not: %v", err)
+	}
+
+	page, err := db.GetTag(ombutil.Tag("#preflight"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Bulletins) != 1 || !page.Withheld {
+		t.Fatal(spw(page))
+	}
+
+	// The withheld bulletin is left out before the page is cut so a page of
+	// one is never empty.
+	page, err = db.GetTag(ombutil.Tag("#preflight"), nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Bulletins) != 1 || page.Bulletins[0].Txid == txid || page.Next != "" {
+		t.Fatal(spw(page))
+	}
+
+	board, err := db.GetBoardSummary("preflight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if board.NumBltns != 1 {
+		t.Fatal(spw(board))
+	}
+
+	if _, err := db.GetBoard("lambs", nil, 0); err != pubrecdb.ErrWithheld {
+		t.Fatalf("Blacklisted board should be withheld not: %v", err)
+	}
+	boards, err := db.GetAllBoards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(boards) != 1 {
+		t.Fatal(spw(boards))
+	}
+
+	// The bare lists report what they left out in place of a page.
+	tags, withheld, err := db.GetTrendingTags(7*24*time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Count != 1 || !withheld {
+		t.Fatal(spw(tags))
+	}
+	trending, withheld, err := db.GetTrendingBltns(7*24*time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trending) != 3 || !withheld {
+		t.Fatal(spw(trending))
+	}
+	if _, withheld, err := db.GetTopAuthors(10); err != nil || withheld {
+		t.Fatalf("No author is withheld yet: %v", err)
+	}
+
+	// Blacklisting the author withholds everything they sent.
+	entry := &ombjson.BlacklistEntry{Kind: pubrecdb.BlacklistAuthor, Value: auth}
+	if err, ok := db.InsertBlacklistEntry(entry); err != nil || !ok {
+		t.Fatal(err)
+	}
+	defer db.DeleteBlacklistEntry(entry.Kind, entry.Value)
+
+	addr, _ := btcutil.DecodeAddress(auth, &chaincfg.MainNetParams)
+	if _, err := db.GetAuthor(addr, nil, 0); err != pubrecdb.ErrWithheld {
+		t.Fatalf("Blacklisted author should be withheld not: %v", err)
+	}
+
+	latest, err := db.GetLatestPage(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest.Bulletins) != 0 || !latest.Withheld {
+		t.Fatal(spw(latest))
+	}
+
+	nearby, withheld, err := db.GetNearbyBltnsByDist(0.0, 0.0, 200, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nearby) != 0 || !withheld {
+		t.Fatal(spw(nearby))
+	}
+	endorsed, withheld, err := db.GetMostEndorsedBltns(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endorsed) != 0 || !withheld {
+		t.Fatal(spw(endorsed))
+	}
+	if _, withheld, err := db.GetTopAuthors(10); err != nil || !withheld {
+		t.Fatalf("The author should be reported as withheld: %v", err)
+	}
+}
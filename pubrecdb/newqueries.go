@@ -24,9 +24,12 @@ func (db *PublicRecord) EndoCount() (int, error) {
 }
 
 func (db *PublicRecord) countRows(table string) (int, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
 	var count int
 	query := fmt.Sprintf(`SELECT count(*) FROM %s;`, table)
-	err := db.conn.QueryRow(query).Scan(&count)
+	err := db.rconn.QueryRowContext(ctx, query).Scan(&count)
 	if err != nil {
 		return -1, err
 	}
@@ -58,50 +61,53 @@ func scanBlockHead(cursor scannable) (*ombjson.Block, error) {
 	return blk, nil
 }
 
-func (db *PublicRecord) getBltnsByHeight(startH, stopH int32) ([]*ombjson.Bulletin, error) {
+func (db *PublicRecord) getBltnsByHeight(startH, stopH int32) ([]*ombjson.Bulletin, bool, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
 	// Query for bltns between heights
-	rows, err := db.selectBltnsHeight.Query(startH, stopH)
-	defer rows.Close()
+	rows, err := db.selectBltnsHeight.QueryContext(ctx, startH, stopH)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
+	defer rows.Close()
 
-	bltns, err := scanBltns(rows)
-	if err != nil {
-		return nil, err
-	}
-	return bltns, nil
+	return db.scanBltns(rows)
 }
 
-func (db *PublicRecord) getBlockBltns(height int32) ([]*ombjson.Bulletin, error) {
+func (db *PublicRecord) getBlockBltns(height int32) ([]*ombjson.Bulletin, bool, error) {
 	return db.getBltnsByHeight(height, height-1)
 }
 
-func (db *PublicRecord) getBlockEndos(height int32) ([]*ombjson.Endorsement, error) {
-	return db.GetEndosByHeight(height, height-1)
+func (db *PublicRecord) getBlockEndos(height int32) ([]*ombjson.Endorsement, bool, error) {
+	return db.getEndosByHeight(height, height-1)
 }
 
 // GetBlock returns the block in the record specified by 'hash'. If it is not
 // present then sql.ErrNoRows is returned.
 func (db *PublicRecord) GetBlock(hash *wire.ShaHash) (*ombjson.Block, error) {
-	row := db.selectBlock.QueryRow(hash.String())
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	row := db.selectBlock.QueryRowContext(ctx, hash.String())
 	block, err := scanBlockHead(row)
 	if err != nil {
 		return &ombjson.Block{}, err
 	}
 
-	bltns, err := db.getBlockBltns(block.Head.Height)
+	bltns, bltnsWithheld, err := db.getBlockBltns(block.Head.Height)
 	if err != nil {
 		return &ombjson.Block{}, err
 	}
 
-	endos, err := db.getBlockEndos(block.Head.Height)
+	endos, endosWithheld, err := db.getBlockEndos(block.Head.Height)
 	if err != nil {
 		return &ombjson.Block{}, err
 	}
 
 	block.Bulletins = bltns
 	block.Endorsements = endos
+	block.Withheld = bltnsWithheld || endosWithheld
 	return block, nil
 }
 
@@ -109,7 +115,10 @@ func (db *PublicRecord) GetBlock(hash *wire.ShaHash) (*ombjson.Block, error) {
 // returns the block at the tip of the chain. This is the block that has the
 // greatest height in the record.
 func (db *PublicRecord) GetBlockTip() (*ombjson.Block, error) {
-	row := db.selectBlockTip.QueryRow()
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	row := db.selectBlockTip.QueryRowContext(ctx)
 	return scanBlockHead(row)
 }
 
@@ -118,12 +127,15 @@ func (db *PublicRecord) GetBlockTip() (*ombjson.Block, error) {
 // peg block, FindHeight returns the height from memory, it does not make a
 // round trip to the db.
 func (db *PublicRecord) FindHeight(hash *wire.ShaHash) (int32, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
 	firstHash := peg.GetStartBlock().MsgBlock().Header.PrevBlock.Bytes()
 	if bytes.Equal(hash.Bytes(), firstHash) {
 		return int32(peg.StartHeight - 1), nil
 	}
 
-	row := db.findHeight.QueryRow(hash.String())
+	row := db.findHeight.QueryRowContext(ctx, hash.String())
 
 	var height int32
 	err := row.Scan(&height)
@@ -154,9 +166,11 @@ SELECT
 // produces counts, but one day it will produce interesting facts for the
 // scientists to measure.
 func (db *PublicRecord) GetStatistics(start, fin time.Time) (*ombjson.Statistics, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
 
 	empt := &ombjson.Statistics{}
-	row := db.computeStatistics.QueryRow(start.Unix(), fin.Unix())
+	row := db.computeStatistics.QueryRowContext(ctx, start.Unix(), fin.Unix())
 
 	var nBltns, nEndos, nBlks int64
 	err := row.Scan(&nBltns, &nEndos, &nBlks)
@@ -0,0 +1,233 @@
+package pubrecdb
+
+import (
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+var (
+	// createOrphansSql is the part of the schema that tracks endorsements of
+	// bids that are not stored as bulletins.
+	createOrphansSql string = `
+-- Endorsements whose bid is not a stored bulletin. The triggers below link an
+-- endorsement to its bulletin by removing it from here once the bulletin is
+-- stored and put it back if the bulletin is dropped.
+CREATE TABLE IF NOT EXISTS orphan_endos (
+    txid        TEXT NOT NULL, -- the endorsement's txid
+    bid         TEXT NOT NULL,
+    non_record  INT NOT NULL DEFAULT 0, -- Set once the bid is known not to be a bulletin
+
+    PRIMARY KEY(txid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_orphan_bid ON orphan_endos (bid);
+
+CREATE TRIGGER IF NOT EXISTS orphan_endos_insert AFTER INSERT ON endorsements
+WHEN NOT EXISTS(SELECT * FROM bulletins WHERE txid = new.bid)
+BEGIN
+    INSERT OR REPLACE INTO orphan_endos (txid, bid, non_record)
+    VALUES (new.txid, new.bid,
+        EXISTS(SELECT * FROM endorsements WHERE txid = new.bid) OR
+        EXISTS(SELECT * FROM raw_txs WHERE txid = new.bid));
+END;
+
+CREATE TRIGGER IF NOT EXISTS orphan_endos_delete AFTER DELETE ON endorsements
+BEGIN
+    DELETE FROM orphan_endos WHERE txid = old.txid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS orphan_endos_link AFTER INSERT ON bulletins
+BEGIN
+    DELETE FROM orphan_endos WHERE bid = new.txid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS orphan_endos_unlink AFTER DELETE ON bulletins
+BEGIN
+    INSERT OR REPLACE INTO orphan_endos (txid, bid)
+    SELECT txid, bid FROM endorsements WHERE bid = old.txid;
+END;
+`
+
+	// backfillOrphansSql adds the orphans that were stored before the table
+	// existed.
+	backfillOrphansSql string = `
+		INSERT OR IGNORE INTO orphan_endos (txid, bid, non_record)
+		SELECT e.txid, e.bid, EXISTS(SELECT * FROM endorsements WHERE txid = e.bid)
+		FROM endorsements AS e
+		WHERE NOT EXISTS(SELECT * FROM bulletins WHERE txid = e.bid)
+	`
+
+	selectOpenBidsSql string = `
+		SELECT DISTINCT bid FROM orphan_endos WHERE non_record = 0
+	`
+
+	flagNonRecordSql string = `
+		UPDATE orphan_endos SET non_record = 1 WHERE bid = $1
+	`
+
+	orphanCond string = `e.txid IN (SELECT txid FROM orphan_endos)`
+)
+
+// buildOrphans creates the orphan table if it is missing and fills it with
+// any orphans that are not in it yet.
+func buildOrphans(db *PublicRecord) error {
+	if _, err := db.conn.Exec(createOrphansSql); err != nil {
+		return err
+	}
+	if _, err := db.conn.Exec(backfillOrphansSql); err != nil {
+		return err
+	}
+	return nil
+}
+
+func prepareOrphans(db *PublicRecord) (err error) {
+	db.selectOpenBids, err = db.prepareWrite(selectOpenBidsSql)
+	if err != nil {
+		return err
+	}
+
+	db.flagNonRecordStmt, err = db.prepareWrite(flagNonRecordSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectOrphanEndos, err = prepareWithheld(db, endoSql, orphanCond,
+		withheldEndoSql("e"), "", "blocks.height", "e.txid", 0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetTxIndex lets the record look up the bids of new orphans in idx. A bid
+// that was mined before the endorsement and is not a stored bulletin never
+// will be one. Without an index only the bids mined after the endorsement
+// are known not to be bulletins.
+func (db *PublicRecord) SetTxIndex(idx TxIndex) {
+	db.txIndex = idx
+}
+
+// flagNonRecordBids marks the orphans whose bid is a transaction in the block
+// that is not a bulletin. Once it is mined that way it can never become one.
+// The bids of the orphans still waiting are looked up once instead of every
+// transaction in the block. The bids of the block's own endorsements are
+// also looked up in the tx index if the record has one.
+func (db *PublicRecord) flagNonRecordBids(tx *sql.Tx, oblk *ombutil.UBlock) error {
+	rows, err := tx.Stmt(db.selectOpenBids).Query()
+	if err != nil {
+		return err
+	}
+	open := make(map[string]struct{})
+	for rows.Next() {
+		var bid string
+		if err := rows.Scan(&bid); err != nil {
+			rows.Close()
+			return err
+		}
+		open[bid] = struct{}{}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(open) == 0 {
+		return nil
+	}
+
+	// The bulletins in the block were linked when they were stored so
+	// none of them are open
+	flag := make(map[string]struct{})
+	for _, t := range oblk.Block.Transactions() {
+		txid := t.Sha().String()
+		if _, ok := open[txid]; ok {
+			flag[txid] = struct{}{}
+		}
+	}
+	if db.txIndex != nil {
+		for _, endo := range oblk.Endorsements {
+			bid := hex.EncodeToString(endo.Wire.GetBid())
+			if _, ok := open[bid]; !ok {
+				continue
+			}
+			sha, err := wire.NewShaHashFromStr(bid)
+			if err != nil {
+				return err
+			}
+			mined, err := db.txIndex.ExistsTxSha(sha)
+			if err != nil {
+				return err
+			}
+			if mined {
+				flag[bid] = struct{}{}
+			}
+		}
+	}
+
+	stmt := tx.Stmt(db.flagNonRecordStmt)
+	for bid := range flag {
+		if _, err := stmt.Exec(bid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetOrphanEndorsements returns a page of the endorsements whose bid is not a
+// stored bulletin starting from the cursor. Endorsements of a bid that is
+// known not to be a bulletin have NonRecord set, the rest are still
+// waiting for their bulletin to be mined.
+func (db *PublicRecord) GetOrphanEndorsements(c *Cursor, limit int) (*ombjson.EndoPage, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	limit = db.pageLimit(limit)
+	rows, err := db.selectOrphanEndos.query(ctx, c, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []ombstore.PageKey{}
+	byTxid := make(map[string]*ombjson.Endorsement)
+	for rows.Next() {
+		endo, _, err := scanEndoRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, ombstore.PageKey{Height: endo.BlockRef.Height, Txid: endo.Txid, Block: endo.BlockRef.Hash})
+		byTxid[endo.Txid] = endo
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	keys, more := ombstore.CutPage(c, keys, limit)
+
+	page := &ombjson.EndoPage{
+		Endorsements: []*ombjson.Endorsement{},
+	}
+	for _, k := range keys {
+		page.Endorsements = append(page.Endorsements, byTxid[k.Txid])
+	}
+	page.Withheld, err = db.selectOrphanEndos.anyHeld(ctx, c, keys, more)
+	if err != nil {
+		return nil, err
+	}
+
+	var start, stop string = "", peg.GetStartBlock().Sha().String()
+	tip, err := db.GetBlockTip()
+	if err == nil {
+		start = tip.Head.Hash
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	page.Start, page.Stop, page.Cursors = ombstore.PageSpan(c, keys, more, start, stop)
+
+	return page, nil
+}
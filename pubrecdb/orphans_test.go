@@ -0,0 +1,142 @@
+package pubrecdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+func TestGetOrphanEndorsements(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	page, err := db.GetOrphanEndorsements(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Endorsements) != 0 {
+		t.Fatal(spw(page))
+	}
+
+	// endo(20) arrives before the bulletin it endorses.
+	bid := fakeMsgTx(21).TxSha()
+	if err, ok := db.InsertEndorsement(fakeUEndo(20, &bid)); err != nil || !ok {
+		t.Fatal(err)
+	}
+
+	// endo(22) endorses endo(5) which can never be a bulletin.
+	endoBid := newSha("4bf52e816c845b40f71209e611fc3a1d352526d57f722a4c5fad7d8558611be3")
+	if err, ok := db.InsertEndorsement(fakeUEndo(22, endoBid)); err != nil || !ok {
+		t.Fatal(err)
+	}
+
+	page, err = db.GetOrphanEndorsements(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Endorsements) != 2 {
+		t.Fatal(spw(page))
+	}
+	for _, endo := range page.Endorsements {
+		if endo.NonRecord != (endo.Bid == endoBid.String()) {
+			t.Fatal(spw(endo))
+		}
+	}
+
+	status, err := db.GetDBStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NumOrphanEndos != 2 || status.NumPendingEndos != 1 || status.NumNonRecordEndos != 1 {
+		t.Fatal(spw(status))
+	}
+
+	// Storing the bulletin links endo(20) to it.
+	if err, ok := db.InsertBulletin(fakeUBltn(21)); err != nil || !ok {
+		t.Fatal(err)
+	}
+	page, err = db.GetOrphanEndorsements(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Endorsements) != 1 || page.Endorsements[0].Bid != endoBid.String() {
+		t.Fatal(spw(page))
+	}
+
+	bltn, err := db.GetBulletin(&bid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bltn.NumEndos != 1 {
+		t.Fatal(spw(bltn))
+	}
+}
+
+// minedIndex reports every transaction as mined.
+type minedIndex struct{}
+
+func (minedIndex) ExistsTxSha(sha *wire.ShaHash) (bool, error) {
+	return true, nil
+}
+
+func TestFlagNonRecordBids(t *testing.T) {
+	db, _ := SetupTestDB(false)
+
+	// endo(30) waits on the coinbase of the next block.
+	coinbase := fakeMsgTx(100)
+	cbSha := coinbase.TxSha()
+	if err, ok := db.InsertEndorsement(fakeUEndo(30, &cbSha)); err != nil || !ok {
+		t.Fatal(err)
+	}
+
+	page, err := db.GetOrphanEndorsements(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Endorsements) != 1 || page.Endorsements[0].NonRecord {
+		t.Fatal(spw(page))
+	}
+
+	// endo(31) is mined with the coinbase and endorses a tx the index has
+	// seen mined before it.
+	db.SetTxIndex(minedIndex{})
+	defer db.SetTxIndex(nil)
+
+	msgBlk := &wire.MsgBlock{}
+	msgBlk.AddTransaction(coinbase)
+	msgBlk.AddTransaction(fakeMsgTx(31))
+	msgBlk.Header = wire.BlockHeader{
+		PrevBlock: *peg.GetStartBlock().Sha(),
+		Timestamp: time.Unix(123456789, 0),
+	}
+	blk := btcutil.NewBlock(msgBlk)
+	blk.SetHeight(peg.StartHeight + 1)
+
+	mined := fakeMsgTx(32).TxSha()
+	endo := fakeUEndo(31, &mined)
+	endo.Block = blk
+	ublk := &ombutil.UBlock{
+		Block:        blk,
+		Bulletins:    []*ombutil.Bulletin{},
+		Endorsements: []*ombutil.Endorsement{endo},
+	}
+	if err, ok := db.InsertUBlock(ublk); err != nil || !ok {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	page, err = db.GetOrphanEndorsements(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Endorsements) != 2 {
+		t.Fatal(spw(page))
+	}
+	for _, endo := range page.Endorsements {
+		if !endo.NonRecord {
+			t.Fatal(spw(endo))
+		}
+	}
+}
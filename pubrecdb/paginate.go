@@ -0,0 +1,279 @@
+package pubrecdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+// afterCond and beforeCond select the records that come after or before the
+// key passed as params $n and $n+1 in the order lists are returned in.
+func afterCond(h, t string, n int) string {
+	return fmt.Sprintf("(%s < $%d OR (%s = $%d AND %s < $%d))", h, n, h, n, t, n+1)
+}
+
+func beforeCond(h, t string, n int) string {
+	return fmt.Sprintf("(%s > $%d OR (%s = $%d AND %s > $%d))", h, n, h, n, t, n+1)
+}
+
+// betweenCond selects the records from the key in $n and $n+1 down to the key
+// in $n+2 and $n+3 inclusive.
+func betweenCond(h, t string, n int) string {
+	return fmt.Sprintf(`(%s < $%d OR (%s = $%d AND %s <= $%d)) AND
+		(%s > $%d OR (%s = $%d AND %s >= $%d))`,
+		h, n, h, n, t, n+1, h, n+2, h, n+2, t, n+3)
+}
+
+// and joins the filters that are not empty into one.
+func and(conds ...string) string {
+	s := []string{}
+	for _, cond := range conds {
+		if cond != "" {
+			s = append(s, cond)
+		}
+	}
+	return strings.Join(s, " AND ")
+}
+
+// where joins the filters of a query into its WHERE clause.
+func where(conds ...string) string {
+	return "WHERE " + and(conds...)
+}
+
+// pagedSql builds one direction of a paged query. The records selected by
+// sel are keyed by the columns h and t and filtered by cond which uses n
+// params. The key of the cursor and the limit are the last three params.
+func pagedSql(sel, cond, group, h, t string, n int, before bool) string {
+	order := "DESC"
+	pos := afterCond(h, t, n+1)
+	if before {
+		order = "ASC"
+		pos = beforeCond(h, t, n+1)
+	}
+	return fmt.Sprintf("%s\n%s\n%s\nORDER BY %s %s, %s %s\nLIMIT $%d",
+		sel, where(cond, pos), group, h, order, t, order, n+3)
+}
+
+// betweenSql builds a query for the records that fall between the first and
+// the last keys of a page. The keys follow the n params that cond uses.
+func betweenSql(sel, cond, group, h, t string, n int) string {
+	return fmt.Sprintf("%s\n%s\n%s\nORDER BY %s DESC, %s DESC",
+		sel, where(cond, betweenCond(h, t, n+1)), group, h, t)
+}
+
+// pagedStmt holds the statements that walk a list in both directions. Lists
+// that leave out withheld records also hold a statement that selects the
+// withheld records between two keys.
+type pagedStmt struct {
+	after  *sql.Stmt
+	before *sql.Stmt
+	held   *sql.Stmt
+}
+
+func preparePaged(db *PublicRecord, sel, cond, group, h, t string, n int) (*pagedStmt, error) {
+	after, err := db.prepare(pagedSql(sel, cond, group, h, t, n, false))
+	if err != nil {
+		return nil, err
+	}
+	before, err := db.prepare(pagedSql(sel, cond, group, h, t, n, true))
+	if err != nil {
+		return nil, err
+	}
+	return &pagedStmt{after: after, before: before}, nil
+}
+
+// prepareWithheld works like preparePaged for a list whose records are left
+// out when withheld is true for them. They are filtered out before the limit
+// so that every page is full.
+func prepareWithheld(db *PublicRecord, sel, cond, withheld, group, h, t string, n int) (*pagedStmt, error) {
+	q, err := preparePaged(db, sel, and(cond, "NOT "+withheld), group, h, t, n)
+	if err != nil {
+		return nil, err
+	}
+	q.held, err = db.prepare(betweenSql(sel, and(cond, withheld), group, h, t, n))
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// query runs the statement that walks away from the cursor. One more record
+// than the limit is asked for so that the caller can tell if there is a page
+// past this one. A nil cursor starts at the front of the list.
+func (q *pagedStmt) query(ctx context.Context, c *Cursor, limit int, args ...interface{}) (*sql.Rows, error) {
+	if c == nil {
+		c = ombstore.FirstPage
+	}
+	stmt := q.after
+	if c.Before {
+		stmt = q.before
+	}
+	args = append(args, c.Height, c.Txid, limit+1)
+	return stmt.QueryContext(ctx, args...)
+}
+
+// queryHeld runs the held statement over the span of a page made of keys.
+func (q *pagedStmt) queryHeld(ctx context.Context, c *Cursor, keys []ombstore.PageKey, more bool, args ...interface{}) (*sql.Rows, error) {
+	upper, lower := ombstore.HeldSpan(c, keys, more)
+	args = append(args, upper.Height, upper.Txid, lower.Height, lower.Txid)
+	return q.held.QueryContext(ctx, args...)
+}
+
+// anyHeld reports if any records were withheld from the span of a page.
+func (q *pagedStmt) anyHeld(ctx context.Context, c *Cursor, keys []ombstore.PageKey, more bool, args ...interface{}) (bool, error) {
+	rows, err := q.queryHeld(ctx, c, keys, more, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	found := rows.Next()
+	return found, rows.Err()
+}
+
+// pageLimit returns the number of records to put in a page. It falls back to
+// ombstore.DefaultPageLimit and is capped at the max query limit.
+func (db *PublicRecord) pageLimit(limit int) int {
+	return ombstore.CapLimit(limit, db.maxQueryLimit)
+}
+
+// newBltnPage builds a page out of the bulletins returned by a paged query.
+// withheld reports if any bulletins were left out of the part of the list
+// the page covers. The page spans the whole record when it is not cut short.
+func (db *PublicRecord) newBltnPage(c *Cursor, bltns []*ombjson.Bulletin, limit int,
+	withheld func([]ombstore.PageKey, bool) (bool, error)) (*ombjson.BltnPage, error) {
+
+	keys := make([]ombstore.PageKey, len(bltns))
+	byTxid := make(map[string]*ombjson.Bulletin)
+	for i, bltn := range bltns {
+		keys[i] = ombstore.PageKey{Height: bltn.BlockRef.Height, Txid: bltn.Txid, Block: bltn.BlockRef.Hash}
+		byTxid[bltn.Txid] = bltn
+	}
+	keys, more := ombstore.CutPage(c, keys, limit)
+
+	page := &ombjson.BltnPage{
+		Bulletins: []*ombjson.Bulletin{},
+	}
+	for _, k := range keys {
+		page.Bulletins = append(page.Bulletins, byTxid[k.Txid])
+	}
+
+	var err error
+	page.Withheld, err = withheld(keys, more)
+	if err != nil {
+		return nil, err
+	}
+
+	// This is ugly
+	var start, stop string = "", peg.GetStartBlock().Sha().String()
+	tip, err := db.GetBlockTip()
+	if err == nil {
+		start = tip.Head.Hash
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	page.Start, page.Stop, page.Cursors = ombstore.PageSpan(c, keys, more, start, stop)
+
+	return page, nil
+}
+
+// queryBltnPage runs a paged query for bulletins and builds a page out of the
+// results. The query must have been prepared with prepareWithheld.
+func (db *PublicRecord) queryBltnPage(q *pagedStmt, c *Cursor, limit int, args ...interface{}) (*ombjson.BltnPage, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	limit = db.pageLimit(limit)
+	rows, err := q.query(ctx, c, limit, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bltns, _, err := db.scanBltns(rows)
+	if err != nil {
+		return nil, err
+	}
+	return db.newBltnPage(c, bltns, limit, func(keys []ombstore.PageKey, more bool) (bool, error) {
+		return q.anyHeld(ctx, c, keys, more, args...)
+	})
+}
+
+// recordPage is a page of bulletins and endorsements along with the keys
+// that the cursors around it are made from.
+type recordPage struct {
+	bltns    []*ombjson.Bulletin
+	endos    []*ombjson.Endorsement
+	keys     []ombstore.PageKey
+	more     bool
+	withheld bool
+}
+
+// queryRecords pages through a list of both bulletins and endorsements. The
+// keys statement picks out the records in the page, leaving out the withheld
+// ones, and the bltns and endos statements then pull everything between its
+// first and last key. Any withheld records among those mark the page as
+// withheld. args are passed to all three.
+func (db *PublicRecord) queryRecords(keysStmt *pagedStmt, bltnsStmt, endosStmt *sql.Stmt,
+	c *Cursor, limit int, args ...interface{}) (*recordPage, error) {
+
+	page := &recordPage{
+		bltns: []*ombjson.Bulletin{},
+		endos: []*ombjson.Endorsement{},
+	}
+
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	limit = db.pageLimit(limit)
+	rows, err := keysStmt.query(ctx, c, limit, args...)
+	if err != nil {
+		return nil, err
+	}
+	keys := []ombstore.PageKey{}
+	for rows.Next() {
+		var k ombstore.PageKey
+		if err := rows.Scan(&k.Height, &k.Txid, &k.Block); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+
+	page.keys, page.more = ombstore.CutPage(c, keys, limit)
+	if len(page.keys) == 0 {
+		return page, nil
+	}
+
+	first, last := page.keys[0], page.keys[len(page.keys)-1]
+	args = append(args, first.Height, first.Txid, last.Height, last.Txid)
+
+	rows, err = bltnsStmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	bltns, bltnsWithheld, err := db.scanBltns(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = endosStmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	endos, endosWithheld, err := scanEndos(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	page.bltns, page.endos = bltns, endos
+	page.withheld = bltnsWithheld || endosWithheld
+	return page, nil
+}
@@ -0,0 +1,119 @@
+package pubrecdb_test
+
+import (
+	"testing"
+
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+func TestParseCursor(t *testing.T) {
+	c := &pubrecdb.Cursor{Height: 390000, Txid: "ab12", Before: true}
+
+	parsed, err := pubrecdb.ParseCursor(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != *c {
+		t.Fatalf("Cursor did not survive a round trip: %s", spw(parsed))
+	}
+
+	for _, s := range []string{"", "!!", "eDoxOmFi", "YTp4OmFi"} {
+		if _, err := pubrecdb.ParseCursor(s); err != pubrecdb.ErrBadCursor {
+			t.Fatalf("Cursor %q should be malformed not: %v", s, err)
+		}
+	}
+}
+
+// TestGetLatestPageCursors walks the whole record forwards and then backwards
+// two records at a time.
+func TestGetLatestPageCursors(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	bltnCnt, _ := db.BulletinCount()
+	endoCnt, _ := db.EndoCount()
+
+	var c *pubrecdb.Cursor
+	var pages [][]string
+	seen := make(map[string]struct{})
+	for {
+		page, err := db.GetLatestPage(c, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txids := []string{}
+		// The test record reuses txids across bulletins and endorsements.
+		for _, bltn := range page.Bulletins {
+			txids = append(txids, "bltn:"+bltn.Txid)
+		}
+		for _, endo := range page.Endorsements {
+			txids = append(txids, "endo:"+endo.Txid)
+		}
+		if len(txids) > 2 {
+			t.Fatalf("Page is past the limit: %s", spw(page))
+		}
+		for _, txid := range txids {
+			if _, ok := seen[txid]; ok {
+				t.Fatalf("%s was returned twice", txid)
+			}
+			seen[txid] = struct{}{}
+		}
+		pages = append(pages, txids)
+
+		if (c == nil) != (page.Prev == "") {
+			t.Fatalf("Only the first page has no prev: %s", spw(page))
+		}
+		if page.Next == "" {
+			break
+		}
+		if c, err = pubrecdb.ParseCursor(page.Next); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(seen) != bltnCnt+endoCnt {
+		t.Fatalf("Walked %d records instead of %d", len(seen), bltnCnt+endoCnt)
+	}
+
+	// Walk back from the last page.
+	page, _ := db.GetLatestPage(c, 2)
+	for i := len(pages) - 2; i >= 0; i-- {
+		prev, err := pubrecdb.ParseCursor(page.Prev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err = db.GetLatestPage(prev, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Bulletins)+len(page.Endorsements) != len(pages[i]) {
+			t.Fatalf("Page %d changed on the way back: %s", i, spw(page))
+		}
+	}
+	if page.Prev != "" {
+		t.Fatalf("Walking back should end at the first page: %s", spw(page))
+	}
+}
+
+func TestGetTagCursors(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	first, err := db.GetTag(ombutil.Tag("#preflight"), nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Bulletins) != 1 || first.Next == "" || first.Prev != "" {
+		t.Fatal(spw(first))
+	}
+
+	c, _ := pubrecdb.ParseCursor(first.Next)
+	second, err := db.GetTag(ombutil.Tag("#preflight"), c, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Bulletins) != 1 || second.Next != "" || second.Prev == "" ||
+		second.Bulletins[0].Txid == first.Bulletins[0].Txid {
+		t.Fatal(spw(second))
+	}
+}
@@ -0,0 +1,365 @@
+package pubrecdb
+
+import (
+	"database/sql"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	_ "github.com/lib/pq"
+
+	"github.com/soapboxsys/ombudslib/ombstore"
+)
+
+// pgDialect keeps the record in a PostgreSQL database. It needs PostgreSQL 12
+// or newer built with ICU for the case insensitive collation tags are
+// compared with. PostGIS is not needed.
+var pgDialect = &dialect{
+	create: createPg,
+	replace: map[string]string{
+		insertBlacklistSql: `
+			INSERT INTO blacklist (kind, value, reason, timestamp)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (kind, value) DO UPDATE
+			SET reason = excluded.reason, timestamp = excluded.timestamp
+		`,
+		insertRawTxSql: `
+			INSERT INTO raw_txs (txid, block, tx, outputs)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (txid) DO UPDATE
+			SET block = excluded.block, tx = excluded.tx, outputs = excluded.outputs
+		`,
+	},
+	foreignKeys:    pgForeignKeys,
+	fileSize:       pgFileSize,
+	integrityCheck: pgIntegrityCheck,
+}
+
+var (
+	// createPgSql is the schema of a record kept in PostgreSQL. It matches
+	// the sqlite schema written by createSql and is safe to run against a
+	// record that already has it. The functions, the aggregate and the
+	// collation at the top stand in for the ones the queries expect from
+	// sqlite. Text is compared byte by byte like sqlite does.
+	createPgSql string = `
+CREATE COLLATION IF NOT EXISTS nocase (
+    provider = icu, locale = 'und-u-ks-level2', deterministic = false
+);
+
+CREATE OR REPLACE FUNCTION sum_bool(bigint, boolean) RETURNS bigint AS $$
+    SELECT $1 + CASE WHEN $2 THEN 1 ELSE 0 END
+$$ LANGUAGE SQL IMMUTABLE;
+
+DO $$ BEGIN
+    CREATE AGGREGATE sum(boolean) (sfunc = sum_bool, stype = bigint, initcond = '0');
+EXCEPTION WHEN duplicate_function THEN NULL;
+END $$;
+
+CREATE OR REPLACE FUNCTION dist(a_lat float8, a_lon float8, b_lat float8, b_lon float8)
+RETURNS float8 AS $$
+    SELECT acos(greatest(-1, least(1,
+        sin(radians(a_lat)) * sin(radians(b_lat)) +
+        cos(radians(a_lat)) * cos(radians(b_lat)) * cos(radians(b_lon - a_lon))
+    ))) * 6371000.0
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Weights that are too small for a float8 are rounded down to 0 instead of
+-- raising an underflow.
+CREATE OR REPLACE FUNCTION decay(age float8, half_life float8) RETURNS float8 AS $$
+    SELECT CASE
+        WHEN half_life <= 0 THEN 0
+        WHEN age / half_life > 1000 THEN 0
+        ELSE power(0.5::float8, age / half_life)
+    END
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE TABLE IF NOT EXISTS blocks (
+    hash        TEXT COLLATE "C" NOT NULL,
+    prevhash    TEXT COLLATE "C" UNIQUE NOT NULL,
+    height      INT  UNIQUE NOT NULL,
+    timestamp   BIGINT,
+    version     INT,
+    merkleroot  TEXT COLLATE "C",
+    difficulty  BIGINT,
+    nonce       BIGINT,
+
+    PRIMARY KEY(hash)
+);
+
+-- Stands in for the foreign key from prevhash to hash. Like sqlite with the
+-- foreign keys off, the peg block is let in ahead of the block it follows.
+CREATE OR REPLACE FUNCTION blocks_link() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS(SELECT * FROM blocks) AND
+        NOT EXISTS(SELECT * FROM blocks WHERE hash = NEW.prevhash) THEN
+        RAISE foreign_key_violation USING MESSAGE = 'prevhash is not a stored block';
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS blocks_link ON blocks;
+CREATE TRIGGER blocks_link BEFORE INSERT ON blocks
+FOR EACH ROW EXECUTE PROCEDURE blocks_link();
+
+CREATE TABLE IF NOT EXISTS bulletins (
+    txid        TEXT COLLATE "C" NOT NULL,
+    block       TEXT COLLATE "C" NOT NULL,
+    author      TEXT COLLATE "C" NOT NULL,
+    message     TEXT COLLATE "C" NOT NULL,
+    timestamp   BIGINT,
+    latitude    DOUBLE PRECISION,
+    longitude   DOUBLE PRECISION,
+    height      DOUBLE PRECISION,
+
+    PRIMARY KEY(txid),
+    FOREIGN KEY(block) REFERENCES blocks(hash) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS endorsements (
+    txid        TEXT COLLATE "C" NOT NULL,
+    block       TEXT COLLATE "C" NOT NULL,
+    bid         TEXT COLLATE "C" NOT NULL,
+    timestamp   BIGINT NOT NULL,
+    author      TEXT COLLATE "C" NOT NULL,
+
+    PRIMARY KEY(txid),
+    FOREIGN KEY(block) REFERENCES blocks(hash) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+    txid   TEXT COLLATE "C" NOT NULL,
+    value  TEXT COLLATE "C" NOT NULL,
+
+    PRIMARY KEY(txid, value),
+    FOREIGN KEY(txid) REFERENCES bulletins(txid) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_tags ON tags (value COLLATE nocase);
+CREATE INDEX IF NOT EXISTS idx_height ON blocks (height);
+CREATE INDEX IF NOT EXISTS idx_timestamp ON blocks (timestamp);
+CREATE INDEX IF NOT EXISTS idx_bltn_block ON bulletins (block);
+CREATE INDEX IF NOT EXISTS idx_endo_block ON endorsements (block);
+CREATE INDEX IF NOT EXISTS idx_endo_bid ON endorsements (bid);
+
+-- Located bulletins. The view stands in for sqlite's R*Tree and is backed by
+-- an index over the coordinates of the bulletins.
+CREATE TABLE IF NOT EXISTS bltn_locs (
+    id          SERIAL PRIMARY KEY,
+    txid        TEXT COLLATE "C" UNIQUE NOT NULL,
+
+    FOREIGN KEY(txid) REFERENCES bulletins(txid) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_bltn_loc ON bulletins (latitude, longitude);
+
+CREATE OR REPLACE VIEW bltn_rtree AS
+    SELECT bltn_locs.id, latitude AS minLat, latitude AS maxLat,
+        longitude AS minLon, longitude AS maxLon
+    FROM bltn_locs JOIN bulletins ON bltn_locs.txid = bulletins.txid;
+
+CREATE OR REPLACE FUNCTION bltn_locs_insert() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO bltn_locs (txid) VALUES (NEW.txid);
+    RETURN NULL;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS bltn_locs_insert ON bulletins;
+CREATE TRIGGER bltn_locs_insert AFTER INSERT ON bulletins
+FOR EACH ROW WHEN (NEW.latitude IS NOT NULL AND NEW.longitude IS NOT NULL)
+EXECUTE PROCEDURE bltn_locs_insert();
+
+CREATE TABLE IF NOT EXISTS blacklist (
+    kind        TEXT COLLATE "C" NOT NULL,
+    value       TEXT COLLATE "C" NOT NULL,
+    reason      TEXT COLLATE "C" NOT NULL,
+    timestamp   BIGINT NOT NULL,
+
+    PRIMARY KEY(kind, value)
+);
+
+CREATE TABLE IF NOT EXISTS merkle_proofs (
+    txid        TEXT COLLATE "C" NOT NULL,
+    block       TEXT COLLATE "C" NOT NULL,
+    idx         INT NOT NULL,
+    branch      BYTEA NOT NULL,
+
+    PRIMARY KEY(txid),
+    FOREIGN KEY(block) REFERENCES blocks(hash) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS raw_txs (
+    txid        TEXT COLLATE "C" NOT NULL,
+    block       TEXT COLLATE "C" NOT NULL,
+    tx          BYTEA NOT NULL,
+    outputs     TEXT COLLATE "C" NOT NULL,
+
+    PRIMARY KEY(txid),
+    FOREIGN KEY(block) REFERENCES blocks(hash) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS orphan_endos (
+    txid        TEXT COLLATE "C" NOT NULL,
+    bid         TEXT COLLATE "C" NOT NULL,
+    non_record  INT NOT NULL DEFAULT 0,
+
+    PRIMARY KEY(txid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_orphan_bid ON orphan_endos (bid);
+
+CREATE OR REPLACE FUNCTION orphan_endos_insert() RETURNS trigger AS $$
+BEGIN
+    IF NOT EXISTS(SELECT * FROM bulletins WHERE txid = NEW.bid) THEN
+        INSERT INTO orphan_endos (txid, bid, non_record)
+        VALUES (NEW.txid, NEW.bid, CASE WHEN
+            EXISTS(SELECT * FROM endorsements WHERE txid = NEW.bid) OR
+            EXISTS(SELECT * FROM raw_txs WHERE txid = NEW.bid) THEN 1 ELSE 0 END)
+        ON CONFLICT (txid) DO UPDATE
+        SET bid = excluded.bid, non_record = excluded.non_record;
+    END IF;
+    RETURN NULL;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orphan_endos_insert ON endorsements;
+CREATE TRIGGER orphan_endos_insert AFTER INSERT ON endorsements
+FOR EACH ROW EXECUTE PROCEDURE orphan_endos_insert();
+
+CREATE OR REPLACE FUNCTION orphan_endos_delete() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM orphan_endos WHERE txid = OLD.txid;
+    RETURN NULL;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orphan_endos_delete ON endorsements;
+CREATE TRIGGER orphan_endos_delete AFTER DELETE ON endorsements
+FOR EACH ROW EXECUTE PROCEDURE orphan_endos_delete();
+
+CREATE OR REPLACE FUNCTION orphan_endos_link() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM orphan_endos WHERE bid = NEW.txid;
+    RETURN NULL;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orphan_endos_link ON bulletins;
+CREATE TRIGGER orphan_endos_link AFTER INSERT ON bulletins
+FOR EACH ROW EXECUTE PROCEDURE orphan_endos_link();
+
+CREATE OR REPLACE FUNCTION orphan_endos_unlink() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO orphan_endos (txid, bid)
+    SELECT txid, bid FROM endorsements WHERE bid = OLD.txid
+    ON CONFLICT (txid) DO UPDATE SET bid = excluded.bid, non_record = 0;
+    RETURN NULL;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orphan_endos_unlink ON bulletins;
+CREATE TRIGGER orphan_endos_unlink AFTER DELETE ON bulletins
+FOR EACH ROW EXECUTE PROCEDURE orphan_endos_unlink();
+
+CREATE TABLE IF NOT EXISTS reputation (
+    author      TEXT COLLATE "C" NOT NULL,
+    score       DOUBLE PRECISION NOT NULL,
+
+    PRIMARY KEY(author)
+);
+`
+
+	// dropPgSql removes every table of the record. The functions are left
+	// since creating the schema replaces them.
+	dropPgSql string = `
+		DROP VIEW IF EXISTS bltn_rtree;
+		DROP TABLE IF EXISTS reputation, orphan_endos, raw_txs, merkle_proofs,
+			blacklist, bltn_locs, tags, endorsements, bulletins, blocks,
+			schema_version CASCADE;
+	`
+
+	// selectBrokenLinksSql finds the blocks above the lowest one that follow
+	// a block that is not stored.
+	selectBrokenLinksSql string = `
+		SELECT 'block ' || b.hash || ' follows missing block ' || b.prevhash
+		FROM blocks AS b
+		WHERE b.height > (SELECT min(height) FROM blocks) AND
+			NOT EXISTS(SELECT * FROM blocks WHERE hash = b.prevhash)
+		ORDER BY b.height ASC
+	`
+)
+
+// InitPgDB drops the record in the PostgreSQL database at url and creates a
+// new empty one in its place. Like InitDB the bitcoin network picks the peg
+// block the record starts from.
+func InitPgDB(url string, params *chaincfg.Params) (*PublicRecord, error) {
+	db, err := createPgPubRec(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.conn.Exec(dropPgSql); err != nil {
+		return nil, err
+	}
+	if err := createPg(db); err != nil {
+		return nil, err
+	}
+	return initDB(db, params)
+}
+
+// LoadPgDB connects to the record in the PostgreSQL database at url, brings
+// its schema up to date and prepares all the queries.
+func LoadPgDB(url string) (*PublicRecord, error) {
+	db, err := createPgPubRec(url)
+	if err != nil {
+		return nil, err
+	}
+	return prepareDB(db)
+}
+
+func createPgPubRec(url string) (*PublicRecord, error) {
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	db := &PublicRecord{
+		conn:      conn,
+		rconn:     conn,
+		dialect:   pgDialect,
+		integrity: &integrityCheck{},
+		ranker:    &ranker{},
+		feed:      ombstore.NewFeed(),
+		watcher:   &watcher{},
+	}
+
+	return db, nil
+}
+
+func createPg(db *PublicRecord) error {
+	_, err := db.conn.Exec(createPgSql)
+	return err
+}
+
+// pgForeignKeys does nothing since PostgreSQL always enforces foreign keys.
+// The peg block is let in by the blocks_link trigger instead.
+func pgForeignKeys(db *PublicRecord, on bool) error {
+	return nil
+}
+
+func pgFileSize(db *PublicRecord) (int64, error) {
+	var size int64
+	err := db.rconn.QueryRow("SELECT pg_database_size(current_database())").Scan(&size)
+	return size, err
+}
+
+// pgIntegrityCheck checks what the schema does not enforce on its own, which
+// is that every block past the peg follows a stored block.
+func pgIntegrityCheck(db *PublicRecord) ([]string, error) {
+	msgs, err := db.queryMessages(selectBrokenLinksSql)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		msgs = []string{"ok"}
+	}
+	return msgs, nil
+}
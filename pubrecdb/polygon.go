@@ -0,0 +1,92 @@
+package pubrecdb
+
+import (
+	"math"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+)
+
+// GetBulletinsInPolygon returns a page of the bulletins located within a
+// GeoJSON Polygon or MultiPolygon starting from the cursor. If the geometry
+// cannot be used ErrBadPolygon is returned.
+func (db *PublicRecord) GetBulletinsInPolygon(g *ombjson.Geometry, c *Cursor, limit int) (*ombjson.BltnPage, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	polys, err := ombstore.NewPolygons(g)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single polygon is narrowed down to its bounding box. Several are only
+	// narrowed down to the latitudes they span.
+	a, b := polys[0].Bounds()
+	for _, poly := range polys[1:] {
+		pa, _ := poly.Bounds()
+		a.MinLat, a.MaxLat = math.Min(a.MinLat, pa.MinLat), math.Max(a.MaxLat, pa.MaxLat)
+		a.MinLon, a.MaxLon = -180, 180
+		b = a
+	}
+
+	// Pull out everything in the box a page at a time and test each of the
+	// bulletins against the polygons until there is enough to fill the page.
+	limit = db.pageLimit(limit)
+	bltns := []*ombjson.Bulletin{}
+	cur := c
+	for {
+		rows, err := db.selectBBoxBltns.query(ctx, cur, limit, boxArgs(a, b)...)
+		if err != nil {
+			return nil, err
+		}
+		candidates, _, err := db.scanBltns(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		bltns = append(bltns, inPolygons(polys, candidates)...)
+		if len(bltns) > limit || len(candidates) <= limit {
+			break
+		}
+		last := candidates[len(candidates)-1]
+		cur = &Cursor{
+			Height: last.BlockRef.Height,
+			Txid:   last.Txid,
+			Before: c != nil && c.Before,
+		}
+	}
+
+	// The withheld bulletins in the box still have to be tested against the
+	// polygons to tell if any were left out of the page.
+	withheld := func(keys []ombstore.PageKey, more bool) (bool, error) {
+		rows, err := db.selectBBoxBltns.queryHeld(ctx, c, keys, more, boxArgs(a, b)...)
+		if err != nil {
+			return false, err
+		}
+		defer rows.Close()
+		held, _, err := db.scanBltnRows(rows)
+		if err != nil {
+			return false, err
+		}
+		return len(inPolygons(polys, held)) > 0, nil
+	}
+	return db.newBltnPage(c, bltns, limit, withheld)
+}
+
+// inPolygons returns the bulletins that are located in any of the polygons.
+func inPolygons(polys []ombstore.Polygon, bltns []*ombjson.Bulletin) []*ombjson.Bulletin {
+	found := []*ombjson.Bulletin{}
+	for _, bltn := range bltns {
+		if bltn.Location == nil {
+			continue
+		}
+		for _, poly := range polys {
+			if poly.Contains(bltn.Location.Lon, bltn.Location.Lat) {
+				found = append(found, bltn)
+				break
+			}
+		}
+	}
+	return found
+}
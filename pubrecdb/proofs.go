@@ -0,0 +1,154 @@
+package pubrecdb
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombutil"
+)
+
+var (
+	// createProofsSql is the part of the schema that holds the merkle
+	// branches of record transactions.
+	createProofsSql string = `
+-- The merkle branch of every record transaction stored with its block. The
+-- branch links the txid to the merkle root of the block's header.
+CREATE TABLE IF NOT EXISTS merkle_proofs (
+    txid        TEXT NOT NULL,
+    block       TEXT NOT NULL,
+    idx         INT NOT NULL,  -- The position of the tx in the block
+    branch      BLOB NOT NULL, -- The hashes of the branch one after another
+
+    PRIMARY KEY(txid),
+    FOREIGN KEY(block) REFERENCES blocks(hash) ON DELETE CASCADE
+);
+`
+
+	insertProofSql string = `
+		INSERT INTO merkle_proofs (txid, block, idx, branch)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	selectProofSql string = `
+		SELECT p.idx, p.branch, blocks.hash, blocks.prevhash, blocks.timestamp,
+			blocks.version, blocks.merkleroot, blocks.difficulty, blocks.nonce
+		FROM merkle_proofs AS p JOIN blocks ON p.block = blocks.hash
+		WHERE p.txid = $1
+	`
+)
+
+// createProofs adds the merkle proofs to records that do not have them yet.
+func createProofs(db *PublicRecord) error {
+	_, err := db.conn.Exec(createProofsSql)
+	return err
+}
+
+func prepareProofs(db *PublicRecord) (err error) {
+	db.insertProofStmt, err = db.prepareWrite(insertProofSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectProof, err = db.prepare(selectProofSql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// insertProofs stores the merkle branch of every record in the block. The
+// tree is only built when the block holds records.
+func (db *PublicRecord) insertProofs(tx *sql.Tx, oblk *ombutil.UBlock) error {
+	txids := []*wire.ShaHash{}
+	for _, bltn := range oblk.Bulletins {
+		sha := bltn.Tx.TxSha()
+		txids = append(txids, &sha)
+	}
+	for _, endo := range oblk.Endorsements {
+		sha := endo.Tx.TxSha()
+		txids = append(txids, &sha)
+	}
+	if len(txids) == 0 {
+		return nil
+	}
+
+	blk := oblk.Block
+	index := make(map[wire.ShaHash]int)
+	for i, t := range blk.Transactions() {
+		index[*t.Sha()] = i
+	}
+	store := blockchain.BuildMerkleTreeStore(blk.Transactions())
+	blkHash := blk.Sha().String()
+
+	for _, txid := range txids {
+		i, ok := index[*txid]
+		if !ok {
+			return fmt.Errorf("Record %s is not in block %s", txid, blkHash)
+		}
+
+		var branch bytes.Buffer
+		for _, h := range ombutil.MerkleBranch(store, i) {
+			branch.Write(h[:])
+		}
+
+		_, err := tx.Stmt(db.insertProofStmt).Exec(txid.String(), blkHash, i, branch.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetProof returns the proof that the record's transaction was mined in the
+// block it was stored with. Only records stored as part of a whole block have
+// a proof. If there is no proof for txid sql.ErrNoRows is returned.
+func (db *PublicRecord) GetProof(txid *wire.ShaHash) (*ombjson.MerkleProof, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	var idx int
+	var branch []byte
+	var hash, prevhash, merkleroot string
+	var ts int64
+	var version int32
+	var bits, nonce uint32
+
+	err := db.selectProof.QueryRowContext(ctx, txid.String()).Scan(&idx, &branch, &hash,
+		&prevhash, &ts, &version, &merkleroot, &bits, &nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := rebuildHeader(prevhash, merkleroot, ts, version, bits, nonce)
+	if err != nil {
+		return nil, err
+	}
+	var header bytes.Buffer
+	if err := h.Serialize(&header); err != nil {
+		return nil, err
+	}
+
+	if len(branch)%wire.HashSize != 0 {
+		return nil, fmt.Errorf("Merkle branch of %s is malformed", txid)
+	}
+
+	proof := &ombjson.MerkleProof{
+		Header: hex.EncodeToString(header.Bytes()),
+		Index:  idx,
+		Branch: []string{},
+	}
+	for i := 0; i < len(branch); i += wire.HashSize {
+		b, err := wire.NewShaHash(branch[i : i+wire.HashSize])
+		if err != nil {
+			return nil, err
+		}
+		proof.Branch = append(proof.Branch, b.String())
+	}
+	return proof, nil
+}
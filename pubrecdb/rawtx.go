@@ -0,0 +1,236 @@
+package pubrecdb
+
+import (
+	"bytes"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire"
+)
+
+var (
+	// createRawTxsSql is the part of the schema that holds the raw
+	// transactions records were parsed from.
+	createRawTxsSql string = `
+-- Every transaction with the Ombuds magic bytes in a stored block as it was
+-- sent over the wire. Only filled when the relay keeps raw transactions.
+CREATE TABLE IF NOT EXISTS raw_txs (
+    txid        TEXT NOT NULL,
+    block       TEXT NOT NULL,
+    tx          BLOB NOT NULL, -- The serialized wire.MsgTx
+    outputs     TEXT NOT NULL, -- Comma separated indices of the TxOuts holding the record
+
+    PRIMARY KEY(txid),
+    FOREIGN KEY(block) REFERENCES blocks(hash) ON DELETE CASCADE
+);
+`
+
+	insertRawTxSql string = `
+		INSERT OR REPLACE INTO raw_txs (txid, block, tx, outputs)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	selectRawTxsSql string = `
+		SELECT raw_txs.tx, blocks.hash, blocks.prevhash, blocks.height,
+			blocks.timestamp, blocks.version, blocks.merkleroot,
+			blocks.difficulty, blocks.nonce
+		FROM raw_txs JOIN blocks ON raw_txs.block = blocks.hash
+		ORDER BY blocks.height ASC, raw_txs.txid ASC
+	`
+
+	// clearRawRecordsSql drops everything derived from the stored raw
+	// transactions so that it can be parsed again. Records without a raw
+	// transaction are left alone.
+	clearRawRecordsSql string = `
+		DELETE FROM tags WHERE txid IN (SELECT txid FROM raw_txs);
+		DELETE FROM bltn_locs WHERE txid IN (SELECT txid FROM raw_txs);
+		DELETE FROM bulletins WHERE txid IN (SELECT txid FROM raw_txs);
+		DELETE FROM endorsements WHERE txid IN (SELECT txid FROM raw_txs);
+	`
+
+	// flagRawOrphansSql marks the orphans whose bid is a kept transaction
+	// that no longer parses into a bulletin. The triggers that put orphans
+	// back when their bulletin is dropped do not know that.
+	flagRawOrphansSql string = `
+		UPDATE orphan_endos SET non_record = 1
+		WHERE bid IN (SELECT txid FROM raw_txs) OR
+			bid IN (SELECT txid FROM endorsements)
+	`
+)
+
+// createRawTxs adds the raw transactions to records that do not have them
+// yet.
+func createRawTxs(db *PublicRecord) error {
+	_, err := db.conn.Exec(createRawTxsSql)
+	return err
+}
+
+func prepareRawTxs(db *PublicRecord) (err error) {
+	db.insertRawTxStmt, err = db.prepareWrite(insertRawTxSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectRawTxs, err = db.prepareWrite(selectRawTxsSql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// KeepRawTxs turns storing the raw transactions of the blocks passed to
+// InsertUBlock on or off. It is off unless Options.KeepRawTxs was set. Only
+// the records of raw transactions that were kept can be rebuilt by Reindex.
+func (db *PublicRecord) KeepRawTxs(keep bool) {
+	db.keepRawTxs = keep
+}
+
+// insertRawTxs stores every transaction in the block that carries the magic
+// bytes, including the ones that failed to parse into records.
+func (db *PublicRecord) insertRawTxs(tx *sql.Tx, blk *btcutil.Block) error {
+	blkHash := blk.Sha().String()
+	for _, t := range blk.Transactions() {
+		msg := t.MsgTx()
+		if !ombwire.HasMagic(msg) {
+			continue
+		}
+
+		var raw bytes.Buffer
+		if err := msg.Serialize(&raw); err != nil {
+			return err
+		}
+
+		// A record that cannot be found still has its tx kept.
+		outs, _ := ombwire.RecordOuts(msg)
+		idxs := []string{}
+		for _, i := range outs {
+			idxs = append(idxs, strconv.Itoa(i))
+		}
+
+		_, err := tx.Stmt(db.insertRawTxStmt).Exec(t.Sha().String(), blkHash,
+			raw.Bytes(), strings.Join(idxs, ","))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reindex parses the stored raw transactions again and rebuilds the
+// bulletins, endorsements and tags that come from them in place along with
+// the orphans. The whole rebuild is one sql transaction and every author is
+// ranked again once it has been committed. Transactions that do not parse
+// into a record are skipped just like they are when a block is first stored.
+// Merkle proofs need the whole block so a record that only parses now has
+// none. It returns the number of records that were stored.
+func (db *PublicRecord) Reindex(net *chaincfg.Params) (int, error) {
+	tx, err := db.conn.BeginTx(db.baseCtx(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Stmt(db.selectRawTxs).QueryContext(db.baseCtx())
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// Every raw tx is read before anything is written back.
+	bltns := []*ombutil.Bulletin{}
+	endos := []*ombutil.Endorsement{}
+	blks := make(map[string]*btcutil.Block)
+	for rows.Next() {
+		var raw []byte
+		var hash, prevhash, merkleroot string
+		var height int32
+		var ts int64
+		var version int32
+		var bits, nonce uint32
+		err := rows.Scan(&raw, &hash, &prevhash, &height, &ts, &version,
+			&merkleroot, &bits, &nonce)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+
+		blk, ok := blks[hash]
+		if !ok {
+			h, err := rebuildHeader(prevhash, merkleroot, ts, version, bits, nonce)
+			if err != nil {
+				rows.Close()
+				tx.Rollback()
+				return 0, err
+			}
+			blk = btcutil.NewBlock(&wire.MsgBlock{Header: *h})
+			blk.SetHeight(height)
+			blks[hash] = blk
+		}
+
+		msg := &wire.MsgTx{}
+		if err := msg.Deserialize(bytes.NewReader(raw)); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+
+		w, err := ombwire.ParseTx(msg)
+		if w == nil || err != nil {
+			continue
+		}
+		switch w := w.(type) {
+		case *ombwire.Bulletin:
+			bltn, err := ombutil.NewBltn(w, btcutil.NewTx(msg), blk, net)
+			if err == nil {
+				bltns = append(bltns, bltn)
+			}
+		case *ombwire.Endorsement:
+			endo, err := ombutil.NewEndo(w, btcutil.NewTx(msg), blk, net)
+			if err == nil {
+				endos = append(endos, endo)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(db.baseCtx(), clearRawRecordsSql); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	for _, bltn := range bltns {
+		if err := db.insertBulletin(tx, bltn); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	for _, endo := range endos {
+		if err := db.insertEndorsement(tx, endo); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if _, err := tx.ExecContext(db.baseCtx(), flagRawOrphansSql); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	n := len(bltns) + len(endos)
+	if err := db.UpdateReputation(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,106 @@
+package pubrecdb_test
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+// recordBlock builds the block that follows the peg block with a coinbase and
+// a single bulletin in it.
+func recordBlock(t *testing.T, msg string) (*btcutil.Block, *wire.MsgTx) {
+	pubkey, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	sigScript, err := txscript.NewScriptBuilder().AddData(make([]byte, 71)).
+		AddData(pubkey).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := ombwire.NewBulletin(msg, 123741234, nil)
+	outs, err := w.TxOuts(546, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bltnTx := wire.NewMsgTx()
+	bltnTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: wire.ShaHash{}, Index: 1},
+		SignatureScript:  sigScript,
+		Sequence:         0xffffffff,
+	})
+	for _, out := range outs {
+		bltnTx.AddTxOut(out)
+	}
+
+	msgBlk := &wire.MsgBlock{}
+	msgBlk.AddTransaction(fakeMsgTx(100))
+	msgBlk.AddTransaction(bltnTx)
+	store := blockchain.BuildMerkleTreeStore(btcutil.NewBlock(msgBlk).Transactions())
+	msgBlk.Header = wire.BlockHeader{
+		PrevBlock:  *peg.GetStartBlock().Sha(),
+		MerkleRoot: *store[len(store)-1],
+		Timestamp:  time.Unix(123456789, 0),
+	}
+
+	blk := btcutil.NewBlock(msgBlk)
+	blk.SetHeight(peg.StartHeight + 1)
+	return blk, bltnTx
+}
+
+func TestReindex(t *testing.T) {
+	db, _ := SetupTestDB(false)
+	db.KeepRawTxs(true)
+	defer db.KeepRawTxs(false)
+
+	blk, bltnTx := recordBlock(t, "Parse me again #reindex")
+	ublk := ombutil.CreateUBlock(blk, nil, &chaincfg.MainNetParams)
+	if len(ublk.Bulletins) != 1 {
+		t.Fatal(spw(ublk))
+	}
+	if err, ok := db.InsertUBlock(ublk); err != nil || !ok {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	n, err := db.Reindex(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("Reindex stored %d records", n)
+	}
+
+	txid := bltnTx.TxSha()
+	bltn, err := db.GetBulletin(&txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bltn.Message != "Parse me again #reindex" || bltn.BlockRef.Hash != blk.Sha().String() {
+		t.Fatal(spw(bltn))
+	}
+
+	board, err := db.GetBoardSummary("reindex")
+	if err != nil || board.NumBltns != 1 {
+		t.Fatalf("Tags were not rebuilt: %v %s", err, spw(board))
+	}
+
+	if bltn.Proof != nil {
+		t.Fatal("Proof was added without being asked for")
+	}
+	bltn, err = db.GetBulletin(&txid, pubrecdb.WithProof)
+	if err != nil || bltn.Proof == nil {
+		t.Fatalf("Proof is missing: %v", err)
+	}
+	if err := ombutil.VerifyMerkleProof(txid.String(), blk.Sha().String(), bltn.Proof); err != nil {
+		t.Fatal(err)
+	}
+}
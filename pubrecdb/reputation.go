@@ -0,0 +1,322 @@
+package pubrecdb
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+	"github.com/soapboxsys/ombudslib/ombutil"
+)
+
+var (
+	// createReputationSql is the part of the schema that holds the rank of
+	// every author in the endorsement graph.
+	createReputationSql string = `
+-- The score of every author in the endorsement graph as of the tip. An
+-- average author has a score of 1. Recomputed after each block of records.
+CREATE TABLE IF NOT EXISTS reputation (
+    author      TEXT NOT NULL,
+    score       REAL NOT NULL,
+
+    PRIMARY KEY(author)
+);
+`
+
+	// selectRepAuthorsSql lists every author that is not withheld with the
+	// height of the first block they sent something in and the tip's height.
+	selectRepAuthorsSql string = `
+		SELECT author, min(height), (SELECT max(height) FROM blocks)
+		FROM (
+			SELECT bulletins.author AS author, blocks.height AS height
+			FROM bulletins JOIN blocks ON bulletins.block = blocks.hash
+			WHERE NOT ` + withheldBltnSql("bulletins") + `
+			UNION ALL
+			SELECT e.author, blocks.height
+			FROM endorsements AS e JOIN blocks ON e.block = blocks.hash
+			WHERE NOT ` + withheldEndoSql("e") + `
+		) AS records
+		GROUP BY author
+	`
+
+	// selectRepEdgesSql weighs the edge between two authors by the number of
+	// bulletins one endorsed of the other's.
+	selectRepEdgesSql string = `
+		SELECT e.author, b.author, count(DISTINCT e.bid)
+		FROM endorsements AS e JOIN bulletins AS b ON e.bid = b.txid
+		WHERE e.author != b.author AND
+			NOT ` + withheldEndoSql("e") + ` AND
+			NOT ` + withheldBltnSql("b") + `
+		GROUP BY e.author, b.author
+	`
+
+	selectReputationSql string = `
+		SELECT author, score FROM reputation
+	`
+
+	clearReputationSql string = `
+		DELETE FROM reputation
+	`
+
+	insertReputationSql string = `
+		INSERT INTO reputation (author, score) VALUES ($1, $2)
+	`
+
+	selectTopAuthorsSql string = authorsSql + `
+		ORDER BY score DESC, author ASC
+		LIMIT $1
+	`
+
+	// selectHeldAuthorsSql is true when an author on the blacklist has sent
+	// a record, since they are left out of the ranking.
+	selectHeldAuthorsSql string = `
+		SELECT EXISTS(
+			SELECT * FROM blacklist WHERE kind = 'author' AND (
+				value IN (SELECT author FROM bulletins) OR
+				value IN (SELECT author FROM endorsements)
+			)
+		)
+	`
+)
+
+// createReputation adds the reputation table to records that do not have it
+// yet.
+func createReputation(db *PublicRecord) error {
+	_, err := db.conn.Exec(createReputationSql)
+	return err
+}
+
+func prepareReputation(db *PublicRecord) (err error) {
+	db.selectRepAuthors, err = db.prepare(selectRepAuthorsSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectRepEdges, err = db.prepare(selectRepEdgesSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectReputation, err = db.prepare(selectReputationSql)
+	if err != nil {
+		return err
+	}
+
+	db.clearReputationStmt, err = db.prepareWrite(clearReputationSql)
+	if err != nil {
+		return err
+	}
+
+	db.insertReputationStmt, err = db.prepareWrite(insertReputationSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectTopAuthors, err = db.prepare(selectTopAuthorsSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectHeldAuthors, err = db.prepare(selectHeldAuthorsSql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// buildReputation ranks the authors of records that were stored before the
+// reputation table existed.
+func buildReputation(db *PublicRecord) error {
+	var cnt int
+	err := db.conn.QueryRow("SELECT count(*) FROM reputation").Scan(&cnt)
+	if err != nil || cnt > 0 {
+		return err
+	}
+
+	return db.UpdateReputation()
+}
+
+// ranker runs the rankings that InsertUBlock asks for one at a time off
+// the writer. Blocks stored while a ranking runs are covered by a single run
+// after it, so a record that is syncing does not rank after every block.
+type ranker struct {
+	// run is held for the whole of a ranking so that only one is stored
+	// at a time.
+	run sync.Mutex
+
+	mu      sync.Mutex
+	busy    bool
+	pending bool
+}
+
+// kick starts rank in the background unless a ranking is already running,
+// in which case it is run once more after that one.
+func (r *ranker) kick(rank func() error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.busy {
+		r.pending = true
+		return
+	}
+	r.busy = true
+
+	go func() {
+		for {
+			// A run that fails is tried again after the next block.
+			if err := rank(); err != nil {
+				log.Printf("Ranking authors failed: %s\n", err)
+			}
+
+			r.mu.Lock()
+			if !r.pending {
+				r.busy = false
+				r.mu.Unlock()
+				return
+			}
+			r.pending = false
+			r.mu.Unlock()
+		}
+	}()
+}
+
+// UpdateReputation ranks every author in the record again. Blocks stored
+// with InsertUBlock are ranked in the background shortly after they are
+// stored, but records inserted one at a time or blacklisted are only
+// reflected in the scores once it is called. Every ranking is a full one
+// over the whole endorsement graph.
+func (db *PublicRecord) UpdateReputation() error {
+	return db.updateReputation(db.baseCtx())
+}
+
+// rankInBackground ranks the authors again without holding up the writer.
+func (db *PublicRecord) rankInBackground() {
+	db.ranker.kick(func() error {
+		return db.updateReputation(context.Background())
+	})
+}
+
+// updateReputation ranks every author again. It is a full re-rank, not an
+// incremental one: the whole graph is read from the read pool and the whole
+// reputation table is rewritten in a transaction of its own, so blocks keep
+// being stored while it runs. Starting from the stored scores only makes it
+// settle in fewer iterations.
+// Authors are trusted in proportion to how long ago they were first seen up
+// to ombstore.RepTrustBlocks.
+func (db *PublicRecord) updateReputation(ctx context.Context) error {
+	db.ranker.run.Lock()
+	defer db.ranker.run.Unlock()
+
+	g := ombutil.NewRepGraph()
+
+	rows, err := db.selectRepAuthors.QueryContext(ctx)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var author string
+		var first, tip int32
+		if err := rows.Scan(&author, &first, &tip); err != nil {
+			rows.Close()
+			return err
+		}
+		age := tip - first
+		if age > ombstore.RepTrustBlocks {
+			age = ombstore.RepTrustBlocks
+		}
+		g.AddAuthor(author, float64(1+age))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.selectRepEdges.QueryContext(ctx)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var from, to string
+		var w int
+		if err := rows.Scan(&from, &to, &w); err != nil {
+			rows.Close()
+			return err
+		}
+		g.AddEdge(from, to, float64(w))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	prev := make(map[string]float64)
+	rows, err = db.selectReputation.QueryContext(ctx)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var author string
+		var score float64
+		if err := rows.Scan(&author, &score); err != nil {
+			rows.Close()
+			return err
+		}
+		prev[author] = score
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	scores := g.Rank(prev)
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Stmt(db.clearReputationStmt).Exec(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt := tx.Stmt(db.insertReputationStmt)
+	for author, score := range scores {
+		if _, err := stmt.Exec(author, score); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTopAuthors returns up to limit of the authors with the highest
+// reputation with the highest first. Withheld authors are not ranked, so it
+// reports if any author on the blacklist has sent a record instead.
+func (db *PublicRecord) GetTopAuthors(limit int) ([]*ombjson.AuthorSummary, bool, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	rows, err := db.selectTopAuthors.QueryContext(ctx, db.pageLimit(limit))
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	authors := []*ombjson.AuthorSummary{}
+	for rows.Next() {
+		summary, _, err := scanAuthorSummary(rows, SortPosts)
+		if err != nil {
+			return nil, false, err
+		}
+		authors = append(authors, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	var withheld bool
+	if err := db.selectHeldAuthors.QueryRowContext(ctx).Scan(&withheld); err != nil {
+		return nil, false, err
+	}
+	return authors, withheld, nil
+}
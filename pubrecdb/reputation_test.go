@@ -0,0 +1,59 @@
+package pubrecdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/soapboxsys/ombudslib/ombutil"
+)
+
+func TestGetTopAuthors(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	// The test records are inserted one at a time so nothing is ranked yet.
+	if err := db.UpdateReputation(); err != nil {
+		t.Fatal(err)
+	}
+
+	authors, withheld, err := db.GetTopAuthors(10)
+	if err != nil || withheld {
+		t.Fatal(err)
+	}
+	if len(authors) != 2 {
+		t.Fatal(spw(authors))
+	}
+
+	// 4end0 endorsed a bulletin by 3J98... which only endorsed itself.
+	top, next := authors[0], authors[1]
+	if top.Address != "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy" || next.Address != "4end0" ||
+		top.Reputation <= 1 || next.Reputation >= 1 {
+		t.Fatal(spw(authors))
+	}
+}
+
+func TestRankAfterInsert(t *testing.T) {
+	db, _ := SetupTestDB(false)
+
+	blk, _ := recordBlock(t, "Rank me #reputation")
+	ublk := ombutil.CreateUBlock(blk, nil, &chaincfg.MainNetParams)
+	if err, ok := db.InsertUBlock(ublk); err != nil || !ok {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	// The block is ranked after it is stored without holding up the insert.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		authors, _, err := db.GetTopAuthors(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(authors) == 1 && authors[0].Reputation > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(spw(authors))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,4 +1,4 @@
--- DB Schema -- Version 0.2.0
+-- DB Schema -- Version 0.8.0
 
 CREATE TABLE blocks (
     hash        TEXT NOT NULL, 
@@ -52,3 +52,111 @@ CREATE TABLE tags (
 CREATE INDEX IF NOT EXISTS idx_tags ON tags (value);
 CREATE INDEX IF NOT EXISTS idx_height ON blocks (height);
 CREATE INDEX IF NOT EXISTS idx_timestamp ON blocks (timestamp);
+
+-- The spatial index over located bulletins. bltn_locs gives every located
+-- bulletin a stable integer id that the R*Tree is keyed on. Both are kept in
+-- sync with bulletins by the triggers below.
+CREATE TABLE IF NOT EXISTS bltn_locs (
+    id          INTEGER PRIMARY KEY,
+    txid        TEXT UNIQUE NOT NULL,
+
+    FOREIGN KEY(txid) REFERENCES bulletins(txid) ON DELETE CASCADE
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS bltn_rtree USING rtree(
+    id,
+    minLat, maxLat,
+    minLon, maxLon
+);
+
+CREATE TRIGGER IF NOT EXISTS bltn_locs_insert AFTER INSERT ON bulletins
+WHEN new.latitude IS NOT NULL AND new.longitude IS NOT NULL
+BEGIN
+    INSERT INTO bltn_locs (txid) VALUES (new.txid);
+    INSERT INTO bltn_rtree (id, minLat, maxLat, minLon, maxLon)
+    VALUES (last_insert_rowid(), new.latitude, new.latitude, new.longitude, new.longitude);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bltn_locs_delete AFTER DELETE ON bltn_locs
+BEGIN
+    DELETE FROM bltn_rtree WHERE id = old.id;
+END;
+
+-- The relay's moderation blacklist. Bulletins and endorsements that match an
+-- entry are withheld from every read query but stay in the record.
+CREATE TABLE IF NOT EXISTS blacklist (
+    kind        TEXT NOT NULL, -- One of txid, author or tag
+    value       TEXT NOT NULL,
+    reason      TEXT NOT NULL,
+    timestamp   INT NOT NULL,  -- When the entry was added as an epoch time
+
+    PRIMARY KEY(kind, value)
+);
+-- The merkle branch of every record transaction stored with its block. The
+-- branch links the txid to the merkle root of the block's header.
+CREATE TABLE IF NOT EXISTS merkle_proofs (
+    txid        TEXT NOT NULL,
+    block       TEXT NOT NULL,
+    idx         INT NOT NULL,  -- The position of the tx in the block
+    branch      BLOB NOT NULL, -- The hashes of the branch one after another
+
+    PRIMARY KEY(txid),
+    FOREIGN KEY(block) REFERENCES blocks(hash) ON DELETE CASCADE
+);
+-- Every transaction with the Ombuds magic bytes in a stored block as it was
+-- sent over the wire. Only filled when the relay keeps raw transactions.
+CREATE TABLE IF NOT EXISTS raw_txs (
+    txid        TEXT NOT NULL,
+    block       TEXT NOT NULL,
+    tx          BLOB NOT NULL, -- The serialized wire.MsgTx
+    outputs     TEXT NOT NULL, -- Comma separated indices of the TxOuts holding the record
+
+    PRIMARY KEY(txid),
+    FOREIGN KEY(block) REFERENCES blocks(hash) ON DELETE CASCADE
+);
+-- Endorsements whose bid is not a stored bulletin. The triggers below link an
+-- endorsement to its bulletin by removing it from here once the bulletin is
+-- stored and put it back if the bulletin is dropped.
+CREATE TABLE IF NOT EXISTS orphan_endos (
+    txid        TEXT NOT NULL, -- the endorsement's txid
+    bid         TEXT NOT NULL,
+    non_record  INT NOT NULL DEFAULT 0, -- Set once the bid is known not to be a bulletin
+
+    PRIMARY KEY(txid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_orphan_bid ON orphan_endos (bid);
+
+CREATE TRIGGER IF NOT EXISTS orphan_endos_insert AFTER INSERT ON endorsements
+WHEN NOT EXISTS(SELECT * FROM bulletins WHERE txid = new.bid)
+BEGIN
+    INSERT OR REPLACE INTO orphan_endos (txid, bid, non_record)
+    VALUES (new.txid, new.bid,
+        EXISTS(SELECT * FROM endorsements WHERE txid = new.bid) OR
+        EXISTS(SELECT * FROM raw_txs WHERE txid = new.bid));
+END;
+
+CREATE TRIGGER IF NOT EXISTS orphan_endos_delete AFTER DELETE ON endorsements
+BEGIN
+    DELETE FROM orphan_endos WHERE txid = old.txid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS orphan_endos_link AFTER INSERT ON bulletins
+BEGIN
+    DELETE FROM orphan_endos WHERE bid = new.txid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS orphan_endos_unlink AFTER DELETE ON bulletins
+BEGIN
+    INSERT OR REPLACE INTO orphan_endos (txid, bid)
+    SELECT txid, bid FROM endorsements WHERE bid = old.txid;
+END;
+
+-- The score of every author in the endorsement graph as of the tip. An
+-- average author has a score of 1. Recomputed after each block of records.
+CREATE TABLE IF NOT EXISTS reputation (
+    author      TEXT NOT NULL,
+    score       REAL NOT NULL,
+
+    PRIMARY KEY(author)
+);
@@ -1,43 +1,90 @@
 package pubrecdb
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/wire"
 	sqlite "github.com/mattn/go-sqlite3"
-	"github.com/soapboxsys/ombudslib/ombwire/peg"
+	"github.com/soapboxsys/ombudslib/ombstore"
 )
 
-var defaultMaxQueryLimit = 10000
+// Options tune how LoadDB opens a sqlite record.
+type Options struct {
+	// WAL puts the file in write-ahead logging mode. Queries then keep
+	// reading while a block is being stored instead of waiting for it.
+	WAL bool
+
+	// ReadConns is the most connections the read-only pool that queries
+	// run on opens at once. 0 leaves the pool unbounded. Everything that
+	// writes shares a single connection of its own.
+	ReadConns int
+
+	// BusyTimeout is how long a connection waits for a lock held by
+	// another one before failing with SQLITE_BUSY.
+	BusyTimeout time.Duration
+
+	// KeepRawTxs stores the raw transactions of the blocks passed to
+	// InsertUBlock so that their records can be rebuilt by Reindex.
+	KeepRawTxs bool
+}
+
+// DefaultOptions returns the options LoadDB uses when it is passed nil.
+func DefaultOptions() *Options {
+	return &Options{
+		WAL:         true,
+		ReadConns:   8,
+		BusyTimeout: 5 * time.Second,
+	}
+}
 
 // The overarching struct that contains everything needed for a connection to a
-// sqlite db containing the public record.
+// sqlite or PostgreSQL db containing the public record.
 type PublicRecord struct {
-	conn *sql.DB
+	// conn is the single connection everything that writes goes through.
+	// Queries run on the rconn pool so that they never hold up a write.
+	// Both are the same pool for PostgreSQL.
+	conn    *sql.DB
+	rconn   *sql.DB
+	dialect *dialect
 
 	// Max Number of Records returned by db
 	maxQueryLimit int
 
 	// Precompiled SQL selects
 	selectBltn          *sql.Stmt
-	selectTag           *sql.Stmt
+	selectTag           *pagedStmt
 	selectEndo          *sql.Stmt
 	selectBltnsHeight   *sql.Stmt
 	findHeight          *sql.Stmt
 	selectBlock         *sql.Stmt
 	selectBlockTip      *sql.Stmt
 	selectEndosByBid    *sql.Stmt
-	selectBestTags      *sql.Stmt
 	selectAuthorBltns   *sql.Stmt
 	selectAuthorEndos   *sql.Stmt
-	selectNearbyBltns   *sql.Stmt
+	selectNearbyBltns   *pagedStmt
 	selectMostEndoBltns *sql.Stmt
 	selectEndosByHeight *sql.Stmt
 
+	selectNearbyBltnsByDist *sql.Stmt
+	selectBBoxBltns         *pagedStmt
+	selectBoard             *sql.Stmt
+	selectActivity          *sql.Stmt
+
+	// Paged queries over both bulletins and endorsements
+	selectRecords       *pagedStmt
+	selectRangeBltns    *sql.Stmt
+	selectRangeEndos    *sql.Stmt
+	selectAuthorRecords *pagedStmt
+
 	// Line-O-PROGRESS
 	selectBlockHead   *sql.Stmt
 	selectBlockBltns  *sql.Stmt
@@ -46,9 +93,7 @@ type PublicRecord struct {
 	selectAllBoards   *sql.Stmt
 	selectRecentConf  *sql.Stmt
 	selectUnconfirmed *sql.Stmt
-	selectBlksByDay   *sql.Stmt
-	selectDBStatus    *sql.Stmt
-	selectAllAuthors  *sql.Stmt
+	selectAllAuthors  map[string]*pagedStmt
 
 	// Precompiled inserts
 	insertBlockHeadStmt   *sql.Stmt
@@ -59,9 +104,67 @@ type PublicRecord struct {
 	// Precompiled deletes
 	deleteBlockStmt *sql.Stmt
 
+	// Merkle proofs
+	insertProofStmt *sql.Stmt
+	selectProof     *sql.Stmt
+
+	// Raw transactions
+	insertRawTxStmt *sql.Stmt
+	selectRawTxs    *sql.Stmt
+	keepRawTxs      bool
+
+	// Trending
+	selectTrendTags  *sql.Stmt
+	selectTrendBltns *sql.Stmt
+
+	// Tag details
+	selectRelatedTags *sql.Stmt
+	selectTagFirstUse *sql.Stmt
+	selectTagAuthors  *sql.Stmt
+	selectTagActivity *sql.Stmt
+
+	// Reputation
+	selectRepAuthors     *sql.Stmt
+	selectRepEdges       *sql.Stmt
+	selectReputation     *sql.Stmt
+	clearReputationStmt  *sql.Stmt
+	insertReputationStmt *sql.Stmt
+	selectTopAuthors     *sql.Stmt
+	selectHeldAuthors    *sql.Stmt
+	ranker               *ranker
+
+	// Orphan endorsements
+	selectOpenBids    *sql.Stmt
+	flagNonRecordStmt *sql.Stmt
+	selectOrphanEndos *pagedStmt
+	txIndex           TxIndex
+
+	// Moderation
+	insertBlacklistStmt *sql.Stmt
+	deleteBlacklistStmt *sql.Stmt
+	isBlacklistedStmt   *sql.Stmt
+
+	// Status reporting
+	selectDBStatus      *sql.Stmt
+	selectPeg           *sql.Stmt
+	selectGaps          *sql.Stmt
+	selectSchemaVersion *sql.Stmt
+	integrity           *integrityCheck
+
+	// Subscriptions to changes
+	feed    *ombstore.Feed
+	watcher *watcher
+
 	// Utility queries
 	blockIsTipStmt    *sql.Stmt
 	computeStatistics *sql.Stmt
+
+	// Options
+	rawEndoCounts bool
+	queryTimeout  time.Duration
+
+	// ctx is set on the views made with WithContext
+	ctx context.Context
 }
 
 // Creates a DB at the desired path or drops an existing one and recreates a
@@ -69,10 +172,13 @@ type PublicRecord struct {
 // block must be inserted first for the DB to initialized properly.
 func InitDB(path string, params *chaincfg.Params) (*PublicRecord, error) {
 	path = filepath.Clean(path)
-	// Check if the file exists and remove it if it does.
-	if _, err := os.Stat(path); err == nil {
-		if err := os.Remove(path); err != nil {
-			return nil, err
+	// Check if the file exists and remove it if it does. A write-ahead log
+	// left next to it would be replayed into the new file.
+	for _, p := range []string{path, path + "-wal", path + "-shm"} {
+		if _, err := os.Stat(p); err == nil {
+			if err := os.Remove(p); err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -88,17 +194,22 @@ func InitDB(path string, params *chaincfg.Params) (*PublicRecord, error) {
 	}
 	conn.Close()
 
-	db, err := createPubRec(path)
+	db, err := createPubRec(path, DefaultOptions())
 	if err != nil {
 		return nil, err
 	}
+	return initDB(db, params)
+}
 
+// initDB stores the peg block in a record whose schema was just created and
+// prepares it.
+func initDB(db *PublicRecord, params *chaincfg.Params) (*PublicRecord, error) {
 	// Prepare the DB to do one insert (for the pegBlk)
 	if err := prepareInserts(db); err != nil {
 		return nil, err
 	}
 
-	err = db.InsertGenesisBlk(params.Net)
+	err := db.InsertGenesisBlk(params.Net)
 	if err != nil {
 		return nil, err
 	}
@@ -106,59 +217,128 @@ func InitDB(path string, params *chaincfg.Params) (*PublicRecord, error) {
 }
 
 // Loads a sqlite db, checks if its reachabale and prepares all the queries.
-func LoadDB(path string) (*PublicRecord, error) {
-	db, err := createPubRec(path)
+// Passing nil for opts uses DefaultOptions.
+func LoadDB(path string, opts *Options) (*PublicRecord, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	db, err := createPubRec(path, opts)
 	if err != nil {
 		return nil, err
 	}
 	return prepareDB(db)
 }
 
-// createPubRec attaches the DB conn to the public record. That DB connection
-// must be initialiazed with custom SQL functions before anything else can
-// touch it.
-func createPubRec(path string) (*PublicRecord, error) {
-
-	sql.Register("sqlite3_custom", &sqlite.SQLiteDriver{
-		ConnectHook: func(conn *sqlite.SQLiteConn) error {
-			err := conn.RegisterFunc("pow", pow, true)
-			if err != nil {
-				return err
-			}
-			err = conn.RegisterFunc("dist", distance, true)
-			if err != nil {
-				return err
-			}
-			return nil
-		},
+// registerSqlite guards registering the driver every connection to a sqlite
+// record is opened with. Its connections must be initialiazed with custom SQL
+// functions before anything else can touch them.
+var registerSqlite sync.Once
+
+// registerSqliteDriver registers the driver once.
+func registerSqliteDriver() {
+	registerSqlite.Do(func() {
+		sql.Register("sqlite3_custom", &sqlite.SQLiteDriver{
+			ConnectHook: func(conn *sqlite.SQLiteConn) error {
+				err := conn.RegisterFunc("pow", pow, true)
+				if err != nil {
+					return err
+				}
+				err = conn.RegisterFunc("dist", Distance, true)
+				if err != nil {
+					return err
+				}
+				err = conn.RegisterFunc("decay", ombstore.Decay, true)
+				if err != nil {
+					return err
+				}
+				return nil
+			},
+		})
 	})
+}
+
+// createPubRec attaches the writer and the read pool to the public record.
+func createPubRec(path string, opts *Options) (*PublicRecord, error) {
+
+	registerSqliteDriver()
 
 	path = filepath.Clean(path)
-	conn, err := sql.Open("sqlite3_custom", path)
+	conn, err := sql.Open("sqlite3_custom", sqliteDSN(path, opts, false))
 	if err != nil {
 		return nil, err
 	}
+	// A single writer never waits on itself for the write lock.
+	conn.SetMaxOpenConns(1)
 
 	err = conn.Ping()
 	if err != nil {
 		return nil, err
 	}
 
+	// The writer switched the file to WAL before any reader opens it.
+	rconn, err := sql.Open("sqlite3_custom", sqliteDSN(path, opts, true))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	rconn.SetMaxOpenConns(opts.ReadConns)
+
+	err = rconn.Ping()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
 	db := &PublicRecord{
-		conn: conn,
+		conn:       conn,
+		rconn:      rconn,
+		dialect:    sqliteDialect,
+		integrity:  &integrityCheck{},
+		ranker:     &ranker{},
+		feed:       ombstore.NewFeed(),
+		watcher:    &watcher{},
+		keepRawTxs: opts.KeepRawTxs,
 	}
 
 	return db, nil
 }
 
+// sqliteDSN returns the name a connection to the file at path is opened
+// with. Read-only connections never take the write lock. The writer takes it
+// when a transaction begins so that the transaction cannot fail half way
+// through on a busy file. Every connection of the writer enforces foreign keys
+// from the moment it is opened, so the cascades that deletes rely on hold
+// even when database/sql replaces a connection.
+func sqliteDSN(path string, opts *Options, readOnly bool) string {
+	params := url.Values{}
+	ms := opts.BusyTimeout / time.Millisecond
+	params.Set("_busy_timeout", strconv.FormatInt(int64(ms), 10))
+	if readOnly {
+		params.Set("mode", "ro")
+	} else {
+		params.Set("_txlock", "immediate")
+		params.Set("_foreign_keys", "1")
+		if opts.WAL {
+			params.Set("_journal_mode", "WAL")
+		}
+	}
+
+	u := &url.URL{Path: path}
+	return "file:" + u.EscapedPath() + "?" + params.Encode()
+}
+
 // prepareDB takes a pubrecord and initializes all of the precompiled
 // statements and executes any connection specific code
 func prepareDB(db *PublicRecord) (*PublicRecord, error) {
 
-	db.maxQueryLimit = defaultMaxQueryLimit
+	db.maxQueryLimit = ombstore.DefaultMaxQueryLimit
 
-	if err := ExecPragma(db, true); err != nil {
-		return nil, fmt.Errorf("Pragma defs failed: %s", err)
+	if err := db.dialect.create(db); err != nil {
+		return nil, err
+	}
+
+	if err := storeSchemaVersion(db); err != nil {
+		return nil, fmt.Errorf("Storing schema version failed: %v", err)
 	}
 
 	if err := prepareQueries(db); err != nil {
@@ -173,12 +353,79 @@ func prepareDB(db *PublicRecord) (*PublicRecord, error) {
 		return nil, fmt.Errorf("Preparing deletes failed: %v", err)
 	}
 
+	if err := prepareModeration(db); err != nil {
+		return nil, fmt.Errorf("Preparing moderation failed: %v", err)
+	}
+
+	if err := prepareProofs(db); err != nil {
+		return nil, fmt.Errorf("Preparing merkle proofs failed: %v", err)
+	}
+
+	if err := prepareRawTxs(db); err != nil {
+		return nil, fmt.Errorf("Preparing raw txs failed: %v", err)
+	}
+
+	if err := prepareOrphans(db); err != nil {
+		return nil, fmt.Errorf("Preparing orphan endorsements failed: %v", err)
+	}
+
+	if err := prepareTrending(db); err != nil {
+		return nil, fmt.Errorf("Preparing trending failed: %v", err)
+	}
+
+	if err := prepareTagDetail(db); err != nil {
+		return nil, fmt.Errorf("Preparing tag details failed: %v", err)
+	}
+
+	if err := prepareReputation(db); err != nil {
+		return nil, fmt.Errorf("Preparing reputation failed: %v", err)
+	}
+
+	if err := buildReputation(db); err != nil {
+		return nil, fmt.Errorf("Building reputation failed: %v", err)
+	}
+
 	return db, nil
 }
 
-// ExecPragma executes directives that are needed for the write side of the SQL
-// conn to enforce high quality (and secure!) sql statements.
+// createSqlite brings sqlite records created by older versions up to the
+// current schema.
+func createSqlite(db *PublicRecord) error {
+	if err := buildSpatialIndex(db); err != nil {
+		return fmt.Errorf("Building spatial index failed: %v", err)
+	}
+
+	if err := createBlacklist(db); err != nil {
+		return fmt.Errorf("Creating blacklist failed: %v", err)
+	}
+
+	if err := createProofs(db); err != nil {
+		return fmt.Errorf("Creating merkle proofs failed: %v", err)
+	}
+
+	if err := createRawTxs(db); err != nil {
+		return fmt.Errorf("Creating raw txs failed: %v", err)
+	}
+
+	if err := buildOrphans(db); err != nil {
+		return fmt.Errorf("Building orphan endorsements failed: %v", err)
+	}
+
+	if err := createReputation(db); err != nil {
+		return fmt.Errorf("Creating reputation failed: %v", err)
+	}
+
+	return nil
+}
+
+// ExecPragma turns enforcing foreign keys on the writer on or off. They are on
+// unless turned off here, and a connection the writer opens later always
+// starts with them on.
 func ExecPragma(db *PublicRecord, on bool) error {
+	return db.dialect.foreignKeys(db, on)
+}
+
+func sqliteForeignKeys(db *PublicRecord, on bool) error {
 	// The following pragmas define the operation of the sqlite3 conn. This
 	// does important things: it enforces foreign key constraints, ...
 	var s = "ON"
@@ -196,7 +443,7 @@ func ExecPragma(db *PublicRecord, on bool) error {
 
 // EmptyTables deletes all of the rows from the public record
 func (db *PublicRecord) EmptyTables() error {
-	txSql := `DELETE FROM blocks;`
+	txSql := `DELETE FROM blocks; DELETE FROM reputation;`
 	_, err := db.conn.Exec(txSql)
 	if err != nil {
 		return err
@@ -205,19 +452,13 @@ func (db *PublicRecord) EmptyTables() error {
 }
 
 func (db *PublicRecord) InsertGenesisBlk(net wire.BitcoinNet) error {
-	if net == wire.MainNet {
-		// Insert the pegged starting block
-		pegBlk := peg.GetStartBlock()
-		if err, ok := db.InsertBlockHead(pegBlk); !ok || err != nil {
-			return err
-		}
-	} else if net == wire.TestNet3 {
-		pegBlk := peg.GetTestStartBlock()
-		if err, ok := db.InsertBlockHead(pegBlk); !ok || err != nil {
-			return err
-		}
-	} else {
-		return fmt.Errorf("No peg for non-default Bitcoin Net")
+	// Insert the pegged starting block
+	pegBlk, err := ombstore.PegBlock(net)
+	if err != nil {
+		return err
+	}
+	if err, ok := db.InsertBlockHead(pegBlk); !ok || err != nil {
+		return err
 	}
 	return nil
 }
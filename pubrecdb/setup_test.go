@@ -1,6 +1,7 @@
 package pubrecdb_test
 
 import (
+	"database/sql"
 	"encoding/hex"
 	"log"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/soapboxsys/ombudslib/ombutil"
 	"github.com/soapboxsys/ombudslib/ombwire/peg"
 	. "github.com/soapboxsys/ombudslib/pubrecdb"
@@ -19,10 +21,19 @@ import (
 var tst_blk_a *btcutil.Block
 var testdb *PublicRecord
 
+// When PUBREC_TEST_PG holds the url of a local PostgreSQL database the tests
+// run against it instead of the sqlite file. Everything in it is dropped. Run
+// the tests once with it set and once without to cover both dialects:
+//
+//	PUBREC_TEST_PG=postgres://localhost/pubrec_test?sslmode=disable go test
+var testPgURL = os.Getenv("PUBREC_TEST_PG")
+
 // SetupTestDB exports setupTestDB for tests that live inside pubrecdb.
 func SetupTestDB(add_rows bool) (*PublicRecord, error) {
 	var err error
-	if testdb == nil {
+	if testdb == nil && testPgURL != "" {
+		testdb, err = InitPgDB(testPgURL, &chaincfg.MainNetParams)
+	} else if testdb == nil {
 		testdb, err = InitDB(getPath(), &chaincfg.MainNetParams)
 	}
 
@@ -74,6 +85,42 @@ func TestSetupDB(t *testing.T) {
 	}
 }
 
+func TestLoadDBOptions(t *testing.T) {
+	if testPgURL != "" {
+		t.Skip("Options only apply to sqlite records")
+	}
+	if _, err := SetupTestDB(true); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Options{WAL: true, ReadConns: 2, BusyTimeout: time.Second}
+	db, err := LoadDB(getPath(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk, err := db.GetBlockTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blk.Head.Hash != "c29afa6a9c333113f24d09368620c1eeb0943c65b92dc647cf80a51610a876d2" {
+		t.Fatal(spw(blk))
+	}
+
+	conn, err := sql.Open("sqlite3", getPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var mode string
+	if err := conn.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Fatalf("Record is in %s mode", mode)
+	}
+}
+
 func getPath() (s string) {
 	s = "/src/github.com/soapboxsys/ombudslib/pubrecdb/test/test.db"
 	s = path.Join(os.Getenv("GOPATH"), s)
@@ -83,7 +130,7 @@ func getPath() (s string) {
 // TODO(nskelsey)
 // setupTestInsertBlocks adds an initial set of blocks to the test db that
 // other test functions can rely on.
-func setupTestInsertBlocks(db *PublicRecord) {
+func setupTestInsertBlocks(db Store) {
 
 	peg_h := peg.GetStartBlock().Sha()
 	zero := *newSha("0000000000000000000000000000000000000000000000000000000000000000")
@@ -137,7 +184,7 @@ func setupTestInsertBlocks(db *PublicRecord) {
 	}
 }
 
-func setupTestInsertBltns(db *PublicRecord) {
+func setupTestInsertBltns(db Store) {
 
 	// bltn txid is
 	// [73532d0280dc80bd7b8477522d17cd648eae067d5759cd758b0939159d57dfab]
@@ -183,7 +230,7 @@ func setupTestInsertBltns(db *PublicRecord) {
 	}
 }
 
-func setupTestInsertEndos(db *PublicRecord) {
+func setupTestInsertEndos(db Store) {
 
 	// All endorsements contained within point to bltn(4)
 	bid_r, _ := hex.DecodeString("c19fbeacb46e865bfee6db89e9b0a41019079efa305b477d14a35945442e9f45")
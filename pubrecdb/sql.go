@@ -1,10 +1,14 @@
 package pubrecdb
 
+// SchemaVersion is the version of the schema written by createSql. Records
+// are brought up to it when they are loaded.
+const SchemaVersion = "0.8.0"
+
 func createSql() string {
 	// Returns the SQL command that is used to create the pubrecord.db
 	// We figure out where that file is by using GOPATH
 
-	sql := `-- DB Schema -- Version 0.2.0
+	sql := `-- DB Schema -- Version ` + SchemaVersion + `
 
 CREATE TABLE blocks (
     hash        TEXT NOT NULL, 
@@ -61,5 +65,6 @@ CREATE INDEX IF NOT EXISTS idx_timestamp ON blocks (timestamp);
 `
 	// REMEMBER to move the trailing ` down a line.
 
-	return sql
+	return sql + createSpatialSql + createBlacklistSql + createProofsSql + createRawTxsSql +
+		createOrphansSql + createReputationSql
 }
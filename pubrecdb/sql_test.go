@@ -31,3 +31,30 @@ func TestSchemaMatch(t *testing.T) {
 	}
 
 }
+
+func TestWriterForeignKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubrecdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := createPubRec(filepath.Join(dir, "fk.db"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.rconn.Close()
+	defer db.conn.Close()
+
+	// Without idle connections every query opens a new one.
+	db.conn.SetMaxIdleConns(0)
+	for i := 0; i < 2; i++ {
+		var on int
+		if err := db.conn.QueryRow("PRAGMA foreign_keys").Scan(&on); err != nil {
+			t.Fatal(err)
+		}
+		if on != 1 {
+			t.Fatalf("Writer connection %d does not enforce foreign keys", i)
+		}
+	}
+}
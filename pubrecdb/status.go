@@ -0,0 +1,259 @@
+package pubrecdb
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+)
+
+var (
+	// statusTables are the tables whose rows are counted in the DB status.
+	statusTables = []string{"blocks", "bulletins", "endorsements", "tags",
+		"bltn_locs", "blacklist", "merkle_proofs", "raw_txs", "orphan_endos",
+		"reputation"}
+
+	selectDBStatusSql string = `
+		SELECT
+			(SELECT count(*) FROM blocks),
+			(SELECT max(height) FROM blocks),
+			(SELECT count(*) FROM orphan_endos),
+			(SELECT count(*) FROM orphan_endos WHERE non_record != 0)
+	`
+
+	// selectPegSql selects the lowest block in the record which is the peg
+	// block the record was started from.
+	selectPegSql string = `
+		SELECT hash, height, timestamp FROM blocks
+		ORDER BY height ASC
+		LIMIT 1
+	`
+
+	// selectGapsSql finds the runs of heights above the peg block that are
+	// missing below the tip.
+	selectGapsSql string = `
+		SELECT b.height + 1, (
+			SELECT min(height) FROM blocks WHERE height > b.height
+		) - 1
+		FROM blocks AS b
+		WHERE b.height < (SELECT max(height) FROM blocks) AND
+			NOT EXISTS(SELECT * FROM blocks WHERE height = b.height + 1)
+		ORDER BY b.height ASC
+	`
+
+	// createSchemaVersionSql holds the version of the schema the record was
+	// last brought up to.
+	createSchemaVersionSql string = `
+		CREATE TABLE IF NOT EXISTS schema_version (version TEXT NOT NULL)
+	`
+
+	deleteSchemaVersionSql string = `
+		DELETE FROM schema_version
+	`
+
+	insertSchemaVersionSql string = `
+		INSERT INTO schema_version (version) VALUES ($1)
+	`
+
+	selectSchemaVersionSql string = `
+		SELECT version FROM schema_version
+	`
+)
+
+// integrityCheck holds the result of the last integrity check run against the
+// record.
+type integrityCheck struct {
+	sync.Mutex
+	last *ombjson.IntegrityCheck
+}
+
+func prepareStatus(db *PublicRecord) (err error) {
+	db.selectDBStatus, err = db.prepare(selectDBStatusSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectPeg, err = db.prepare(selectPegSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectGaps, err = db.prepare(selectGapsSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectSchemaVersion, err = db.prepare(selectSchemaVersionSql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// storeSchemaVersion records that the schema is at SchemaVersion. It is
+// run once the record has been brought up to date.
+func storeSchemaVersion(db *PublicRecord) error {
+	if _, err := db.conn.Exec(createSchemaVersionSql); err != nil {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deleteSchemaVersionSql); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(insertSchemaVersionSql, SchemaVersion); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetDBStatus reports on the health of the record. Along with the row counts
+// it shows how the stored headers line up with the tip, which heights are
+// missing, how many endorsements point at bulletins that are not stored or
+// never will be and the result of the last integrity check. The integrity
+// check is only there after CheckIntegrity has been called.
+func (db *PublicRecord) GetDBStatus() (*ombjson.DBStatus, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	status := &ombjson.DBStatus{
+		RowCounts: make(map[string]int64),
+		Gaps:      []*ombjson.HeightGap{},
+	}
+
+	// A record that was never loaded by this version has no schema version.
+	err := db.selectSchemaVersion.QueryRowContext(ctx).Scan(&status.SchemaVersion)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	size, err := db.dialect.fileSize(db)
+	if err != nil {
+		return nil, err
+	}
+	status.FileSize = size
+
+	for _, table := range statusTables {
+		cnt, err := db.countRows(table)
+		if err != nil {
+			return nil, err
+		}
+		status.RowCounts[table] = int64(cnt)
+	}
+
+	var tip sql.NullInt64
+	err = db.selectDBStatus.QueryRowContext(ctx).Scan(&status.NumHeaders, &tip,
+		&status.NumOrphanEndos, &status.NumNonRecordEndos)
+	if err != nil {
+		return nil, err
+	}
+	status.TipHeight = int32(tip.Int64)
+	status.NumPendingEndos = status.NumOrphanEndos - status.NumNonRecordEndos
+
+	peg := &ombjson.BlockRef{}
+	err = db.selectPeg.QueryRowContext(ctx).Scan(&peg.Hash, &peg.Height, &peg.Timestamp)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		status.PegBlock = peg
+	}
+
+	rows, err := db.selectGaps.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		gap := &ombjson.HeightGap{}
+		if err := rows.Scan(&gap.Start, &gap.Stop); err != nil {
+			return nil, err
+		}
+		status.Gaps = append(status.Gaps, gap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if status.PegBlock != nil {
+		want := int64(status.TipHeight-status.PegBlock.Height) + 1
+		status.Synced = len(status.Gaps) == 0 && status.NumHeaders == want
+	}
+
+	db.integrity.Lock()
+	status.Integrity = db.integrity.last
+	db.integrity.Unlock()
+
+	return status, nil
+}
+
+// CheckIntegrity runs the database's integrity check against the record and
+// keeps the result for GetDBStatus. On sqlite the check reads the whole file
+// so it can take a long time on a large record.
+func (db *PublicRecord) CheckIntegrity() (*ombjson.IntegrityCheck, error) {
+	msgs, err := db.dialect.integrityCheck(db)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &ombjson.IntegrityCheck{
+		Ok:        len(msgs) == 1 && msgs[0] == "ok",
+		Timestamp: time.Now().Unix(),
+	}
+	if !check.Ok {
+		check.Messages = msgs
+	}
+
+	db.integrity.Lock()
+	db.integrity.last = check
+	db.integrity.Unlock()
+
+	return check, nil
+}
+
+// sqliteFileSize returns the size of the sqlite file from its pages.
+func sqliteFileSize(db *PublicRecord) (int64, error) {
+	var pageCnt, pageSize int64
+	if err := db.rconn.QueryRow("PRAGMA page_count").Scan(&pageCnt); err != nil {
+		return 0, err
+	}
+	if err := db.rconn.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pageCnt * pageSize, nil
+}
+
+// sqliteIntegrityCheck runs SQLite's integrity_check.
+func sqliteIntegrityCheck(db *PublicRecord) ([]string, error) {
+	return db.queryMessages("PRAGMA integrity_check")
+}
+
+// queryMessages returns the single text column of every row the query
+// returns.
+func (db *PublicRecord) queryMessages(query string) ([]string, error) {
+	rows, err := db.rconn.QueryContext(db.baseCtx(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []string{}
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
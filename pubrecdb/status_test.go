@@ -0,0 +1,39 @@
+package pubrecdb_test
+
+import (
+	"testing"
+
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+func TestGetDBStatus(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	if _, err := db.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := db.GetDBStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.SchemaVersion != pubrecdb.SchemaVersion || status.FileSize == 0 ||
+		status.RowCounts["bulletins"] != 5 || status.RowCounts["endorsements"] != 3 {
+		t.Fatal(spw(status))
+	}
+
+	if status.PegBlock == nil || status.PegBlock.Hash != peg.GetStartBlock().Sha().String() ||
+		status.TipHeight != peg.StartHeight+3 || status.NumHeaders != 4 {
+		t.Fatal(spw(status))
+	}
+
+	if len(status.Gaps) != 0 || !status.Synced || status.NumOrphanEndos != 0 {
+		t.Fatal(spw(status))
+	}
+
+	if status.Integrity == nil || !status.Integrity.Ok {
+		t.Fatal(spw(status.Integrity))
+	}
+}
@@ -0,0 +1,80 @@
+package pubrecdb
+
+import (
+	"time"
+
+	"github.com/soapboxsys/ombudslib/ombstore"
+)
+
+// The Store interface and everything its implementations share live in
+// ombstore so that a Store can be built without the SQL drivers. They are
+// aliased here so that users of the record only need to import pubrecdb.
+type (
+	Store        = ombstore.Store
+	TxIndex      = ombstore.TxIndex
+	RecordOption = ombstore.RecordOption
+	Cursor       = ombstore.Cursor
+	AuthorFilter = ombstore.AuthorFilter
+	Event        = ombstore.Event
+	EventKind    = ombstore.EventKind
+	EventFilter  = ombstore.EventFilter
+	Subscription = ombstore.Subscription
+)
+
+const (
+	WithProof = ombstore.WithProof
+
+	BlockConnected    = ombstore.BlockConnected
+	BlockDisconnected = ombstore.BlockDisconnected
+	BulletinAdded     = ombstore.BulletinAdded
+	EndorsementAdded  = ombstore.EndorsementAdded
+
+	BlacklistTxid   = ombstore.BlacklistTxid
+	BlacklistAuthor = ombstore.BlacklistAuthor
+	BlacklistTag    = ombstore.BlacklistTag
+
+	SortPosts      = ombstore.SortPosts
+	SortEndorsed   = ombstore.SortEndorsed
+	SortFirstSeen  = ombstore.SortFirstSeen
+	SortLastActive = ombstore.SortLastActive
+
+	BucketHour = ombstore.BucketHour
+	BucketDay  = ombstore.BucketDay
+	BucketWeek = ombstore.BucketWeek
+)
+
+var (
+	ErrBadCursor         = ombstore.ErrBadCursor
+	ErrFellBehind        = ombstore.ErrFellBehind
+	ErrWithheld          = ombstore.ErrWithheld
+	ErrBadBlacklistEntry = ombstore.ErrBadBlacklistEntry
+	ErrBlockNotTip       = ombstore.ErrBlockNotTip
+	ErrBadBBox           = ombstore.ErrBadBBox
+	ErrBadPolygon        = ombstore.ErrBadPolygon
+	ErrBadSort           = ombstore.ErrBadSort
+	ErrBadSeries         = ombstore.ErrBadSeries
+	ErrBadWindow         = ombstore.ErrBadWindow
+)
+
+var _ Store = (*PublicRecord)(nil)
+
+// ParseCursor decodes a cursor that was handed out with a page.
+func ParseCursor(s string) (*Cursor, error) {
+	return ombstore.ParseCursor(s)
+}
+
+// KindFilter lets through the events of the kinds passed.
+func KindFilter(kinds ...EventKind) EventFilter {
+	return ombstore.KindFilter(kinds...)
+}
+
+// BucketWidth returns how much time a bucket of an activity series covers.
+func BucketWidth(bucket string) (time.Duration, bool) {
+	return ombstore.BucketWidth(bucket)
+}
+
+// Distance returns the distance in meters between two points on the earth's
+// surface.
+func Distance(a_lat, a_lon, b_lat, b_lon float64) float64 {
+	return ombstore.Distance(a_lat, a_lon, b_lat, b_lon)
+}
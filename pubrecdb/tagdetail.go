@@ -0,0 +1,228 @@
+package pubrecdb
+
+import (
+	"time"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+	"github.com/soapboxsys/ombudslib/ombutil"
+)
+
+var (
+	// selectRelatedTagsSql scores the other tags of the bulletins tagged
+	// with $1. Each bulletin the two share adds to the score by the age of
+	// its block compared to the tip with a half life of $2 seconds.
+	selectRelatedTagsSql string = `
+		SELECT min(o.value), min(blocks.timestamp), count(DISTINCT o.txid),
+			sum(decay((SELECT max(timestamp) FROM blocks) - blocks.timestamp, $2))
+				AS score
+		FROM tags AS t
+		JOIN tags AS o ON o.txid = t.txid AND o.value != t.value COLLATE NOCASE
+		JOIN bulletins ON bulletins.txid = t.txid
+		JOIN blocks ON bulletins.block = blocks.hash
+		WHERE t.value = $1 COLLATE NOCASE AND
+			NOT ` + withheldBltnSql("bulletins") + `
+		GROUP BY o.value COLLATE NOCASE
+		ORDER BY score DESC, min(o.value) ASC
+		LIMIT $3
+	`
+
+	tagBltnsSql string = `
+		FROM tags JOIN bulletins ON tags.txid = bulletins.txid
+		JOIN blocks ON bulletins.block = blocks.hash
+		WHERE tags.value = $1 COLLATE NOCASE AND
+			NOT ` + withheldBltnSql("bulletins") + `
+	`
+
+	selectTagFirstUseSql string = `
+		SELECT bulletins.txid ` + tagBltnsSql + `
+		ORDER BY blocks.height ASC, bulletins.txid ASC
+		LIMIT 1
+	`
+
+	selectTagAuthorsSql string = `
+		SELECT bulletins.author, count(DISTINCT bulletins.txid) ` + tagBltnsSql + `
+		GROUP BY bulletins.author
+		ORDER BY count(DISTINCT bulletins.txid) DESC, max(blocks.height) DESC
+		LIMIT $2
+	`
+
+	// selectTagActivitySql counts the bulletins tagged with $1, the
+	// endorsements they got and the authors of both between $2 and $3 in
+	// buckets that are $4 seconds wide.
+	selectTagActivitySql string = `
+		SELECT (ts - $2) / $4 AS bucket, sum(kind = 0), sum(kind = 1),
+			count(DISTINCT author)
+		FROM (
+			SELECT 0 AS kind, blocks.timestamp AS ts,
+				bulletins.author AS author ` + tagBltnsSql + `
+			UNION ALL
+			SELECT 1, blocks.timestamp, e.author
+			FROM endorsements AS e JOIN blocks ON e.block = blocks.hash
+			WHERE NOT ` + withheldEndoSql("e") + ` AND e.bid IN (
+				SELECT bulletins.txid ` + tagBltnsSql + `
+			)
+		) AS records
+		WHERE ts >= $2 AND ts < $3
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`
+)
+
+func prepareTagDetail(db *PublicRecord) (err error) {
+	db.selectRelatedTags, err = db.prepare(selectRelatedTagsSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectTagFirstUse, err = db.prepare(selectTagFirstUseSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectTagAuthors, err = db.prepare(selectTagAuthorsSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectTagActivity, err = db.prepare(selectTagActivitySql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetRelatedTags returns up to n of the tags that are used most often on the
+// same bulletins as tag. Bulletins count for half as much towards the score
+// every ombstore.RelatedTagsHalfLife so tags that went together recently
+// come first. The Count of each tag is the number of bulletins it shares
+// with tag and FirstTs is when the first of those was mined.
+func (db *PublicRecord) GetRelatedTags(tag ombutil.Tag, n int) ([]*ombjson.Tag, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	hl := int64(ombstore.RelatedTagsHalfLife / time.Second)
+	rows, err := db.selectRelatedTags.QueryContext(ctx, string(tag), hl, db.pageLimit(n))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*ombjson.Tag{}
+	for rows.Next() {
+		t := &ombjson.Tag{}
+		if err := rows.Scan(&t.Value, &t.FirstTs, &t.Count, &t.Score); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetTagActivity counts the bulletins tagged with tag, the endorsements they
+// got and the unique authors of both between start and end. The series is
+// cut into buckets the same way as by GetActivitySeries.
+func (db *PublicRecord) GetTagActivity(tag ombutil.Tag, start, end time.Time, bucket string) (*ombjson.ActivitySeries, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	series, width, err := ombstore.NewActivitySeries(start, end, bucket, db.maxQueryLimit)
+	if err != nil {
+		return nil, err
+	}
+	n := len(series.Buckets)
+
+	rows, err := db.selectTagActivity.QueryContext(ctx, string(tag), series.StartTs,
+		series.StopTs, int64(width.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i int
+		var nBltns, nEndos, nAuthors int64
+		if err := rows.Scan(&i, &nBltns, &nEndos, &nAuthors); err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= n {
+			continue
+		}
+
+		a := series.Buckets[i]
+		a.NumBltns = nBltns
+		a.NumEndos = nEndos
+		a.NumAuthors = nAuthors
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
+
+// GetTagDetail returns the first bulletin that used tag, the authors that
+// used it the most, its activity series between start and end and the tags
+// related to it. If tag was never used sql.ErrNoRows is returned and if it is
+// blacklisted ErrWithheld is. ErrBadSeries is returned if the series is
+// malformed.
+func (db *PublicRecord) GetTagDetail(tag ombutil.Tag, start, end time.Time, bucket string) (*ombjson.TagDetail, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	listed, err := db.isBlacklisted(BlacklistTag, string(tag))
+	if err != nil {
+		return nil, err
+	}
+	if listed {
+		return nil, ErrWithheld
+	}
+
+	var txid string
+	if err := db.selectTagFirstUse.QueryRowContext(ctx, string(tag)).Scan(&txid); err != nil {
+		return nil, err
+	}
+	first, err := db.scanBltn(db.selectBltn.QueryRowContext(ctx, txid))
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &ombjson.TagDetail{
+		Value:      string(tag),
+		FirstUse:   first,
+		TopAuthors: []*ombjson.TagAuthor{},
+	}
+
+	rows, err := db.selectTagAuthors.QueryContext(ctx, string(tag), ombstore.NumTagDetailItems)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		a := &ombjson.TagAuthor{}
+		if err := rows.Scan(&a.Address, &a.NumBltns); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		detail.TopAuthors = append(detail.TopAuthors, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	detail.Activity, err = db.GetTagActivity(tag, start, end, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	detail.Related, err = db.GetRelatedTags(tag, ombstore.NumTagDetailItems)
+	if err != nil {
+		return nil, err
+	}
+
+	return detail, nil
+}
@@ -0,0 +1,89 @@
+package pubrecdb_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/soapboxsys/ombudslib/ombutil"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+// insertTaggedBltns adds a bulletin that uses #lambs along with #Preflight at
+// the tip and one that uses it with #news decades before.
+func insertTaggedBltns(t *testing.T, db *pubrecdb.PublicRecord) {
+	bltn := fakeUBltn(20)
+	m := "Counting #lambs before #Preflight"
+	bltn.Wire.Message = &m
+	if err, _ := db.InsertBulletin(bltn); err != nil {
+		t.Fatal(err)
+	}
+
+	bltn = fakeUBltn(21)
+	bltn.Block = tst_blk_a
+	m = "Old #lambs make the #news"
+	bltn.Wire.Message = &m
+	if err, _ := db.InsertBulletin(bltn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetRelatedTags(t *testing.T) {
+	db, _ := SetupTestDB(true)
+	insertTaggedBltns(t, db)
+
+	tags, err := db.GetRelatedTags(ombutil.Tag("#LAMBS"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Value != "#Preflight" || tags[0].Count != 1 ||
+		tags[1].Value != "#news" || tags[0].Score <= tags[1].Score {
+		t.Fatal(spw(tags))
+	}
+
+	tags, err = db.GetRelatedTags(ombutil.Tag("#news"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Value != "#lambs" {
+		t.Fatal(spw(tags))
+	}
+}
+
+func TestGetTagDetail(t *testing.T) {
+	db, _ := SetupTestDB(true)
+	insertTaggedBltns(t, db)
+
+	ts := peg.GetStartBlock().MsgBlock().Header.Timestamp
+	start, end := ts.Add(-24*time.Hour), ts.Add(24*time.Hour)
+
+	detail, err := db.GetTagDetail(ombutil.Tag("#preflight"), start, end, pubrecdb.BucketDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.FirstUse == nil || detail.FirstUse.BlockRef.Height != peg.StartHeight {
+		t.Fatal(spw(detail))
+	}
+	if len(detail.TopAuthors) != 1 || detail.TopAuthors[0].NumBltns != 3 {
+		t.Fatal(spw(detail.TopAuthors))
+	}
+	if len(detail.Related) != 1 || detail.Related[0].Value != "#lambs" {
+		t.Fatal(spw(detail.Related))
+	}
+
+	// bltn(4) is the only endorsed bulletin and it is not tagged.
+	var nBltns, nEndos int64
+	for _, a := range detail.Activity.Buckets {
+		nBltns += a.NumBltns
+		nEndos += a.NumEndos
+	}
+	if nBltns != 3 || nEndos != 0 {
+		t.Fatal(spw(detail.Activity))
+	}
+
+	_, err = db.GetTagDetail(ombutil.Tag("#unused"), start, end, pubrecdb.BucketDay)
+	if err != sql.ErrNoRows {
+		t.Fatalf("Unused tags have no detail: %v", err)
+	}
+}
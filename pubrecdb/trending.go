@@ -0,0 +1,194 @@
+package pubrecdb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/soapboxsys/ombudslib/ombjson"
+	"github.com/soapboxsys/ombudslib/ombstore"
+)
+
+var (
+	// trendSql lists what a trend is made of: the bulletins and the
+	// endorsements of them mined in the last $2 seconds before the tip.
+	// Every record is weighed by the age of its block relative to the tip.
+	// Only the first endorsement an author sent of a bulletin counts. Each
+	// branch starts from the blocks in the window so that older records are
+	// never read.
+	trendSql string = `
+		SELECT bid, kind, ts, tip
+		FROM (
+			SELECT bulletins.txid AS bid, 0 AS kind, blocks.timestamp AS ts, tip.ts AS tip
+			FROM (SELECT max(timestamp) AS ts FROM blocks) AS tip
+			JOIN blocks ON blocks.timestamp >= tip.ts - $2
+			JOIN bulletins ON bulletins.block = blocks.hash
+			UNION ALL
+			SELECT e.bid, 1, blocks.timestamp, tip.ts
+			FROM (SELECT max(timestamp) AS ts FROM blocks) AS tip
+			JOIN blocks ON blocks.timestamp >= tip.ts - $2
+			JOIN endorsements AS e ON e.block = blocks.hash
+			WHERE NOT ` + withheldEndoSql("e") + ` AND
+				` + firstEndoSql("e", "blocks") + `
+		) AS records
+	`
+
+	// trendTagsSql scores each tag by the decayed uses and endorsements of
+	// the bulletins that carry it with a half life of $1 seconds. Only the
+	// records of the last $2 seconds before the tip are counted. The records
+	// of withheld bulletins are scored on their own row for each tag so that
+	// the caller can tell where they would have ranked.
+	trendTagsSql string = `
+		SELECT min(tags.value), min(CASE WHEN kind = 0 THEN ts END),
+			sum(kind = 0), sum(decay(tip - ts, $1)) AS score, w
+		FROM (
+			SELECT t.bid, t.kind, t.ts, t.tip,
+				` + withheldBltnSql("bulletins") + ` AS w
+			FROM (` + trendSql + `) AS t
+			JOIN bulletins ON bulletins.txid = t.bid
+		) AS t
+		JOIN tags ON tags.txid = t.bid
+		GROUP BY tags.value COLLATE NOCASE, w
+		ORDER BY score DESC, min(tags.value) ASC
+	`
+
+	// trendBltnsSql scores bulletins the same way trendTagsSql scores tags.
+	trendBltnsSql string = `
+		SELECT s.bid, s.score, ` + withheldBltnSql("bulletins") + `
+		FROM (
+			SELECT t.bid, sum(decay(tip - ts, $1)) AS score
+			FROM (` + trendSql + `) AS t
+			GROUP BY t.bid
+		) AS s
+		JOIN bulletins ON bulletins.txid = s.bid
+		ORDER BY s.score DESC, s.bid ASC
+	`
+)
+
+// firstEndoSql is true for the endorsement aliased as e mined in the block
+// aliased as b when its author did not endorse the same bulletin earlier.
+func firstEndoSql(e, b string) string {
+	return fmt.Sprintf(`NOT EXISTS(
+		SELECT * FROM endorsements AS fe JOIN blocks AS fb ON fe.block = fb.hash
+		WHERE fe.bid = %s.bid AND fe.author = %s.author AND
+			(fb.height < %s.height OR (fb.height = %s.height AND fe.txid < %s.txid))
+	)`, e, e, b, b, e)
+}
+
+func prepareTrending(db *PublicRecord) (err error) {
+	db.selectTrendTags, err = db.prepare(trendTagsSql)
+	if err != nil {
+		return err
+	}
+
+	db.selectTrendBltns, err = db.prepare(trendBltnsSql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetTrendingTags returns up to limit of the tags that are trending the most
+// with the highest first. A bulletin using a tag and every endorsement it
+// gets add to the tag's score. Each counts for less the older its block is
+// compared to the tip and half as much after halfLife. The tag's Count is the
+// number of times it was used in the span that was looked at and FirstTs is
+// when the first of those was mined. The records of withheld bulletins are
+// left out and it is reported if they would have put a tag in the list.
+// ErrBadWindow is returned if halfLife is shorter than a second.
+func (db *PublicRecord) GetTrendingTags(halfLife time.Duration, limit int) ([]*ombjson.Tag, bool, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	hl, span, err := ombstore.TrendArgs(halfLife)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rows, err := db.selectTrendTags.QueryContext(ctx, hl, span)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	limit = db.pageLimit(limit)
+	tags := []*ombjson.Tag{}
+	withheld := false
+	for len(tags) < limit && rows.Next() {
+		tag := &ombjson.Tag{}
+		var first sql.NullInt64
+		var w bool
+		err := rows.Scan(&tag.Value, &first, &tag.Count, &tag.Score, &w)
+		if err != nil {
+			return nil, false, err
+		}
+		if w {
+			withheld = true
+			continue
+		}
+		tag.FirstTs = first.Int64
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	return tags, withheld, nil
+}
+
+// GetTrendingBltns returns up to limit of the bulletins that are trending the
+// most with the highest first. They are scored like the tags in
+// GetTrendingTags. It reports if any bulletin that would have been listed was
+// withheld.
+func (db *PublicRecord) GetTrendingBltns(halfLife time.Duration, limit int) ([]*ombjson.TrendingBltn, bool, error) {
+	ctx, cancel := db.queryCtx()
+	defer cancel()
+
+	hl, span, err := ombstore.TrendArgs(halfLife)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rows, err := db.selectTrendBltns.QueryContext(ctx, hl, span)
+	if err != nil {
+		return nil, false, err
+	}
+
+	type scored struct {
+		txid  string
+		score float64
+	}
+	limit = db.pageLimit(limit)
+	top := []scored{}
+	withheld := false
+	for len(top) < limit && rows.Next() {
+		var s scored
+		var w bool
+		if err := rows.Scan(&s.txid, &s.score, &w); err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		if w {
+			withheld = true
+			continue
+		}
+		top = append(top, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	trending := []*ombjson.TrendingBltn{}
+	for _, s := range top {
+		bltn, err := db.scanBltn(db.selectBltn.QueryRowContext(ctx, s.txid))
+		if err != nil {
+			return nil, false, err
+		}
+		trending = append(trending, &ombjson.TrendingBltn{
+			Bulletin: bltn,
+			Score:    s.score,
+		})
+	}
+	return trending, withheld, nil
+}
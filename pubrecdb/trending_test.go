@@ -0,0 +1,52 @@
+package pubrecdb_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+func TestGetTrendingTags(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	// The peg block is the tip. #lambs was used in a test block decades
+	// before it so only #preflight is still trending.
+	tags, withheld, err := db.GetTrendingTags(7*24*time.Hour, 10)
+	if err != nil || withheld {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Value != "#preflight" || tags[0].Count != 2 ||
+		math.Abs(tags[0].Score-2) > 1e-9 {
+		t.Fatal(spw(tags))
+	}
+
+	if _, _, err := db.GetTrendingTags(0, 10); err != pubrecdb.ErrBadWindow {
+		t.Fatalf("An empty window should be rejected: %v", err)
+	}
+}
+
+func TestGetTrendingBltns(t *testing.T) {
+	db, _ := SetupTestDB(true)
+
+	bltns, withheld, err := db.GetTrendingBltns(7*24*time.Hour, 10)
+	if err != nil || withheld {
+		t.Fatal(err)
+	}
+	if len(bltns) != 4 {
+		t.Fatal(spw(bltns))
+	}
+
+	// bltn(4) counts once for itself and once for each of its two endorsers.
+	top := bltns[0]
+	if top.Bulletin.Txid != "c19fbeacb46e865bfee6db89e9b0a41019079efa305b477d14a35945442e9f45" ||
+		math.Abs(top.Score-3) > 1e-9 {
+		t.Fatal(spw(top))
+	}
+	for _, b := range bltns[1:] {
+		if math.Abs(b.Score-1) > 1e-9 {
+			t.Fatal(spw(b))
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package pubrecdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+)
+
+var selectHeadersSql string = `
+	SELECT hash, prevhash, height, timestamp, version, merkleroot, difficulty, nonce
+	FROM blocks
+	ORDER BY height ASC
+`
+
+// A BlockFault describes the first block in the record that failed
+// verification.
+type BlockFault struct {
+	Height int32
+	Hash   string
+	Reason string
+}
+
+func (f *BlockFault) Error() string {
+	return fmt.Sprintf("block %s at height %d is bad: %s", f.Hash, f.Height, f.Reason)
+}
+
+// pegParams returns the params of the network whose peg block is hash. It
+// returns nil if hash is not a block a record can be started from.
+func pegParams(hash string) *chaincfg.Params {
+	switch hash {
+	case peg.GetStartBlock().Sha().String():
+		return &chaincfg.MainNetParams
+	case peg.GetTestStartBlock().Sha().String():
+		return &chaincfg.TestNet3Params
+	}
+	return nil
+}
+
+// rebuildHeader puts a block header back together from the fields stored
+// with it.
+func rebuildHeader(prevhash, merkleroot string, ts int64, version int32, bits, nonce uint32) (*wire.BlockHeader, error) {
+	prev, err := wire.NewShaHashFromStr(prevhash)
+	if err != nil {
+		return nil, fmt.Errorf("prevhash is malformed")
+	}
+	root, err := wire.NewShaHashFromStr(merkleroot)
+	if err != nil {
+		return nil, fmt.Errorf("merkleroot is malformed")
+	}
+
+	h := &wire.BlockHeader{
+		Version:    version,
+		PrevBlock:  *prev,
+		MerkleRoot: *root,
+		Timestamp:  time.Unix(ts, 0),
+		Bits:       bits,
+		Nonce:      nonce,
+	}
+	return h, nil
+}
+
+// checkHeader rebuilds the block header and checks that the header hashes to
+// the stored hash and that the hash meets the target its difficulty sets.
+func checkHeader(hash, prevhash, merkleroot string, ts int64, version int32, bits, nonce uint32) string {
+	h, err := rebuildHeader(prevhash, merkleroot, ts, version, bits, nonce)
+	if err != nil {
+		return err.Error()
+	}
+	sha := h.BlockSha()
+	if sha.String() != hash {
+		return fmt.Sprintf("header hashes to %s", sha.String())
+	}
+
+	target := blockchain.CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return fmt.Sprintf("difficulty %08x is not a valid target", bits)
+	}
+	if blockchain.ShaHashToBig(&sha).Cmp(target) > 0 {
+		return fmt.Sprintf("hash is above the target set by difficulty %08x", bits)
+	}
+	return ""
+}
+
+// VerifyChain checks every block header stored in the record. Each header
+// must hash to its stored hash and meet the proof of work its difficulty
+// sets. The difficulty may not be easier than the network's limit and must
+// only change where the consensus rules change it. The headers must link
+// from a peg block up to the tip with no heights missing. It returns the
+// number of blocks that passed and a *BlockFault for the first block that did
+// not. A record with no blocks passes.
+func (db *PublicRecord) VerifyChain() (int, error) {
+	return verifyChain(db.baseCtx(), db.rconn)
+}
+
+// VerifyChainAt checks the headers of the sqlite record at path like
+// VerifyChain without ever writing to it. The schema is left as it is, so
+// records made by older versions can be checked too. Passing nil for opts
+// uses DefaultOptions.
+func VerifyChainAt(path string, opts *Options) (int, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	registerSqliteDriver()
+
+	conn, err := sql.Open("sqlite3_custom", sqliteDSN(filepath.Clean(path), opts, true))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	return verifyChain(context.Background(), conn)
+}
+
+func verifyChain(ctx context.Context, conn *sql.DB) (int, error) {
+	rows, err := conn.QueryContext(ctx, selectHeadersSql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	var lastHash string
+	var lastHeight int32
+	var diff *diffCheck
+	for rows.Next() {
+		var hash, prevhash, merkleroot string
+		var height int32
+		var ts int64
+		var version int32
+		var bits, nonce uint32
+		err := rows.Scan(&hash, &prevhash, &height, &ts, &version, &merkleroot,
+			&bits, &nonce)
+		if err != nil {
+			return n, err
+		}
+
+		fault := &BlockFault{Height: height, Hash: hash}
+		if n == 0 {
+			params := pegParams(hash)
+			if params == nil {
+				fault.Reason = "the lowest block is not a peg block"
+				return n, fault
+			}
+			diff = newDiffCheck(params)
+		}
+		if n > 0 && height != lastHeight+1 {
+			fault.Reason = fmt.Sprintf("heights %d to %d are missing", lastHeight+1, height-1)
+			return n, fault
+		}
+		if n > 0 && prevhash != lastHash {
+			fault.Reason = fmt.Sprintf("prevhash does not link to %s", lastHash)
+			return n, fault
+		}
+		if fault.Reason = checkHeader(hash, prevhash, merkleroot, ts, version,
+			bits, nonce); fault.Reason != "" {
+			return n, fault
+		}
+		if fault.Reason = diff.next(height, ts, bits, n == 0); fault.Reason != "" {
+			return n, fault
+		}
+
+		lastHash, lastHeight = hash, height
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,39 @@
+package pubrecdb_test
+
+import (
+	"testing"
+
+	"github.com/soapboxsys/ombudslib/ombwire/peg"
+	"github.com/soapboxsys/ombudslib/pubrecdb"
+)
+
+func TestVerifyChain(t *testing.T) {
+	db, _ := SetupTestDB(false)
+
+	// Only the peg block is stored and it is a real block.
+	n, err := db.VerifyChain()
+	if n != 1 || err != nil {
+		t.Fatalf("Peg block should verify: %d %v", n, err)
+	}
+
+	// The test blocks are not mined so none of them meet their difficulty.
+	db, _ = SetupTestDB(true)
+	n, err = db.VerifyChain()
+	fault, ok := err.(*pubrecdb.BlockFault)
+	if n != 1 || !ok || fault.Height != peg.StartHeight+1 ||
+		fault.Hash != tst_blk_a.Sha().String() {
+		t.Fatalf("First test block should fail: %d %v", n, err)
+	}
+}
+
+func TestVerifyReadOnly(t *testing.T) {
+	if testPgURL != "" {
+		t.Skip("Only sqlite records are opened read-only")
+	}
+	SetupTestDB(false)
+
+	n, err := pubrecdb.VerifyChainAt(getPath(), nil)
+	if n != 1 || err != nil {
+		t.Fatalf("Peg block should verify: %d %v", n, err)
+	}
+}
@@ -1,6 +1,11 @@
 package rpcexten
 
-import "github.com/btcsuite/btcd/btcjson"
+import (
+	"strings"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/soapboxsys/ombudslib/ombutil"
+)
 
 var (
 	sendbltnMeth    = "sendbulletin"
@@ -35,6 +40,34 @@ type ComposeBulletinCmdv2 struct {
 	Message string
 }
 
+// BoardMessage returns the message to put on the wire for a bulletin posted
+// to a board. Boards are backed by tags, so the board's tag is put in front of
+// the message unless the message already carries it.
+func BoardMessage(board, msg string) string {
+	board = strings.TrimPrefix(board, "#")
+	if board == "" {
+		return msg
+	}
+
+	tag := ombutil.Tag("#" + board)
+	for t := range ombutil.ParseTags(msg) {
+		if strings.EqualFold(string(t), string(tag)) {
+			return msg
+		}
+	}
+	return string(tag) + " " + msg
+}
+
+// BltnMessage returns the message of the bulletin with its board attached.
+func (cmd *SendBulletinCmdv2) BltnMessage() string {
+	return BoardMessage(cmd.Board, cmd.Message)
+}
+
+// BltnMessage returns the message of the bulletin with its board attached.
+func (cmd *ComposeBulletinCmdv2) BltnMessage() string {
+	return BoardMessage(cmd.Board, cmd.Message)
+}
+
 func registerJsonSendCmds() {
 	btcjson.MustRegisterCmd(sendbltnMeth, (*SendBulletinCmdv2)(nil), btcjson.UFWalletOnly)
 
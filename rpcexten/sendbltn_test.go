@@ -0,0 +1,33 @@
+package rpcexten_test
+
+import (
+	"testing"
+
+	"github.com/soapboxsys/ombudslib/rpcexten"
+)
+
+func TestBoardMessage(t *testing.T) {
+	tests := []struct {
+		board, msg, want string
+	}{
+		{"", "No board", "No board"},
+		{"news", "Fresh off the wire", "#news Fresh off the wire"},
+		{"#news", "Fresh off the wire", "#news Fresh off the wire"},
+		{"news", "Already on #News", "Already on #News"},
+		{"news", "Only on #newsroom", "#news Only on #newsroom"},
+	}
+	for _, test := range tests {
+		if got := rpcexten.BoardMessage(test.board, test.msg); got != test.want {
+			t.Errorf("BoardMessage(%q, %q) = %q, want %q", test.board, test.msg, got, test.want)
+		}
+	}
+
+	cmd := &rpcexten.SendBulletinCmdv2{Board: "news", Message: "Hello"}
+	if cmd.BltnMessage() != "#news Hello" {
+		t.Fatal(cmd.BltnMessage())
+	}
+	compose := &rpcexten.ComposeBulletinCmdv2{Board: "news", Message: "Hello"}
+	if compose.BltnMessage() != "#news Hello" {
+		t.Fatal(compose.BltnMessage())
+	}
+}